@@ -0,0 +1,330 @@
+package execute
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditRecord is the audit log entry written for every execution.
+type AuditRecord struct {
+	StartTime    time.Time     `json:"start_time"`
+	EndTime      time.Time     `json:"end_time"`
+	Duration     time.Duration `json:"duration"`
+	Host         string        `json:"host,omitempty"`
+	Invoker      string        `json:"invoker,omitempty"`
+	User         string        `json:"user,omitempty"`
+	Command      string        `json:"command"`
+	Path         string        `json:"path"`
+	Args         []string      `json:"args,omitempty"`
+	Dir          string        `json:"dir,omitempty"`
+	EnvKeys      []string      `json:"env_keys,omitempty"`
+	ScriptType   ScriptType    `json:"script_type,omitempty"`
+	ScriptSHA256 string        `json:"script_sha256,omitempty"`
+	TTY          bool          `json:"tty,omitempty"`
+	DryRun       bool          `json:"dry_run,omitempty"`
+	ExitCode     int           `json:"exit_code"`
+	Error        string        `json:"error,omitempty"`
+	TimedOut     bool          `json:"timed_out,omitempty"`
+	StdoutBytes  int64         `json:"stdout_bytes"`
+	StderrBytes  int64         `json:"stderr_bytes"`
+	StdoutSHA256 string        `json:"stdout_sha256,omitempty"`
+	StderrSHA256 string        `json:"stderr_sha256,omitempty"`
+}
+
+// AuditSink receives an audit record for every execution of an executor. Records only ever contain redacted
+// commands, the values of the environment are never recorded.
+type AuditSink interface {
+	Audit(record *AuditRecord) error
+}
+
+// AuditSinkFunc is an adapter to allow the use of ordinary functions as an AuditSink.
+type AuditSinkFunc func(record *AuditRecord) error
+
+// Audit calls f(record).
+func (f AuditSinkFunc) Audit(record *AuditRecord) error {
+	return f(record)
+}
+
+// SetAuditSink sets the sink receiving an audit record for every execution. A nil sink disables auditing.
+func (e *BaseExecutor) SetAuditSink(sink AuditSink) {
+	e.auditSink = sink
+}
+
+// AuditSink returns the audit sink of the executor.
+func (e *BaseExecutor) AuditSink() AuditSink {
+	return e.auditSink
+}
+
+// SetSensitiveEnv sets the names of the environment variables whose values are secrets. The values are redacted
+// wherever they appear in a command, e.g. in audit records, logs and dry-run plans. Names are case-insensitive and
+// may contain the wildcards supported by path.Match such as "*_TOKEN".
+func (e *BaseExecutor) SetSensitiveEnv(names []string) {
+	e.sensitiveEnv = names
+}
+
+// SensitiveEnv returns the names of the environment variables whose values are secrets.
+func (e *BaseExecutor) SensitiveEnv() []string {
+	return e.sensitiveEnv
+}
+
+// redactSensitiveEnv adds the values of the sensitive environment variables of the spec to its secrets.
+func (e *BaseExecutor) redactSensitiveEnv(spec *CommandSpec) {
+	if len(e.sensitiveEnv) == 0 {
+		return
+	}
+	for _, entry := range spec.Environ(os.Environ()) {
+		key, value, ok := strings.Cut(entry, "=")
+		if ok && value != "" && e.isSensitiveEnv(key) {
+			spec.AddSecret(value)
+		}
+	}
+}
+
+// isSensitiveEnv returns whether the environment variable is sensitive.
+func (e *BaseExecutor) isSensitiveEnv(key string) bool {
+	key = strings.ToUpper(key)
+	for _, name := range e.sensitiveEnv {
+		if matched, _ := path.Match(strings.ToUpper(name), key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// audit writes the audit record of the result to the audit sink. Failing to write the record is logged but doesn't
+// fail the execution.
+func (e *BaseExecutor) audit(result *Result) {
+	record := NewAuditRecord(result)
+	if err := e.auditSink.Audit(record); err != nil {
+		e.log().Error("failed to write audit record", "command", record.Command, "error", err)
+	}
+}
+
+// NewAuditRecord returns the audit record for the result, which can be used by middleware recording executions
+// elsewhere.
+func NewAuditRecord(result *Result) *AuditRecord {
+	spec := result.Spec
+	record := &AuditRecord{
+		StartTime:    result.StartTime,
+		EndTime:      result.EndTime,
+		Duration:     result.Duration(),
+		Host:         auditHost(),
+		Invoker:      auditInvoker(),
+		User:         spec.User,
+		Command:      spec.Command,
+		Path:         spec.Path,
+		Args:         spec.Args,
+		Dir:          spec.Dir,
+		EnvKeys:      envKeys(spec.Environ(nil)),
+		ScriptType:   spec.ScriptType,
+		ScriptSHA256: spec.ScriptSHA256,
+		TTY:          spec.TTY,
+		DryRun:       result.DryRun,
+		ExitCode:     result.ExitCode,
+		TimedOut:     result.TimedOut,
+		StdoutBytes:  result.StdoutBytes,
+		StderrBytes:  result.StderrBytes,
+		StdoutSHA256: result.StdoutSHA256,
+		StderrSHA256: result.StderrSHA256,
+	}
+	if result.Err != nil {
+		record.Error = spec.redact(result.Err.Error())
+	}
+	return record
+}
+
+// envKeys returns the names of the variables in the environment.
+func envKeys(env []string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(env))
+	for _, entry := range env {
+		key, _, _ := strings.Cut(entry, "=")
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+var (
+	auditIdentityOnce sync.Once
+	auditHostname     string
+	auditUsername     string
+)
+
+// auditHost returns the hostname of the system.
+func auditHost() string {
+	auditIdentityOnce.Do(loadAuditIdentity)
+	return auditHostname
+}
+
+// auditInvoker returns the name of the user running the current process.
+func auditInvoker() string {
+	auditIdentityOnce.Do(loadAuditIdentity)
+	return auditUsername
+}
+
+// loadAuditIdentity looks up the hostname and the user running the current process.
+func loadAuditIdentity() {
+	auditHostname, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		auditUsername = u.Username
+	}
+}
+
+// FileAuditOption configures a FileAuditSink.
+type FileAuditOption func(s *FileAuditSink)
+
+// AuditMaxSize sets the size in bytes after which the audit log is rotated. A size of 0 disables rotation.
+func AuditMaxSize(size int64) FileAuditOption {
+	return func(s *FileAuditSink) {
+		s.maxSize = size
+	}
+}
+
+// AuditMaxBackups sets the number of rotated audit logs that are kept. Older logs are removed.
+func AuditMaxBackups(n int) FileAuditOption {
+	return func(s *FileAuditSink) {
+		s.maxBackups = n
+	}
+}
+
+// FileAuditSink is an AuditSink writing one JSON record per line to a file. Every record is synced to disk before
+// Audit returns. Once the file reaches its maximum size it is rotated to <path>.1, the previous <path>.1 is moved to
+// <path>.2 and so on.
+type FileAuditSink struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewFileAuditSink opens the audit log at path for appending, creating it with mode 0600 if it doesn't exist. By
+// default the log is rotated at 100 MiB and 5 rotated logs are kept.
+func NewFileAuditSink(path string, options ...FileAuditOption) (*FileAuditSink, error) {
+	s := &FileAuditSink{
+		path:       path,
+		maxSize:    100 << 20,
+		maxBackups: 5,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Audit appends the record to the audit log and syncs it to disk.
+func (s *FileAuditSink) Audit(record *AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	// A failed rotation is retried with the next record, which is still written to the current audit log
+	var rotateErr error
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		rotateErr = s.rotate()
+		if s.file == nil {
+			return rotateErr
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	return rotateErr
+}
+
+// Close closes the audit log.
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// open opens the audit log for appending.
+func (s *FileAuditSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate moves the current audit log to the first backup, shifting the existing backups and removing the oldest
+// one, and opens a new audit log. When the backups can't be moved the current audit log is reopened.
+func (s *FileAuditSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+	s.file = nil
+
+	if err := s.shiftBackups(); err != nil {
+		if openErr := s.open(); openErr != nil {
+			return errors.Join(err, openErr)
+		}
+		return err
+	}
+	return s.open()
+}
+
+// shiftBackups moves the current audit log to the first backup, shifting the existing backups and removing the
+// oldest one.
+func (s *FileAuditSink) shiftBackups() error {
+	if s.maxBackups > 0 {
+		os.Remove(s.backupPath(s.maxBackups))
+		for i := s.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(s.backupPath(i), s.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to rotate audit log: %w", err)
+			}
+		}
+		if err := os.Rename(s.path, s.backupPath(1)); err != nil {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	} else if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	return nil
+}
+
+// backupPath returns the path of the nth rotated audit log.
+func (s *FileAuditSink) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", s.path, n)
+}
@@ -0,0 +1,201 @@
+package execute
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// auditRecorder is an AuditSink collecting the records in memory.
+type auditRecorder struct {
+	mu      sync.Mutex
+	records []*AuditRecord
+}
+
+func (r *auditRecorder) Audit(record *AuditRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+	return nil
+}
+
+func (r *auditRecorder) all() []*AuditRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*AuditRecord(nil), r.records...)
+}
+
+func TestAudit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+
+	t.Run("Audit_RecordsExecution", func(t *testing.T) {
+		sink := &auditRecorder{}
+		executor := NewExecutor(WithAuditSink(sink), WithEnvironment([]string{"PATH=" + os.Getenv("PATH"), "NAME=value"}))
+
+		if _, err := executor.Execute("echo hello"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		records := sink.all()
+		if len(records) != 1 {
+			t.Fatalf("Expected 1 record, but got %d", len(records))
+		}
+		record := records[0]
+		if filepath.Base(record.Path) != "echo" || record.ExitCode != 0 {
+			t.Errorf("Unexpected record: %+v", record)
+		}
+		if record.StdoutBytes != 6 || record.StdoutSHA256 != sha256Hex("hello\n") {
+			t.Errorf("Expected the stdout to be hashed, but got %d bytes with hash %s", record.StdoutBytes, record.StdoutSHA256)
+		}
+		if strings.Join(record.EnvKeys, ",") != "PATH,NAME" {
+			t.Errorf("Expected env keys PATH,NAME, but got %v", record.EnvKeys)
+		}
+		if record.EndTime.Before(record.StartTime) {
+			t.Errorf("Expected the end time to be after the start time")
+		}
+	})
+
+	t.Run("Audit_RecordsExitCode", func(t *testing.T) {
+		sink := &auditRecorder{}
+		executor := NewExecutor(WithAuditSink(sink), WithDefaultShell())
+
+		if _, err := executor.Execute("exit 3"); err == nil {
+			t.Fatalf("Expected error, but got nil")
+		}
+		records := sink.all()
+		if len(records) != 1 || records[0].ExitCode != 3 || records[0].Error == "" {
+			t.Errorf("Expected a record with exit code 3, but got %+v", records)
+		}
+	})
+
+	t.Run("Audit_RedactsSecrets", func(t *testing.T) {
+		sink := &auditRecorder{}
+		executor := NewExecutor(
+			WithAuditSink(sink),
+			WithDryRun(),
+			WithShell("/bin/sh"),
+			WithSudoCredentials("hunter2"),
+			WithEnvironment([]string{"API_TOKEN=s3cr3t"}),
+			WithSensitiveEnv("*_token"),
+		)
+
+		if _, err := executor.Execute("sudo curl -H s3cr3t localhost"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		records := sink.all()
+		if len(records) != 1 {
+			t.Fatalf("Expected 1 record, but got %d", len(records))
+		}
+		data, _ := json.Marshal(records[0])
+		if strings.Contains(string(data), "hunter2") || strings.Contains(string(data), "s3cr3t") {
+			t.Errorf("Expected secrets to be redacted, but got %s", data)
+		}
+		if !records[0].DryRun {
+			t.Errorf("Expected the record to be marked as a dry run")
+		}
+	})
+}
+
+func TestFileAuditSink(t *testing.T) {
+	t.Run("FileAuditSink_WritesJSONLines", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.jsonl")
+		sink, err := NewFileAuditSink(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 3; i++ {
+			if err := sink.Audit(&AuditRecord{Command: "echo", StartTime: time.Now()}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer file.Close()
+		lines := 0
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var record AuditRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			lines++
+		}
+		if lines != 3 {
+			t.Errorf("Expected 3 lines, but got %d", lines)
+		}
+		if runtime.GOOS != "windows" {
+			info, _ := file.Stat()
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("Expected permissions 0600, but got %o", info.Mode().Perm())
+			}
+		}
+	})
+
+	t.Run("FileAuditSink_Rotates", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.jsonl")
+		sink, err := NewFileAuditSink(path, AuditMaxSize(200), AuditMaxBackups(2))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer sink.Close()
+		for i := 0; i < 10; i++ {
+			if err := sink.Audit(&AuditRecord{Command: strings.Repeat("x", 100)}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+
+		for _, name := range []string{path, path + ".1", path + ".2"} {
+			if _, err := os.Stat(name); err != nil {
+				t.Errorf("Expected %s to exist: %v", name, err)
+			}
+		}
+		if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+			t.Errorf("Expected only 2 backups to be kept")
+		}
+	})
+
+	t.Run("FileAuditSink_KeepsWritingWhenRotationFails", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.jsonl")
+		// A non-empty directory in place of the backup can't be replaced by the audit log
+		if err := os.MkdirAll(filepath.Join(path+".1", "blocker"), 0700); err != nil {
+			t.Fatal(err)
+		}
+		sink, err := NewFileAuditSink(path, AuditMaxSize(200), AuditMaxBackups(1))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer sink.Close()
+
+		record := &AuditRecord{Command: strings.Repeat("x", 150)}
+		if err := sink.Audit(record); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := sink.Audit(record); err == nil || !strings.Contains(err.Error(), "failed to rotate audit log") {
+			t.Errorf("Expected rotation error, but got %v", err)
+		}
+		if err := sink.Audit(record); err == nil || errors.Is(err, os.ErrClosed) {
+			t.Errorf("Expected the sink to stay open and report the rotation error, but got %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Count(string(data), "\n"); lines != 3 {
+			t.Errorf("Expected all 3 records in the current audit log, but got %d", lines)
+		}
+	})
+}
@@ -0,0 +1,359 @@
+// Command go-execute runs commands and scripts from the shell with the same semantics as the go-execute library.
+//
+// Usage:
+//
+//	go-execute run [flags] <command>
+//	go-execute script [flags] -type <type> <file|-> [arguments...]
+//	go-execute tasks [flags] <file>
+//
+// Output is streamed as it is written unless -json is set, in which case the result, including the exit code,
+// duration and output, is written as a JSON object once the command has finished. go-execute exits with the exit
+// code of the command, 124 when the timeout expired and 1 when the command couldn't be executed. The tasks subcommand
+// runs a task file, see package executetaskfile, and exits with 1 when a task failed.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+const (
+	exitFailure = 1
+	exitTimeout = 124
+	exitUsage   = 2
+)
+
+const usage = `Usage:
+  go-execute run [flags] <command>
+  go-execute script [flags] -type <type> <file|-> [arguments...]
+  go-execute tasks [flags] <file>
+
+Run "go-execute <subcommand> -h" for the flags of a subcommand.
+`
+
+func main() {
+	// An interrupt from the terminal also reaches the command, which is waited for so its result is still reported
+	signal.Notify(make(chan os.Signal, 1), os.Interrupt)
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the subcommand and returns the exit code of go-execute.
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "run":
+		return runCommand(args[1:], stdout, stderr)
+	case "script":
+		return runScript(args[1:], stdin, stdout, stderr)
+	case "tasks":
+		return runTasks(args[1:], stdout, stderr)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+	fmt.Fprintf(stderr, "unknown subcommand %q\n\n%s", args[0], usage)
+	return exitUsage
+}
+
+// runCommand implements the run subcommand.
+func runCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var opts options
+	opts.register(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: go-execute run [flags] <command>\n\nA single argument is the command line. Several arguments are the command and its arguments, which are quoted for the shell.\n\nFlags:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	command, err := opts.command(flags.Args())
+	if err != nil {
+		fmt.Fprintf(stderr, "go-execute: %v\n", err)
+		return exitUsage
+	}
+
+	executor, results, err := opts.executor()
+	if err != nil {
+		fmt.Fprintf(stderr, "go-execute: %v\n", err)
+		return exitFailure
+	}
+	defer executor.Close()
+
+	var execResult *execute.ExecutionResult
+	if len(flags.Args()) > 1 && opts.shell == "" {
+		// Without a shell the arguments are passed to the command unchanged, which executors returned by NewExecutor
+		// support through execute.SpecExecutor
+		execResult, err = executor.(execute.SpecExecutor).ExecuteSpecAsync(context.Background(), opts.spec(command, flags.Args()))
+	} else {
+		execResult, err = executor.ExecuteAsyncWithTimeout(command, opts.timeout)
+	}
+	if err != nil {
+		return report(stdout, stderr, command, results, "", "", err, opts.json)
+	}
+	if opts.json {
+		var out, errOut strings.Builder
+		newOutputWriter(&out, &errOut, false).stream(execResult.Stdout, execResult.Stderr)
+		return report(stdout, stderr, command, results, out.String(), errOut.String(), <-execResult.Finished, true)
+	}
+	newOutputWriter(stdout, stderr, opts.prefix).stream(execResult.Stdout, execResult.Stderr)
+	return report(stdout, stderr, command, results, "", "", <-execResult.Finished, false)
+}
+
+// runScript implements the script subcommand.
+func runScript(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("script", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var opts options
+	opts.register(flags)
+	scriptType := flags.String("type", "", "script type, e.g. bash, python or powershell (required)")
+	var params keyValues
+	flags.Var(&params, "param", "named script `parameter` as name=value, may be repeated")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: go-execute script [flags] -type <type> <file|-> [arguments...]\n\nThe script is read from stdin when the file is -.\n\nFlags:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 || *scriptType == "" {
+		flags.Usage()
+		return exitUsage
+	}
+	path, arguments := flags.Arg(0), flags.Args()[1:]
+	parameters, err := params.Map()
+	if err != nil {
+		fmt.Fprintf(stderr, "go-execute: %v\n", err)
+		return exitUsage
+	}
+
+	executor, results, err := opts.executor()
+	if err != nil {
+		fmt.Fprintf(stderr, "go-execute: %v\n", err)
+		return exitFailure
+	}
+	defer executor.Close()
+
+	var out, errOut string
+	if path == "-" {
+		script, readErr := io.ReadAll(stdin)
+		if readErr != nil {
+			fmt.Fprintf(stderr, "go-execute: failed to read script: %v\n", readErr)
+			return exitFailure
+		}
+		out, errOut, err = executor.ExecuteScriptFromStringWithTimeout(execute.ScriptType(*scriptType), string(script), arguments, parameters, opts.timeout)
+	} else {
+		out, errOut, err = executor.ExecuteScriptFromFileWithTimeout(execute.ScriptType(*scriptType), path, arguments, parameters, opts.timeout)
+	}
+	if !opts.json {
+		// Scripts only return their output once they have finished
+		newOutputWriter(stdout, stderr, opts.prefix).stream(strings.NewReader(out), strings.NewReader(errOut))
+	}
+	return report(stdout, stderr, path, results, out, errOut, err, opts.json)
+}
+
+// report writes the result of the command as JSON when requested, or the error otherwise, and returns the exit code
+// of go-execute.
+func report(stdout io.Writer, stderr io.Writer, command string, results <-chan *execute.Result, out string, errOut string, err error, asJSON bool) int {
+	var result *execute.Result
+	if errors.Is(err, context.DeadlineExceeded) {
+		// The executor stops waiting once the timeout expires while the command may still be exiting gracefully
+		result = <-results
+	} else {
+		select {
+		case result = <-results:
+		default:
+		}
+	}
+
+	code := exitCode(result, err)
+	if asJSON {
+		if werr := writeJSON(stdout, newJSONResult(command, result, out, errOut, err)); werr != nil {
+			fmt.Fprintf(stderr, "go-execute: %v\n", werr)
+			return exitFailure
+		}
+		return code
+	}
+	if err != nil && (result == nil || result.ExitCode <= 0) {
+		fmt.Fprintf(stderr, "go-execute: %v\n", err)
+	}
+	return code
+}
+
+// exitCode returns the exit code of go-execute for the result of the command.
+func exitCode(result *execute.Result, err error) int {
+	switch {
+	case result != nil && result.TimedOut, errors.Is(err, context.DeadlineExceeded):
+		return exitTimeout
+	case result != nil && result.ExitCode > 0:
+		return result.ExitCode
+	case err != nil:
+		return exitFailure
+	}
+	return 0
+}
+
+// command returns the command line of the arguments of the run subcommand. A single argument is the command line,
+// while several arguments are quoted so they reach the command unchanged.
+func (o *options) command(args []string) (string, error) {
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	if o.shell == "" && args[0] == "sudo" && (o.sudoPasswordFile != "" || o.sudoPasswordEnv != "") {
+		return "", errors.New("sudo with a password requires -shell or the command as a single argument")
+	}
+	words := make([]string, len(args))
+	for i, arg := range args {
+		word, err := execute.QuoteShell(arg)
+		if err != nil {
+			return "", fmt.Errorf("invalid argument %q: %w", arg, err)
+		}
+		words[i] = word
+	}
+	return strings.Join(words, " "), nil
+}
+
+// spec returns the spec that executes the arguments of the run subcommand without a shell.
+func (o *options) spec(command string, args []string) *execute.CommandSpec {
+	return &execute.CommandSpec{Command: command, Path: args[0], Args: args[1:], ExtraEnv: o.env, Dir: o.dir, Timeout: o.timeout}
+}
+
+// options are the flags shared by all subcommands.
+type options struct {
+	timeout          time.Duration
+	grace            time.Duration
+	user             string
+	shell            string
+	dir              string
+	env              keyValues
+	sudoPasswordFile string
+	sudoPasswordEnv  string
+	json             bool
+	prefix           bool
+}
+
+// register adds the flags to the flag set.
+func (o *options) register(flags *flag.FlagSet) {
+	flags.DurationVar(&o.timeout, "timeout", 0, "kill the command after the `duration`, 0 disables the timeout")
+	flags.DurationVar(&o.grace, "grace", 5*time.Second, "`duration` the command is given to exit after SIGTERM when the timeout expires before it is killed")
+	flags.StringVar(&o.user, "user", "", "run the command as the `user`")
+	flags.StringVar(&o.shell, "shell", "", "run the command through the `shell`, e.g. /bin/sh")
+	flags.StringVar(&o.dir, "dir", "", "working `directory` of the command")
+	flags.Var(&o.env, "env", "environment `variable` as NAME=value added to the inherited environment, may be repeated")
+	flags.StringVar(&o.sudoPasswordFile, "sudo-password-file", "", "read the sudo password from the `file`")
+	flags.StringVar(&o.sudoPasswordEnv, "sudo-password-env", "", "read the sudo password from the environment `variable`, which is removed before commands are started")
+	flags.BoolVar(&o.json, "json", false, "write the result, including the output, as JSON once the command has finished")
+	flags.BoolVar(&o.prefix, "prefix", false, "prefix every line of output with the stream it was written to")
+}
+
+// executor returns the executor configured by the options and the channel its results are reported on.
+func (o *options) executor() (execute.Executor, <-chan *execute.Result, error) {
+	// The password is removed from the environment before the environment is copied for the command
+	password, err := o.sudoPassword()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := make(chan *execute.Result, 1)
+	opts := []execute.Option{
+		execute.WithGracePeriod(o.grace),
+		execute.WithHooks(execute.Hooks{
+			OnExit: func(spec *execute.CommandSpec, result *execute.Result) {
+				select {
+				case results <- result:
+				default:
+				}
+			},
+		}),
+	}
+	if len(o.env) > 0 {
+		opts = append(opts, execute.WithEnvironment(append(os.Environ(), o.env...)))
+	}
+	if o.user != "" {
+		opts = append(opts, execute.WithUser(o.user))
+	}
+	if o.shell != "" {
+		opts = append(opts, execute.WithShell(o.shell))
+	}
+	if o.dir != "" {
+		opts = append(opts, execute.WithWorkingDir(o.dir))
+	}
+	if password != "" {
+		opts = append(opts, execute.WithSudoCredentials(password))
+	}
+	return execute.NewExecutor(opts...), results, nil
+}
+
+// sudoPassword returns the sudo password from the file or environment variable. The variable is removed from the
+// environment once it has been read so commands don't inherit the password.
+func (o *options) sudoPassword() (string, error) {
+	switch {
+	case o.sudoPasswordFile != "" && o.sudoPasswordEnv != "":
+		return "", errors.New("-sudo-password-file and -sudo-password-env are mutually exclusive")
+	case o.sudoPasswordFile != "":
+		data, err := os.ReadFile(o.sudoPasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read sudo password: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case o.sudoPasswordEnv != "":
+		password, ok := os.LookupEnv(o.sudoPasswordEnv)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", o.sudoPasswordEnv)
+		}
+		if err := os.Unsetenv(o.sudoPasswordEnv); err != nil {
+			return "", fmt.Errorf("failed to remove %s from the environment: %w", o.sudoPasswordEnv, err)
+		}
+		return password, nil
+	}
+	return "", nil
+}
+
+// keyValues is a repeatable flag of name=value pairs.
+type keyValues []string
+
+func (kv *keyValues) String() string {
+	return strings.Join(*kv, ",")
+}
+
+func (kv *keyValues) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("expected name=value, got %q", value)
+	}
+	*kv = append(*kv, value)
+	return nil
+}
+
+// Map returns the pairs as a map.
+func (kv keyValues) Map() (map[string]string, error) {
+	if len(kv) == 0 {
+		return nil, nil
+	}
+	m := make(map[string]string, len(kv))
+	for _, pair := range kv {
+		name, value, _ := strings.Cut(pair, "=")
+		if _, ok := m[name]; ok {
+			return nil, fmt.Errorf("duplicate parameter %q", name)
+		}
+		m[name] = value
+	}
+	return m, nil
+}
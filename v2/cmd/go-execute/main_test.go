@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func runCLI(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRunExitCode(t *testing.T) {
+	code, stdout, stderr := runCLI(t, "", "run", "-shell", "/bin/sh", "echo out; echo err >&2; exit 3")
+	if code != 3 {
+		t.Errorf("expected exit code 3, got %d", code)
+	}
+	if stdout != "out\n" || stderr != "err\n" {
+		t.Errorf("unexpected output %q, %q", stdout, stderr)
+	}
+}
+
+func TestRunPrefix(t *testing.T) {
+	code, stdout, _ := runCLI(t, "", "run", "-prefix", "-shell", "/bin/sh", "echo out; printf err >&2")
+	if code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 2 || !contains(lines, "[stdout] out") || !contains(lines, "[stderr] err") {
+		t.Errorf("unexpected output %q", stdout)
+	}
+}
+
+func TestRunArguments(t *testing.T) {
+	dir := t.TempDir()
+	if code, _, stderr := runCLI(t, "", "run", "-dir", dir, "touch", "a b"); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+	if code, _, stderr := runCLI(t, "", "run", "-dir", dir, "-shell", "/bin/sh", "touch", "c d", "it's"); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, ",") != "a b,c d,it's" {
+		t.Errorf("expected the arguments to be passed unchanged, got %q", names)
+	}
+
+	code, stdout, _ := runCLI(t, "", "run", "-env", "GREETING=hello world", "printenv", "GREETING")
+	if code != 0 || stdout != "hello world\n" {
+		t.Errorf("unexpected result %d, %q", code, stdout)
+	}
+}
+
+func TestRunJSON(t *testing.T) {
+	code, stdout, _ := runCLI(t, "", "run", "-json", "-env", "GREETING=hello", "-shell", "/bin/sh", `echo "$GREETING"; exit 2`)
+	if code != 2 {
+		t.Errorf("expected exit code 2, got %d", code)
+	}
+	var result jsonResult
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout, err)
+	}
+	if result.ExitCode != 2 || result.Stdout != "hello\n" || result.Error == "" || result.StartTime.IsZero() {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	code, stdout, _ := runCLI(t, "", "run", "-json", "-timeout", "200ms", "-grace", "2s", "-shell", "/bin/sh",
+		`trap 'echo stopping; kill $!; exit 0' TERM; sleep 10 & wait`)
+	if code != exitTimeout {
+		t.Errorf("expected exit code %d, got %d", exitTimeout, code)
+	}
+	var result jsonResult
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout, err)
+	}
+	if !result.TimedOut || result.Stdout != "stopping\n" {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+	code, stdout, stderr := runCLI(t, `echo "$1"`, "script", "-type", "bash", "-", "from-stdin")
+	if code != 0 || stdout != "from-stdin\n" {
+		t.Errorf("unexpected result %d, %q, %q", code, stdout, stderr)
+	}
+
+	script := filepath.Join(t.TempDir(), "script.sh")
+	os.WriteFile(script, []byte("echo file; exit 4\n"), 0600)
+	code, stdout, _ = runCLI(t, "", "script", "-type", "bash", "-prefix", script)
+	if code != 4 || stdout != "[stdout] file\n" {
+		t.Errorf("unexpected result %d, %q", code, stdout)
+	}
+}
+
+func TestRunSudoPassword(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "password")
+	os.WriteFile(file, []byte("secret\n"), 0600)
+	t.Setenv("SUDO_PASSWORD", "secret")
+
+	opts := options{sudoPasswordFile: file}
+	if password, err := opts.sudoPassword(); err != nil || password != "secret" {
+		t.Errorf("unexpected password %q, %v", password, err)
+	}
+	opts = options{sudoPasswordEnv: "SUDO_PASSWORD"}
+	if password, err := opts.sudoPassword(); err != nil || password != "secret" {
+		t.Errorf("unexpected password %q, %v", password, err)
+	}
+	if _, ok := os.LookupEnv("SUDO_PASSWORD"); ok {
+		t.Error("expected the password to be removed from the environment")
+	}
+	opts = options{sudoPasswordFile: file, sudoPasswordEnv: "SUDO_PASSWORD"}
+	if _, err := opts.sudoPassword(); err == nil {
+		t.Error("expected an error for both sources")
+	}
+
+	t.Setenv("SUDO_PASSWORD", "secret")
+	code, stdout, _ := runCLI(t, "", "run", "-sudo-password-env", "SUDO_PASSWORD", "env")
+	if code != 0 || strings.Contains(stdout, "secret") {
+		t.Errorf("expected the password not to be inherited, got %d, %q", code, stdout)
+	}
+
+	// The environment passed with -env is built on top of the environment without the password
+	t.Setenv("SUDO_PASSWORD", "secret")
+	code, stdout, _ = runCLI(t, "", "run", "-env", "GREETING=hello", "-sudo-password-env", "SUDO_PASSWORD", "env")
+	if code != 0 || strings.Contains(stdout, "secret") || !strings.Contains(stdout, "GREETING=hello") {
+		t.Errorf("expected the password not to be inherited with -env, got %d, %q", code, stdout)
+	}
+}
+
+func TestRunTasks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.yml")
+	taskfile := "version: 1\nshell: /bin/sh\ntasks:\n  - {name: ok, command: echo ok}\n  - {name: broken, command: echo bad >&2; exit 5, depends_on: [ok]}\n"
+	if err := os.WriteFile(path, []byte(taskfile), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, _ := runCLI(t, "", "tasks", path)
+	if code != exitFailure {
+		t.Errorf("expected exit code %d, got %d", exitFailure, code)
+	}
+	if !strings.Contains(stdout, "succeeded ok") || !strings.Contains(stdout, "failed    broken") || !strings.Contains(stdout, "| bad") {
+		t.Errorf("unexpected output %q", stdout)
+	}
+
+	code, stdout, _ = runCLI(t, "", "tasks", "-json", path)
+	if code != exitFailure {
+		t.Errorf("expected exit code %d, got %d", exitFailure, code)
+	}
+	var report jsonReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout, err)
+	}
+	if report.Succeeded || len(report.Tasks) != 2 || report.Tasks[0].Stdout != "ok\n" || report.Tasks[1].ExitCode != 5 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	if code, _, _ := runCLI(t, "", "tasks", "-validate", path); code != 0 {
+		t.Errorf("expected exit code 0 for a valid file, got %d", code)
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	for _, args := range [][]string{nil, {"unknown"}, {"run"}, {"script", "file.sh"}, {"run", "-bogus", "true"}, {"tasks", "missing.yml"}} {
+		if code, _, _ := runCLI(t, "", args...); code != exitUsage {
+			t.Errorf("%v: expected exit code %d, got %d", args, exitUsage, code)
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
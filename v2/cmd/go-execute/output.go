@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+// outputWriter copies the output of a command to the output of go-execute.
+type outputWriter struct {
+	mu     sync.Mutex
+	stdout io.Writer
+	stderr io.Writer
+	prefix bool
+}
+
+// newOutputWriter returns an outputWriter. With prefix set, both streams are written line by line to stdout with the
+// name of the stream they were written to as the prefix.
+func newOutputWriter(stdout io.Writer, stderr io.Writer, prefix bool) *outputWriter {
+	return &outputWriter{stdout: stdout, stderr: stderr, prefix: prefix}
+}
+
+// stream copies both streams until they are closed.
+func (w *outputWriter) stream(stdout io.Reader, stderr io.Reader) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go w.copy(&wg, "stdout", stdout, w.stdout)
+	go w.copy(&wg, "stderr", stderr, w.stderr)
+	wg.Wait()
+}
+
+// copy copies a single stream.
+func (w *outputWriter) copy(wg *sync.WaitGroup, name string, r io.Reader, dst io.Writer) {
+	defer wg.Done()
+	if !w.prefix {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				w.write(dst, buf[:n])
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if line[len(line)-1] != '\n' {
+				line += "\n"
+			}
+			w.write(w.stdout, []byte("["+name+"] "+line))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// write writes the data without interleaving it with the other stream.
+func (w *outputWriter) write(dst io.Writer, data []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	dst.Write(data)
+}
+
+// jsonResult is the result written by -json.
+type jsonResult struct {
+	Command    string    `json:"command"`
+	ExitCode   int       `json:"exit_code"`
+	StartTime  time.Time `json:"start_time,omitempty"`
+	EndTime    time.Time `json:"end_time,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	TimedOut   bool      `json:"timed_out,omitempty"`
+	Stdout     string    `json:"stdout"`
+	Stderr     string    `json:"stderr"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// newJSONResult returns the JSON result of the command. The result is nil when the command didn't start.
+func newJSONResult(command string, result *execute.Result, stdout string, stderr string, err error) *jsonResult {
+	r := &jsonResult{Command: command, ExitCode: -1, Stdout: stdout, Stderr: stderr}
+	if result != nil {
+		r.ExitCode = result.ExitCode
+		r.StartTime = result.StartTime
+		r.EndTime = result.EndTime
+		r.DurationMS = result.Duration().Milliseconds()
+		r.TimedOut = result.TimedOut
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// writeJSON writes the value as indented JSON.
+func writeJSON(w io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+	"github.com/bgrewell/go-execute/v2/executegraph"
+	"github.com/bgrewell/go-execute/v2/executetaskfile"
+)
+
+// runTasks implements the tasks subcommand.
+func runTasks(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("tasks", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var opts options
+	flags.DurationVar(&opts.grace, "grace", 5*time.Second, "`duration` a task is given to exit after SIGTERM when it is stopped before it is killed")
+	flags.StringVar(&opts.sudoPasswordFile, "sudo-password-file", "", "read the sudo password from the `file`")
+	flags.StringVar(&opts.sudoPasswordEnv, "sudo-password-env", "", "read the sudo password from the environment `variable`, which is removed before commands are started")
+	flags.BoolVar(&opts.json, "json", false, "write the report of the run, including the output of every task, as JSON")
+	validate := flags.Bool("validate", false, "only validate the task file")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: go-execute tasks [flags] <file>\n\nRuns the tasks of a YAML or JSON task file.\n\nFlags:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	file, err := executetaskfile.Load(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "go-execute: %v\n", err)
+		return exitUsage
+	}
+	if *validate {
+		return 0
+	}
+
+	executorOptions := []execute.Option{execute.WithGracePeriod(opts.grace)}
+	password, err := opts.sudoPassword()
+	if err != nil {
+		fmt.Fprintf(stderr, "go-execute: %v\n", err)
+		return exitFailure
+	}
+	if password != "" {
+		executorOptions = append(executorOptions, execute.WithSudoCredentials(password))
+	}
+	graph, err := file.Graph(executorOptions...)
+	if err != nil {
+		fmt.Fprintf(stderr, "go-execute: %v\n", err)
+		return exitUsage
+	}
+	defer func() {
+		for _, task := range graph.Tasks() {
+			task.Executor.Close()
+		}
+	}()
+
+	runOptions := file.RunOptions()
+	if !opts.json {
+		runOptions = append(runOptions, executegraph.WithTaskHandler(func(result *executegraph.TaskResult) {
+			writeTaskResult(stdout, result)
+		}))
+	}
+	report, err := graph.Run(context.Background(), nil, runOptions...)
+	if opts.json {
+		if werr := writeJSON(stdout, newJSONReport(report)); werr != nil {
+			fmt.Fprintf(stderr, "go-execute: %v\n", werr)
+			return exitFailure
+		}
+	}
+	if err != nil {
+		if !opts.json {
+			fmt.Fprintf(stderr, "go-execute: %v\n", err)
+		}
+		return exitFailure
+	}
+	return 0
+}
+
+// writeTaskResult writes a line with the state of the task, followed by its error and stderr if it failed.
+func writeTaskResult(w io.Writer, result *executegraph.TaskResult) {
+	switch result.State {
+	case executegraph.TaskSkipped:
+		fmt.Fprintf(w, "%-9s %s (dependency %s didn't succeed)\n", result.State, result.Name, result.SkippedBecause)
+	case executegraph.TaskFailed:
+		fmt.Fprintf(w, "%-9s %s after %s and %d attempt(s): %v\n", result.State, result.Name, result.Duration().Round(time.Millisecond), result.Attempts, result.Err)
+		if output := strings.TrimRight(result.Stderr, "\n"); output != "" {
+			for _, line := range strings.Split(output, "\n") {
+				fmt.Fprintf(w, "          | %s\n", line)
+			}
+		}
+	default:
+		fmt.Fprintf(w, "%-9s %s (%s)\n", result.State, result.Name, result.Duration().Round(time.Millisecond))
+	}
+}
+
+// jsonReport is the report written by tasks -json.
+type jsonReport struct {
+	Succeeded  bool       `json:"succeeded"`
+	DurationMS int64      `json:"duration_ms"`
+	Tasks      []jsonTask `json:"tasks"`
+}
+
+// jsonTask is the result of a task in a jsonReport.
+type jsonTask struct {
+	Name           string                 `json:"name"`
+	State          executegraph.TaskState `json:"state"`
+	ExitCode       int                    `json:"exit_code"`
+	Attempts       int                    `json:"attempts,omitempty"`
+	DurationMS     int64                  `json:"duration_ms"`
+	Stdout         string                 `json:"stdout"`
+	Stderr         string                 `json:"stderr"`
+	Error          string                 `json:"error,omitempty"`
+	SkippedBecause string                 `json:"skipped_because,omitempty"`
+}
+
+// newJSONReport returns the JSON report of the run.
+func newJSONReport(report *executegraph.Report) *jsonReport {
+	r := &jsonReport{
+		Succeeded:  report.Succeeded(),
+		DurationMS: report.EndTime.Sub(report.StartTime).Milliseconds(),
+		Tasks:      make([]jsonTask, len(report.Tasks)),
+	}
+	for i, task := range report.Tasks {
+		r.Tasks[i] = jsonTask{
+			Name:           task.Name,
+			State:          task.State,
+			ExitCode:       task.ExitCode,
+			Attempts:       task.Attempts,
+			DurationMS:     task.Duration().Milliseconds(),
+			Stdout:         task.Stdout,
+			Stderr:         task.Stderr,
+			SkippedBecause: task.SkippedBecause,
+		}
+		if task.Err != nil {
+			r.Tasks[i].Error = task.Err.Error()
+		}
+	}
+	return r
+}
@@ -0,0 +1,131 @@
+package execute
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DryRunResult is the synthetic result returned for every command while the executor is in dry-run mode.
+type DryRunResult struct {
+	Stdout string
+	Stderr string
+	Err    error
+}
+
+// Plan collects the commands that would have been executed by an executor in dry-run mode.
+type Plan struct {
+	mu    sync.Mutex
+	steps []*CommandSpec
+}
+
+// Steps returns the redacted specs of the collected commands in the order they would have been executed.
+func (p *Plan) Steps() []*CommandSpec {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*CommandSpec(nil), p.steps...)
+}
+
+// Reset removes all collected commands from the plan.
+func (p *Plan) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.steps = nil
+}
+
+// String returns the plan with one command line per step.
+func (p *Plan) String() string {
+	var b strings.Builder
+	for _, step := range p.Steps() {
+		b.WriteString(step.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// MarshalJSON returns the steps of the plan as a JSON array.
+func (p *Plan) MarshalJSON() ([]byte, error) {
+	steps := p.Steps()
+	if steps == nil {
+		steps = []*CommandSpec{}
+	}
+	return json.Marshal(steps)
+}
+
+// add appends the spec to the plan.
+func (p *Plan) add(spec *CommandSpec) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.steps = append(p.steps, spec)
+}
+
+// SetDryRun sets whether the executor only resolves and records commands instead of executing them.
+func (e *BaseExecutor) SetDryRun(enabled bool) {
+	e.dryRun = enabled
+	if enabled && e.plan == nil {
+		e.plan = &Plan{}
+	}
+}
+
+// DryRun returns whether the executor is in dry-run mode.
+func (e *BaseExecutor) DryRun() bool {
+	return e.dryRun
+}
+
+// SetDryRunResult sets the synthetic result returned for commands while the executor is in dry-run mode.
+func (e *BaseExecutor) SetDryRunResult(result DryRunResult) {
+	e.dryRunResult = result
+}
+
+// Plan returns the commands collected while the executor was in dry-run mode, or nil if dry-run mode was never
+// enabled.
+func (e *BaseExecutor) Plan() *Plan {
+	return e.plan
+}
+
+// dryRunExecution records the spec in the plan and returns the synthetic execution and its result.
+func (e *BaseExecutor) dryRunExecution(spec *CommandSpec) (*ExecutionResult, *Result) {
+	redacted := spec.Redacted()
+	if e.plan == nil {
+		e.plan = &Plan{}
+	}
+	e.plan.add(redacted)
+	e.log().Info("dry run", "argv", redacted.Argv(), "env", redacted.Env, "dir", redacted.Dir, "user", redacted.User)
+
+	result := newResult(spec, time.Now(), nil, e.dryRunResult.Err)
+	result.DryRun = true
+	result.StdoutBytes, result.StdoutSHA256 = int64(len(e.dryRunResult.Stdout)), sha256Hex(e.dryRunResult.Stdout)
+	result.StderrBytes, result.StderrSHA256 = int64(len(e.dryRunResult.Stderr)), sha256Hex(e.dryRunResult.Stderr)
+
+	if stdout := e.dryRunResult.Stdout; stdout != "" {
+		spec.outputFunc("stdout")([]byte(stdout))
+	}
+	if stderr := e.dryRunResult.Stderr; stderr != "" {
+		spec.outputFunc("stderr")([]byte(stderr))
+	}
+
+	finished := make(chan error, 1)
+	finished <- e.dryRunResult.Err
+	close(finished)
+
+	return &ExecutionResult{
+		Stdout:   io.NopCloser(strings.NewReader(e.dryRunResult.Stdout)),
+		Stderr:   io.NopCloser(strings.NewReader(e.dryRunResult.Stderr)),
+		Finished: finished,
+		Ctx:      context.Background(),
+	}, result
+}
+
+// sha256Hex returns the hex encoded SHA-256 hash of the value.
+func sha256Hex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,128 @@
+package execute
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+
+	t.Run("DryRun_DoesNotExecute", func(t *testing.T) {
+		marker := filepath.Join(t.TempDir(), "marker")
+		executor := NewExecutor(WithDryRun(), WithDryRunResult(DryRunResult{Stdout: "synthetic\n"}))
+
+		stdout, stderr, err := executor.ExecuteSeparate("touch " + marker)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if stdout != "synthetic\n" || stderr != "" {
+			t.Errorf("Expected synthetic output, but got stdout '%s' and stderr '%s'", stdout, stderr)
+		}
+		if _, err := os.Stat(marker); !os.IsNotExist(err) {
+			t.Errorf("Expected the command to not be executed")
+		}
+
+		steps := executor.Plan().Steps()
+		if len(steps) != 1 {
+			t.Fatalf("Expected 1 step, but got %d", len(steps))
+		}
+		if filepath.Base(steps[0].Path) != "touch" {
+			t.Errorf("Expected the touch binary to be resolved, but got %s", steps[0].Path)
+		}
+		if len(steps[0].Args) != 1 || steps[0].Args[0] != marker {
+			t.Errorf("Expected args [%s], but got %v", marker, steps[0].Args)
+		}
+	})
+
+	t.Run("DryRun_WithSyntheticError", func(t *testing.T) {
+		expected := errors.New("synthetic failure")
+		executor := NewExecutor(WithDryRun(), WithDryRunResult(DryRunResult{Err: expected}))
+
+		if _, err := executor.Execute("true"); !errors.Is(err, expected) {
+			t.Errorf("Expected error %v, but got %v", expected, err)
+		}
+	})
+
+	t.Run("DryRun_WithUnknownBinary", func(t *testing.T) {
+		executor := NewExecutor(WithDryRun())
+
+		if _, err := executor.Execute("go-execute-does-not-exist"); err == nil {
+			t.Errorf("Expected error for unknown binary, but got nil")
+		}
+		if len(executor.Plan().Steps()) != 0 {
+			t.Errorf("Expected no steps to be recorded")
+		}
+	})
+
+	t.Run("DryRun_RedactsSudoPassword", func(t *testing.T) {
+		executor := NewExecutor(WithDryRun(), WithShell("/bin/sh"), WithSudoCredentials("hunter2"))
+
+		if _, err := executor.Execute("sudo id"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		plan := executor.Plan().String()
+		if strings.Contains(plan, "hunter2") {
+			t.Errorf("Expected the sudo password to be redacted, but got %s", plan)
+		}
+		if !strings.Contains(plan, "sudo -S id") {
+			t.Errorf("Expected the sudo wrapping to be applied, but got %s", plan)
+		}
+	})
+
+	t.Run("DryRun_WithScript", func(t *testing.T) {
+		executor := NewExecutor(WithDryRun(), WithScriptDir(t.TempDir()))
+
+		_, _, err := executor.ExecuteScriptFromString(ScriptTypeBash, "echo hello", []string{"arg"}, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		steps := executor.Plan().Steps()
+		if len(steps) != 1 {
+			t.Fatalf("Expected 1 step, but got %d", len(steps))
+		}
+		if steps[0].ScriptType != ScriptTypeBash || len(steps[0].ScriptSHA256) != 64 {
+			t.Errorf("Expected the script type and hash to be recorded, but got %+v", steps[0])
+		}
+	})
+
+	t.Run("Plan_MarshalJSON", func(t *testing.T) {
+		executor := NewExecutor(WithDryRun(), WithWorkingDir("/tmp"))
+		if _, err := executor.Execute("echo hello"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		data, err := json.Marshal(executor.Plan())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var steps []CommandSpec
+		if err := json.Unmarshal(data, &steps); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(steps) != 1 || steps[0].Dir != "/tmp" || strings.Join(steps[0].Args, " ") != "hello" {
+			t.Errorf("Unexpected plan: %s", data)
+		}
+
+		executor.Plan().Reset()
+		if len(executor.Plan().Steps()) != 0 {
+			t.Errorf("Expected the plan to be empty after reset")
+		}
+	})
+}
+
+func TestCommandSpecString(t *testing.T) {
+	spec := &CommandSpec{Path: "/bin/sh", Args: []string{"-c", "echo 'secret' | sudo -S id"}, secrets: []string{"secret"}}
+
+	expected := `'/bin/sh' '-c' 'echo '\''******'\'' | sudo -S id'`
+	if spec.String() != expected {
+		t.Errorf("Expected %s, but got %s", expected, spec.String())
+	}
+}
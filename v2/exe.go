@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/awnumar/memguard"
@@ -43,22 +46,167 @@ type Executor interface {
 	Close()
 }
 
+// ConfigurableExecutor is implemented by executors whose configuration beyond the basics of Executor can be read and
+// changed after they were created, such as the executors returned by NewExecutor. It is separate from Executor so
+// existing implementations of Executor don't break; check for it with a type assertion. The options configuring these
+// settings are ignored by executors that don't implement it.
+type ConfigurableExecutor interface {
+	Executor
+	SetScriptDir(dir string)
+	ScriptDir() string
+	SetInMemoryScripts(enabled bool)
+	InMemoryScripts() bool
+	SetDryRun(enabled bool)
+	DryRun() bool
+	SetDryRunResult(result DryRunResult)
+	Plan() *Plan
+	SetAuditSink(sink AuditSink)
+	AuditSink() AuditSink
+	SetSensitiveEnv(names []string)
+	SensitiveEnv() []string
+	AddMiddleware(middleware ...Middleware)
+	AddHooks(hooks Hooks)
+	SetLogger(logger Logger)
+	Logger() Logger
+	SetOutputLogging(stdout LogLevel, stderr LogLevel)
+	OutputLogging() (stdout LogLevel, stderr LogLevel)
+	SetTransport(transport Transport)
+	Transport() Transport
+	SetGracePeriod(period time.Duration)
+	GracePeriod() time.Duration
+	SetRetryPolicy(policy *RetryPolicy)
+	RetryPolicy() *RetryPolicy
+}
+
+// ContextScriptExecutor is implemented by executors which can kill a script when a context is done, such as the
+// executors returned by NewExecutor. It is separate from Executor so existing implementations of Executor don't break;
+// check for it with a type assertion.
+type ContextScriptExecutor interface {
+	ExecuteScriptFromStringWithContext(ctx context.Context, scriptType ScriptType, script string, arguments []string, parameters ScriptParameters) (stdout string, stderr string, err error)
+}
+
+// ContextExecutor is implemented by executors which can kill a command when a context is done, such as the executors
+// returned by NewExecutor. It is separate from Executor so existing implementations of Executor don't break; check for
+// it with a type assertion, or use Start which falls back to a timeout for other executors.
+type ContextExecutor interface {
+	ExecuteAsyncWithContext(ctx context.Context, command string) (result *ExecutionResult, err error)
+}
+
+// SpecExecutor is implemented by executors which can execute a command described by a CommandSpec, such as the
+// executors returned by NewExecutor. It is separate from Executor so existing implementations of Executor don't break;
+// check for it with a type assertion.
+type SpecExecutor interface {
+	ExecuteSpecAsync(ctx context.Context, spec *CommandSpec) (result *ExecutionResult, err error)
+}
+
+// TypedScriptExecutor is implemented by executors which can pass typed parameters to scripts, such as the executors
+// returned by NewExecutor. It is separate from Executor so existing implementations of Executor don't break; check for
+// it with a type assertion.
+type TypedScriptExecutor interface {
+	ExecuteScriptFromStringWithParameters(scriptType ScriptType, script string, arguments []string, parameters ScriptParameters, timeout time.Duration) (stdout string, stderr string, err error)
+	ExecuteScriptFromFileWithParameters(scriptType ScriptType, scriptPath string, arguments []string, parameters ScriptParameters, timeout time.Duration) (stdout string, stderr string, err error)
+}
+
+// FSScriptExecutor is implemented by executors which can execute a script from an fs.FS, such as the executors
+// returned by NewExecutor. It is separate from Executor so existing implementations of Executor don't break; check for
+// it with a type assertion.
+type FSScriptExecutor interface {
+	ExecuteScriptFromFS(fsys fs.FS, scriptPath string, scriptType ScriptType, arguments []string, parameters map[string]string) (stdout string, stderr string, err error)
+	ExecuteScriptFromFSWithTimeout(fsys fs.FS, scriptPath string, scriptType ScriptType, arguments []string, parameters map[string]string, timeout time.Duration) (stdout string, stderr string, err error)
+}
+
 // ExecutionResult holds the necessary structures for interaction with the process.
 type ExecutionResult struct {
 	Stdout   io.Reader
 	Stderr   io.Reader
 	Finished <-chan error
 	Ctx      context.Context
+
+	watcher *processWatch
+}
+
+// CopyOutput copies the output of the process to the writers until both streams are closed and returns the error the
+// process exited with. The output of a stream is discarded when its writer is nil.
+func (r *ExecutionResult) CopyOutput(stdout io.Writer, stderr io.Writer) error {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go copyStream(&wg, stdout, r.Stdout)
+	go copyStream(&wg, stderr, r.Stderr)
+	wg.Wait()
+	return <-r.Finished
+}
+
+// copyStream copies the stream to the writer, or discards it when the writer is nil.
+func copyStream(wg *sync.WaitGroup, w io.Writer, r io.Reader) {
+	defer wg.Done()
+	if w == nil {
+		w = io.Discard
+	}
+	io.Copy(w, r)
+}
+
+// Start executes the command asynchronously with the executor and kills it when the context is done. Executors which
+// don't implement ContextExecutor can't be stopped through the context, so the command is started with the deadline
+// of the context as its timeout instead, or without a timeout when the context has no deadline.
+func Start(ctx context.Context, executor Executor, command string) (*ExecutionResult, error) {
+	if e, ok := executor.(ContextExecutor); ok {
+		return e.ExecuteAsyncWithContext(ctx, command)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var timeout time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	return executor.ExecuteAsyncWithTimeout(command, timeout)
+}
+
+// Collect executes the command with the executor like Start and returns its output once it has exited. Unlike
+// ExecuteSeparate the output is also returned when the command fails. Use ExitCode to get the exit code from the
+// error.
+func Collect(ctx context.Context, executor Executor, command string) (stdout string, stderr string, err error) {
+	result, err := Start(ctx, executor, command)
+	if err != nil {
+		return "", "", err
+	}
+	var sout, serr strings.Builder
+	err = result.CopyOutput(&sout, &serr)
+	return sout.String(), serr.String(), err
 }
 
 // BaseExecutor is the base implementation of the Executor interface. It implements all the code that is shared between
 // the platform-specific executors.
 type BaseExecutor struct {
-	environment []string
-	user        string
-	shell       string
-	workingDir  string
-	sudoPass    *memguard.Enclave
+	environment     []string
+	user            string
+	shell           string
+	workingDir      string
+	sudoPass        *memguard.Enclave
+	scriptDir       string
+	inMemoryScripts bool
+	gracePeriod     time.Duration
+	retryPolicy     *RetryPolicy
+	dryRun          bool
+	dryRunResult    DryRunResult
+	plan            *Plan
+	auditSink       AuditSink
+	sensitiveEnv    []string
+	middleware      []Middleware
+	hooks           []Hooks
+	transport       Transport
+	logger          Logger
+	stdoutLogLevel  LogLevel
+	stderrLogLevel  LogLevel
+	platform        platform
+}
+
+// platform is implemented by the platform-specific executors to provide the functionality that differs between
+// operating systems.
+type platform interface {
+	configureUser(ctx context.Context, cancel context.CancelFunc, exe *exec.Cmd) error
+	grantScriptAccess(path string) error
+	stageScriptInMemory(script string) (file *os.File, path string, err error)
 }
 
 // SetEnvironment sets the environment for the executor.
@@ -117,6 +265,41 @@ func (e *BaseExecutor) SetSudoCredentials(password string) {
 	e.sudoPass = buffer.Seal()
 }
 
+// SetScriptDir sets the directory used to stage temporary script files. An empty directory uses the default
+// temporary directory of the system.
+func (e *BaseExecutor) SetScriptDir(dir string) {
+	e.scriptDir = dir
+}
+
+// ScriptDir returns the directory used to stage temporary script files.
+func (e *BaseExecutor) ScriptDir() string {
+	return e.scriptDir
+}
+
+// SetInMemoryScripts sets whether scripts passed as strings are executed from memory instead of being written to
+// disk. This is only supported on Linux, other platforms and interpreters that require the script extension, such as
+// PowerShell, fall back to staging the script on disk.
+func (e *BaseExecutor) SetInMemoryScripts(enabled bool) {
+	e.inMemoryScripts = enabled
+}
+
+// InMemoryScripts returns whether scripts passed as strings are executed from memory.
+func (e *BaseExecutor) InMemoryScripts() bool {
+	return e.inMemoryScripts
+}
+
+// SetGracePeriod sets how long a process is given to exit after it has been asked to stop when its timeout expires.
+// Processes are sent SIGTERM and only killed once the grace period has passed. Windows processes can't be asked to
+// stop and are always killed immediately. A period of 0 kills processes immediately.
+func (e *BaseExecutor) SetGracePeriod(period time.Duration) {
+	e.gracePeriod = period
+}
+
+// GracePeriod returns how long a process is given to exit after it has been asked to stop.
+func (e *BaseExecutor) GracePeriod() time.Duration {
+	return e.gracePeriod
+}
+
 // Close ensures secure cleanup of sensitive data
 func (e *BaseExecutor) Close() {
 	e.sudoPass = nil
@@ -139,12 +322,28 @@ func (e *BaseExecutor) ExecuteAsync(command string) (*ExecutionResult, error) {
 
 // ExecuteAsyncWithInput is the base implementation of the ExecuteAsyncWithInput function which executes a command asynchronously with input.
 func (e *BaseExecutor) ExecuteAsyncWithInput(command string, stdin io.ReadCloser) (*ExecutionResult, error) {
-	return e.executeAsync(command, stdin, 0, false)
+	return e.executeAsync(command, stdin, 0)
 }
 
 // ExecuteAsyncWithTimeout is the base implementation of the ExecuteAsyncWithTimeout function which executes a command asynchronously with a timeout.
 func (e *BaseExecutor) ExecuteAsyncWithTimeout(command string, timeout time.Duration) (*ExecutionResult, error) {
-	return e.executeAsync(command, nil, timeout, false)
+	return e.executeAsync(command, nil, timeout)
+}
+
+// ExecuteAsyncWithContext is the base implementation of the ExecuteAsyncWithContext function which executes a
+// command asynchronously and kills it when the context is done. A deadline of the context is treated as the timeout of
+// the command.
+func (e *BaseExecutor) ExecuteAsyncWithContext(ctx context.Context, command string) (*ExecutionResult, error) {
+	spec, err := e.commandSpec(command, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		spec.Timeout = time.Until(deadline)
+	}
+	spec.ctx = ctx
+
+	return e.run(spec)
 }
 
 // ExecuteWithTimeout is the base implementation of the ExecuteWithTimeout function which executes a command with a timeout.
@@ -155,7 +354,7 @@ func (e *BaseExecutor) ExecuteWithTimeout(command string, timeout time.Duration)
 
 // ExecuteSeparateWithTimeout is the base implementation of the ExecuteSeparateWithTimeout function which executes a command and returns the stdout and stderr separately with a timeout.
 func (e *BaseExecutor) ExecuteSeparateWithTimeout(command string, timeout time.Duration) (stdout string, stderr string, err error) {
-	sout, serr, err := e.execute(command, nil, timeout, false)
+	sout, serr, err := e.execute(command, nil, timeout)
 	if err != nil {
 		return "", "", err
 	}
@@ -179,13 +378,45 @@ func (e *BaseExecutor) ExecuteScriptFromString(scriptType ScriptType, script str
 
 // ExecuteScriptFromStringWithTimeout is the base implementation of the ExecuteScriptFromStringWithTimeout function which executes a script from a string with a timeout.
 func (e *BaseExecutor) ExecuteScriptFromStringWithTimeout(scriptType ScriptType, script string, arguments []string, parameters map[string]string, timeout time.Duration) (stdout string, stderr string, err error) {
-	tmpFile, err := e.writeTempScript(scriptType, script)
+	return e.ExecuteScriptFromStringWithParameters(scriptType, script, arguments, stringParameters(parameters), timeout)
+}
+
+// ExecuteScriptFromStringWithParameters is the base implementation of the ExecuteScriptFromStringWithParameters
+// function which executes a script from a string with typed parameters passed in order. A timeout of 0 disables the
+// timeout.
+func (e *BaseExecutor) ExecuteScriptFromStringWithParameters(scriptType ScriptType, script string, arguments []string, parameters ScriptParameters, timeout time.Duration) (stdout string, stderr string, err error) {
+	return e.executeScriptFromString(context.Background(), scriptType, script, arguments, parameters, timeout)
+}
+
+// ExecuteScriptFromStringWithContext is the base implementation of the ExecuteScriptFromStringWithContext function
+// which executes a script from a string with typed parameters passed in order and kills it when the context is done. A
+// deadline of the context is treated as the timeout of the script.
+func (e *BaseExecutor) ExecuteScriptFromStringWithContext(ctx context.Context, scriptType ScriptType, script string, arguments []string, parameters ScriptParameters) (stdout string, stderr string, err error) {
+	var timeout time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	return e.executeScriptFromString(ctx, scriptType, script, arguments, parameters, timeout)
+}
+
+// executeScriptFromString stages the script and executes it, killing it when the context is done.
+func (e *BaseExecutor) executeScriptFromString(ctx context.Context, scriptType ScriptType, script string, arguments []string, parameters ScriptParameters, timeout time.Duration) (stdout string, stderr string, err error) {
+	staged, err := e.stageScript(scriptType, script)
 	if err != nil {
 		return "", "", err
 	}
-	defer os.Remove(tmpFile)
-
-	return e.ExecuteScriptFromFileWithTimeout(scriptType, tmpFile, arguments, parameters, timeout)
+	defer staged.Close()
+
+	return e.executeScript(scriptRun{
+		ctx:        ctx,
+		scriptType: scriptType,
+		path:       staged.Path,
+		sha256:     staged.SHA256,
+		extraFiles: staged.extraFiles(),
+		arguments:  arguments,
+		parameters: parameters,
+		timeout:    timeout,
+	})
 }
 
 // ExecuteScriptFromFile is the base implementation of the ExecuteScriptFromFile function which executes a script from a file.
@@ -195,40 +426,128 @@ func (e *BaseExecutor) ExecuteScriptFromFile(scriptType ScriptType, scriptPath s
 
 // ExecuteScriptFromFileWithTimeout is the base implementation of the ExecuteScriptFromFileWithTimeout function which executes a script from a file with a timeout.
 func (e *BaseExecutor) ExecuteScriptFromFileWithTimeout(scriptType ScriptType, scriptPath string, arguments []string, parameters map[string]string, timeout time.Duration) (stdout string, stderr string, err error) {
-	return e.executeScript(scriptType, scriptPath, arguments, parameters, timeout)
+	return e.ExecuteScriptFromFileWithParameters(scriptType, scriptPath, arguments, stringParameters(parameters), timeout)
+}
+
+// ExecuteScriptFromFileWithParameters is the base implementation of the ExecuteScriptFromFileWithParameters function
+// which executes a script from a file with typed parameters passed in order. A timeout of 0 disables the timeout.
+func (e *BaseExecutor) ExecuteScriptFromFileWithParameters(scriptType ScriptType, scriptPath string, arguments []string, parameters ScriptParameters, timeout time.Duration) (stdout string, stderr string, err error) {
+	hash, err := hashFile(scriptPath)
+	if err == nil {
+		e.log().Info("executing script", "scriptType", scriptType, "path", scriptPath, "sha256", hash)
+	}
+	return e.executeScript(scriptRun{
+		scriptType: scriptType,
+		path:       scriptPath,
+		sha256:     hash,
+		arguments:  arguments,
+		parameters: parameters,
+		timeout:    timeout,
+	})
+}
+
+// ExecuteScriptFromFS is the base implementation of the ExecuteScriptFromFS function which executes a script stored
+// in a filesystem such as an embed.FS.
+func (e *BaseExecutor) ExecuteScriptFromFS(fsys fs.FS, scriptPath string, scriptType ScriptType, arguments []string, parameters map[string]string) (stdout string, stderr string, err error) {
+	return e.ExecuteScriptFromFSWithTimeout(fsys, scriptPath, scriptType, arguments, parameters, 0)
+}
+
+// ExecuteScriptFromFSWithTimeout is the base implementation of the ExecuteScriptFromFSWithTimeout function which
+// executes a script stored in a filesystem with a timeout. The directory containing the script is staged, including
+// any helper libraries or data files it contains, into a temporary directory which is used as the working directory
+// of the script and removed once it has finished.
+func (e *BaseExecutor) ExecuteScriptFromFSWithTimeout(fsys fs.FS, scriptPath string, scriptType ScriptType, arguments []string, parameters map[string]string, timeout time.Duration) (stdout string, stderr string, err error) {
+	if _, err := interpreterFor(scriptType); err != nil {
+		return "", "", err
+	}
+
+	bundle, err := e.stageBundle(fsys, scriptPath)
+	if err != nil {
+		return "", "", err
+	}
+	defer bundle.Close()
+
+	return e.executeScript(scriptRun{
+		scriptType: scriptType,
+		path:       bundle.Path,
+		sha256:     bundle.SHA256,
+		dir:        bundle.Dir,
+		arguments:  arguments,
+		parameters: stringParameters(parameters),
+		timeout:    timeout,
+	})
 }
 
 // ExecuteTTY is the base implementation of the ExecuteTTY function which executes a command with a TTY.
 func (e *BaseExecutor) ExecuteTTY(command string) error {
-	exe, _, cancel, err := e.prepareCommand(command, os.Stdin, 0)
+	spec, err := e.commandSpec(command, os.Stdin, 0)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if cancel != nil {
-			cancel()
-		}
-	}()
+	spec.TTY = true
 
-	exe.Stdout = os.Stdout
-	exe.Stderr = os.Stderr
-
-	err = exe.Start()
+	execResult, err := e.run(spec)
 	if err != nil {
 		return err
 	}
 
-	return exe.Wait()
+	return <-execResult.Finished
+}
+
+// ExecuteSpecAsync is the base implementation of the ExecuteSpecAsync function which asynchronously executes a command
+// described by a spec built by the caller, e.g. received from a remote client. The spec is executed as is, without
+// the shell and sudo handling, environment or working directory of the executor, but through its middleware, hooks
+// and audit sink. The binary is resolved when Path isn't absolute and the command runs as the user of the executor,
+// so the User of the spec must be empty or match it. The command is killed when ctx is done.
+func (e *BaseExecutor) ExecuteSpecAsync(ctx context.Context, spec *CommandSpec) (*ExecutionResult, error) {
+	if spec.Path == "" {
+		return nil, errors.New("empty command")
+	}
+	if spec.User != "" && spec.User != e.user {
+		return nil, fmt.Errorf("the command can't run as %s, the executor runs commands as %q", spec.User, e.user)
+	}
+
+	path, err := e.lookPath(spec.Path)
+	if err != nil {
+		e.log().Error("failed to find binary path", "error", err)
+		return nil, err
+	}
+	spec.Path = path
+	spec.User = e.user
+	if spec.Command == "" {
+		spec.Command = spec.String()
+	}
+	spec.ctx = ctx
+
+	return e.run(spec)
+}
+
+// scriptRun describes a staged script that is ready to be executed.
+type scriptRun struct {
+	ctx        context.Context
+	scriptType ScriptType
+	path       string
+	sha256     string
+	dir        string
+	extraFiles []*os.File
+	arguments  []string
+	parameters ScriptParameters
+	timeout    time.Duration
 }
 
 // executeScript is the base implementation of the executeScript function which executes a script and returns the stdout and stderr.
-func (e *BaseExecutor) executeScript(scriptType ScriptType, scriptPath string, arguments []string, parameters map[string]string, timeout time.Duration) (stdout string, stderr string, err error) {
-	command, err := e.buildScriptCommand(scriptType, scriptPath, arguments, parameters)
+func (e *BaseExecutor) executeScript(script scriptRun) (stdout string, stderr string, err error) {
+	spec, err := e.scriptSpec(script)
+	if err != nil {
+		return "", "", err
+	}
+
+	execResult, err := e.run(spec)
 	if err != nil {
 		return "", "", err
 	}
 
-	sout, serr, err := e.execute(command, nil, timeout, true)
+	sout, serr, err := e.wait(execResult)
 	if err != nil {
 		var stdout, stderr []byte
 		if sout != nil {
@@ -254,217 +573,327 @@ func (e *BaseExecutor) executeScript(scriptType ScriptType, scriptPath string, a
 }
 
 // execute is the base implementation of the execute function which executes a command and returns the stdout and stderr.
-func (e *BaseExecutor) execute(command string, stdin io.ReadCloser, timeout time.Duration, script bool) (io.ReadCloser, io.ReadCloser, error) {
-	execResult, err := e.executeAsync(command, stdin, timeout, script)
+func (e *BaseExecutor) execute(command string, stdin io.ReadCloser, timeout time.Duration) (io.ReadCloser, io.ReadCloser, error) {
+	execResult, err := e.executeAsync(command, stdin, timeout)
 	if err != nil {
-		logger.Error("failed to execute command", "error", err)
+		e.log().Error("failed to execute command", "error", err)
 		return nil, nil, err
 	}
 
+	return e.wait(execResult)
+}
+
+// wait blocks until the command behind the execution result finishes or times out.
+func (e *BaseExecutor) wait(execResult *ExecutionResult) (io.ReadCloser, io.ReadCloser, error) {
 	// Wait for completion or timeout using the context from execResult
-	logger.Trace("waiting for command execution to finish")
+	e.log().Trace("waiting for command execution to finish")
 	select {
 	case err := <-execResult.Finished:
-		logger.Trace("command execution finished")
+		e.log().Trace("command execution finished")
 		return execResult.Stdout.(io.ReadCloser), execResult.Stderr.(io.ReadCloser), err
 	case <-execResult.Ctx.Done():
-		logger.Error("command execution timed out", "error", execResult.Ctx.Err())
+		e.log().Error("command execution timed out", "error", execResult.Ctx.Err())
 		return nil, nil, execResult.Ctx.Err()
 	}
 }
 
 // executeAsync is the base implementation of the executeAsync function which executes a command asynchronously.
-func (e *BaseExecutor) executeAsync(command string, stdin io.ReadCloser, timeout time.Duration, script bool) (*ExecutionResult, error) {
+func (e *BaseExecutor) executeAsync(command string, stdin io.ReadCloser, timeout time.Duration) (*ExecutionResult, error) {
+	spec, err := e.commandSpec(command, stdin, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.run(spec)
+}
+
+// run executes the command described by the spec through the middleware chain of the executor, retrying it according
+// to the retry policy of the executor.
+func (e *BaseExecutor) run(spec *CommandSpec) (*ExecutionResult, error) {
+	next := e.runSpec
+	for i := len(e.middleware) - 1; i >= 0; i-- {
+		next = e.middleware[i](next)
+	}
+	if e.retries(spec) {
+		return e.retry(next, spec)
+	}
+	return next(spec)
+}
+
+// runSpec executes the command described by the spec, or only records it in the plan when running in dry-run mode.
+func (e *BaseExecutor) runSpec(spec *CommandSpec) (*ExecutionResult, error) {
+	err := e.beforeStart(spec)
+	e.redactSensitiveEnv(spec)
+	if err != nil {
+		e.complete(spec, newResult(spec, time.Now(), nil, err))
+		return nil, err
+	}
+
 	var exe *exec.Cmd
 	var ctx context.Context
 	var cancel context.CancelFunc
-	var err error
-	if script {
-		exe, ctx, cancel, err = e.prepareScript(command, stdin, timeout)
-		if err != nil {
-			return nil, err
-		}
+	if e.transport != nil {
+		ctx, cancel = timeoutContext(spec.parentContext(), spec.Timeout)
 	} else {
-		exe, ctx, cancel, err = e.prepareCommand(command, stdin, timeout)
+		exe, ctx, cancel, err = e.prepare(spec)
 		if err != nil {
+			if cancel != nil {
+				cancel()
+			}
+			e.complete(spec, newResult(spec, time.Now(), ctx, err))
 			return nil, err
 		}
 	}
 
-	// Setting up stdout and stderr
-	stdoutPipe, err := exe.StdoutPipe()
-	if err != nil {
-		logger.Error("failed to get stdout pipe", "error", err)
-		cancel()
-		return nil, err
+	// In dry-run mode the command is fully prepared, which validates the user, but never started
+	if e.dryRun {
+		if cancel != nil {
+			cancel()
+		}
+		execResult, result := e.dryRunExecution(spec)
+		e.afterStart(spec, execResult)
+		e.complete(spec, result)
+		return execResult, nil
+	}
+
+	// The exit of the process is only reported once the AfterStart hooks have been called
+	started := make(chan struct{})
+	var execResult *ExecutionResult
+	switch {
+	case e.transport != nil:
+		execResult, err = e.startTransport(spec, ctx, cancel, started)
+	case spec.TTY:
+		execResult, err = e.startTTY(spec, exe, ctx, cancel, started)
+	default:
+		execResult, err = e.start(spec, exe, ctx, cancel, started)
 	}
-	stderrPipe, err := exe.StderrPipe()
 	if err != nil {
-		logger.Error("failed to get stderr pipe", "error", err)
-		cancel()
+		e.complete(spec, newResult(spec, time.Now(), ctx, err))
 		return nil, err
 	}
 
-	// In order to ensure that the command execution artifacts are cleaned up we need to know when the command exits.
-	// We can not use exe.Wait() to do this as that will trigger a cleanup of the resources and a premature close of
-	// the pipes used for stdout and stderr. Instead, we need to wait for the pipes to be closed but since we pass those
-	// through to the caller we need a way to have visibility to that. We end up using a custom ReadWriteCloser here to
-	// allow visibility into when the pipes are closed. This is a bit of a hack, but it is needed here instead of
-	// bytes.Buffer because bytes.Buffer will return EOF if read too early before there is input to read.
-	outReadWriter := internal.NewExecReadWriter(stdoutPipe)
-	errReadWriter := internal.NewExecReadWriter(stderrPipe)
+	e.afterStart(spec, execResult)
+	close(started)
+	return execResult, nil
+}
 
-	// Starting the command asynchronously
-	err = exe.Start()
+// startTTY starts the prepared command attached to the terminal of the current process.
+func (e *BaseExecutor) startTTY(spec *CommandSpec, exe *exec.Cmd, ctx context.Context, cancel context.CancelFunc, started <-chan struct{}) (*ExecutionResult, error) {
+	exe.Stdout = os.Stdout
+	exe.Stderr = os.Stderr
+
+	startTime := time.Now()
+	err := exe.Start()
 	if err != nil {
-		logger.Error("failed to start command", "error", err)
 		if cancel != nil {
 			cancel()
 		}
 		return nil, err
 	}
-	logger.Trace("started command asynchronously")
 
-	finished := make(chan error)
+	finished := make(chan error, 1)
 	go func() {
 		defer close(finished)
-		errReadWriter.Wait()
-		logger.Trace("the errReadWriter has finished")
-		outReadWriter.Wait()
-		logger.Trace("the outReadWriter has finished")
 		exitErr := exe.Wait()
+		<-started
+		e.complete(spec, newResult(spec, startTime, ctx, exitErr))
 		finished <- exitErr
-		logger.Trace("command finished executing", "exit", exitErr)
 		if cancel != nil {
 			cancel()
 		}
 	}()
 
-	logger.Trace("returning ExecutionResults object")
 	return &ExecutionResult{
-		Stdout:   outReadWriter,
-		Stderr:   errReadWriter,
+		Stdout:   io.NopCloser(strings.NewReader("")),
+		Stderr:   io.NopCloser(strings.NewReader("")),
 		Finished: finished,
 		Ctx:      ctx,
 	}, nil
 }
 
-func (e *BaseExecutor) writeTempScript(scriptType ScriptType, script string) (string, error) {
-	var pattern string
-	switch scriptType {
-	case ScriptTypePowerShell:
-		pattern = "go-execute-*.ps1"
-	case ScriptTypeBash:
-		pattern = "go-execute-*.sh"
-	case ScriptTypePython:
-		pattern = "go-execute-*.py"
+// start starts the prepared command and returns the ExecutionResult used to interact with the running process.
+func (e *BaseExecutor) start(spec *CommandSpec, exe *exec.Cmd, ctx context.Context, cancel context.CancelFunc, started <-chan struct{}) (*ExecutionResult, error) {
+	// Setting up stdout and stderr
+	stdoutPipe, err := exe.StdoutPipe()
+	if err != nil {
+		e.log().Error("failed to get stdout pipe", "error", err)
+		if cancel != nil {
+			cancel()
+		}
+		return nil, err
 	}
-	tmpFile, err := os.CreateTemp("", pattern)
+	stderrPipe, err := exe.StderrPipe()
 	if err != nil {
-		return "", fmt.Errorf("failed to create temporary script file: %w", err)
+		e.log().Error("failed to get stderr pipe", "error", err)
+		if cancel != nil {
+			cancel()
+		}
+		return nil, err
 	}
 
-	if _, err := tmpFile.Write([]byte(script)); err != nil {
-		return "", fmt.Errorf("failed to write to temporary script file: %w", err)
-	}
+	// In order to ensure that the command execution artifacts are cleaned up we need to know when the command exits.
+	// We can not use exe.Wait() to do this as that will trigger a cleanup of the resources and a premature close of
+	// the pipes used for stdout and stderr. Instead, we need to wait for the pipes to be closed but since we pass those
+	// through to the caller we need a way to have visibility to that. We end up using a custom ReadWriteCloser here to
+	// allow visibility into when the pipes are closed. This is a bit of a hack, but it is needed here instead of
+	// bytes.Buffer because bytes.Buffer will return EOF if read too early before there is input to read.
+	streams := e.newOutputStreams(spec, stdoutPipe, stderrPipe)
 
-	if err := tmpFile.Close(); err != nil {
-		return "", fmt.Errorf("failed to close temporary script file: %w", err)
+	// Starting the command asynchronously
+	startTime := time.Now()
+	err = exe.Start()
+	if err != nil {
+		e.log().Error("failed to start command", "error", err)
+		if cancel != nil {
+			cancel()
+		}
+		return nil, err
 	}
+	e.log().Trace("started command asynchronously")
 
-	return tmpFile.Name(), nil
+	return e.monitor(spec, streams, exe.Wait, startTime, ctx, cancel, started), nil
 }
 
-func (e *BaseExecutor) buildScriptCommand(scriptType ScriptType, scriptPath string, arguments []string, parameters map[string]string) (command string, err error) {
-	switch scriptType {
-	case ScriptTypePowerShell:
-		command = fmt.Sprintf("powershell.exe -NoProfile -NonInteractive -ExecutionPolicy Bypass -File %s", scriptPath)
-		for key, value := range parameters {
-			// Check to see if value already is wrapped in single quotes
-			command += fmt.Sprintf(" -%s %s", key, value)
-		}
-	case ScriptTypeBash:
-		return "", errors.New("bash support not yet implemented")
-	case ScriptTypePython:
-		return "", errors.New("python support not yet implemented")
-	default:
-		return "", errors.New("unsupported script type")
-	}
+// outputStreams holds the output of a running process.
+type outputStreams struct {
+	stdoutTap     *outputTap
+	stderrTap     *outputTap
+	outReadWriter *internal.ExecReadWriter
+	errReadWriter *internal.ExecReadWriter
+}
 
-	return command, nil
+// newOutputStreams starts buffering the stdout and stderr of a process for the caller while recording them in taps.
+func (e *BaseExecutor) newOutputStreams(spec *CommandSpec, stdout io.ReadCloser, stderr io.ReadCloser) *outputStreams {
+	streams := &outputStreams{
+		stdoutTap: newOutputTap(stdout),
+		stderrTap: newOutputTap(stderr),
+	}
+	if len(spec.onOutput) > 0 {
+		streams.stdoutTap.output = spec.outputFunc("stdout")
+		streams.stderrTap.output = spec.outputFunc("stderr")
+	}
+	if e.stdoutLogLevel != LogLevelOff {
+		streams.stdoutTap.line = e.outputLogger(spec, "stdout", e.stdoutLogLevel)
+	}
+	if e.stderrLogLevel != LogLevelOff {
+		streams.stderrTap.line = e.outputLogger(spec, "stderr", e.stderrLogLevel)
+	}
+	streams.outReadWriter = internal.NewExecReadWriter(streams.stdoutTap)
+	streams.errReadWriter = internal.NewExecReadWriter(streams.stderrTap)
+	return streams
 }
 
-func (e *BaseExecutor) prepareScript(command string, stdin io.ReadCloser, timeout time.Duration) (*exec.Cmd, context.Context, context.CancelFunc, error) {
-	ctx := context.Background()
-	var cancel context.CancelFunc
+// monitor waits for the started process in the background and returns the ExecutionResult used to interact with it.
+// The process is only waited for once its output has been fully read.
+func (e *BaseExecutor) monitor(spec *CommandSpec, streams *outputStreams, wait func() error, startTime time.Time, ctx context.Context, cancel context.CancelFunc, started <-chan struct{}) *ExecutionResult {
+	finished := make(chan error, 1)
+	go func() {
+		defer close(finished)
+		streams.errReadWriter.Wait()
+		e.log().Trace("the errReadWriter has finished")
+		streams.outReadWriter.Wait()
+		e.log().Trace("the outReadWriter has finished")
+		exitErr := wait()
+		result := newResult(spec, startTime, ctx, exitErr)
+		result.setOutput(streams.stdoutTap, streams.stderrTap)
+		<-started
+		e.complete(spec, result)
+		finished <- exitErr
+		e.log().Trace("command finished executing", "exit", exitErr)
+		if cancel != nil {
+			cancel()
+		}
+	}()
 
-	if timeout != 0 {
-		logger.Trace("configuring command timeout", "timeout", timeout)
-		ctx, cancel = context.WithTimeout(ctx, timeout)
+	e.log().Trace("returning ExecutionResults object")
+	return &ExecutionResult{
+		Stdout:   streams.outReadWriter,
+		Stderr:   streams.errReadWriter,
+		Finished: finished,
+		Ctx:      ctx,
 	}
+}
 
-	cmdParts, err := utilities.Fields(command)
+// buildScriptCommand returns the interpreter binary and arguments used to execute the script. Typed parameters are
+// passed as is to interpreters that support them and converted to strings for all other interpreters.
+func (e *BaseExecutor) buildScriptCommand(scriptType ScriptType, scriptPath string, arguments []string, parameters ScriptParameters) (binary string, args []string, err error) {
+	interpreter, err := interpreterFor(scriptType)
 	if err != nil {
-		logger.Error("failed to get command parts", "error", err)
-		return nil, ctx, cancel, err
+		return "", nil, err
 	}
-	logger.Trace("split command into the parts", "cmdParts", cmdParts)
 
-	if len(cmdParts) == 0 {
-		err = errors.New("empty command")
-		logger.Error("failed to get command parts", "error", err)
-		return nil, ctx, cancel, err
-	}
-
-	var binary string
-	var args []string
-	binary, err = exec.LookPath(cmdParts[0])
+	binary, err = e.lookInterpreter(interpreter)
 	if err != nil {
-		logger.Error("failed to find binary path", "error", err)
-		return nil, ctx, cancel, err
+		e.log().Error("failed to find interpreter path", "scriptType", scriptType, "error", err)
+		return "", nil, err
 	}
-	logger.Trace("binary found", "binary", binary)
-	args = cmdParts[1:]
-	logger.Trace("setting commandcontext", "binary", binary, "args", args)
-
-	exe := exec.CommandContext(ctx, binary, args...)
-	exe.Stdin = stdin
-	exe.Env = e.environment
-	logger.Trace("command context set", "environment", exe.Env)
 
-	if e.user != "" {
-		err := e.configureUser(ctx, cancel, exe)
-		if err != nil {
-			logger.Error("failed to configure command user", "error", err)
-			return exe, ctx, cancel, err
+	if typed, ok := interpreter.(TypedInterpreter); ok {
+		args, err = typed.TypedArgs(scriptPath, arguments, parameters)
+	} else {
+		var values map[string]string
+		values, err = parameters.strings()
+		if err == nil {
+			args, err = interpreter.Args(scriptPath, arguments, values)
 		}
-		logger.Trace("configured user for execution", "user", e.User)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to build %s script arguments: %w", scriptType, err)
 	}
 
-	return exe, ctx, cancel, nil
+	return binary, args, nil
 }
 
-// prepareCommand is the base implementation of the prepareCommand function which prepares the command for execution.
-func (e *BaseExecutor) prepareCommand(command string, stdin io.ReadCloser, timeout time.Duration) (*exec.Cmd, context.Context, context.CancelFunc, error) {
-	ctx := context.Background()
-	var cancel context.CancelFunc
+// scriptSpec builds the spec of the interpreter command used to execute a script.
+func (e *BaseExecutor) scriptSpec(script scriptRun) (*CommandSpec, error) {
+	binary, args, err := e.buildScriptCommand(script.scriptType, script.path, script.arguments, script.parameters)
+	if err != nil {
+		return nil, err
+	}
+	e.log().Trace("built script command", "binary", binary, "args", args)
 
-	if timeout != 0 {
-		logger.Trace("configuring command timeout", "timeout", timeout)
-		ctx, cancel = context.WithTimeout(ctx, timeout)
+	dir := e.workingDir
+	if script.dir != "" {
+		dir = script.dir
 	}
 
+	return &CommandSpec{
+		Command:      script.path,
+		Path:         binary,
+		Args:         args,
+		Env:          e.environment,
+		Dir:          dir,
+		User:         e.user,
+		Timeout:      script.timeout,
+		ScriptType:   script.scriptType,
+		ScriptSHA256: script.sha256,
+		extraFiles:   script.extraFiles,
+		ctx:          script.ctx,
+	}, nil
+}
+
+// commandSpec builds the spec of a command by splitting it into its parts, resolving the binary and applying the
+// shell and sudo handling of the executor.
+func (e *BaseExecutor) commandSpec(command string, stdin io.ReadCloser, timeout time.Duration) (*CommandSpec, error) {
 	cmdParts, err := utilities.Fields(command)
 	if err != nil {
-		logger.Error("failed to get command parts", "error", err)
-		return nil, ctx, cancel, err
+		e.log().Error("failed to get command parts", "error", err)
+		return nil, err
 	}
-	logger.Trace("split command into the parts", "cmdParts", cmdParts)
+	e.log().Trace("split command into the parts", "cmdParts", cmdParts)
 
 	if len(cmdParts) == 0 {
 		err = errors.New("empty command")
-		logger.Error("failed to get command parts", "error", err)
-		return nil, ctx, cancel, err
+		e.log().Error("failed to get command parts", "error", err)
+		return nil, err
+	}
+
+	spec := &CommandSpec{
+		Command: command,
+		Env:     e.environment,
+		Dir:     e.workingDir,
+		User:    e.user,
+		Timeout: timeout,
 	}
 
 	var binary string
@@ -476,7 +905,7 @@ func (e *BaseExecutor) prepareCommand(command string, stdin io.ReadCloser, timeo
 			if stdin == nil {
 				buf, err := e.sudoPass.Open()
 				if err != nil {
-					return nil, ctx, cancel, fmt.Errorf("failed to access sudo password: %w", err)
+					return nil, fmt.Errorf("failed to access sudo password: %w", err)
 				}
 				defer buf.Destroy()
 				stdin = io.NopCloser(strings.NewReader(string(buf.Bytes()) + "\n"))
@@ -484,12 +913,7 @@ func (e *BaseExecutor) prepareCommand(command string, stdin io.ReadCloser, timeo
 			binary = "sudo"
 			args = append([]string{"-S"}, cmdParts[1:]...)
 		} else {
-			binary, err = exec.LookPath(cmdParts[0])
-			if err != nil {
-				logger.Error("failed to find binary path", "error", err)
-				return nil, ctx, cancel, err
-			}
-			logger.Trace("binary found", "binary", binary)
+			binary = cmdParts[0]
 			args = cmdParts[1:]
 		}
 	} else {
@@ -498,43 +922,88 @@ func (e *BaseExecutor) prepareCommand(command string, stdin io.ReadCloser, timeo
 		if strings.Contains(command, "sudo ") && e.sudoPass != nil {
 			buf, err := e.sudoPass.Open()
 			if err != nil {
-				return nil, ctx, cancel, fmt.Errorf("failed to access sudo password: %w", err)
+				return nil, fmt.Errorf("failed to access sudo password: %w", err)
 			}
 			defer buf.Destroy()
 			// Replace sudo with echo password | sudo -S to handle password input
 			command = strings.Replace(command, "sudo ", fmt.Sprintf("echo '%s' | sudo -S ", string(buf.Bytes())), -1)
+			spec.AddSecret(string(buf.Bytes()))
 		}
-		switch strings.ToLower(binary) {
+		switch strings.ToLower(filepath.Base(binary)) {
 		case "cmd", "cmd.exe":
 			args = []string{"/c", command}
-		case "powershell", "powershell.exe":
+		case "powershell", "powershell.exe", "pwsh", "pwsh.exe":
 			args = []string{"-NoProfile", "-NonInteractive", "-Command", command}
 		default:
 			args = []string{"-c", command}
 		}
 	}
 
-	exe := exec.CommandContext(ctx, binary, args...)
-	exe.Stdin = stdin
-	exe.Env = e.environment
-	exe.Dir = e.workingDir
-	logger.Trace("command context set", "environment", exe.Env)
+	spec.Path, err = e.lookPath(binary)
+	if err != nil {
+		e.log().Error("failed to find binary path", "error", err)
+		return nil, err
+	}
+	e.log().Trace("binary found", "binary", spec.Path)
+	spec.Args = args
+	if stdin != nil {
+		spec.Stdin = stdin
+	}
+
+	return spec, nil
+}
+
+// timeoutContext returns the context of a command with the timeout. The cancel function is nil without a timeout.
+func timeoutContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return parent, nil
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+// prepare creates the command described by the spec.
+func (e *BaseExecutor) prepare(spec *CommandSpec) (*exec.Cmd, context.Context, context.CancelFunc, error) {
+	if spec.Timeout != 0 {
+		e.log().Trace("configuring command timeout", "timeout", spec.Timeout)
+	}
+	ctx, cancel := timeoutContext(spec.parentContext(), spec.Timeout)
+
+	e.log().Trace("setting commandcontext", "binary", spec.Path, "args", spec.Redacted().Args)
+	exe := exec.CommandContext(ctx, spec.Path, spec.Args...)
+	exe.Stdin = spec.Stdin
+	exe.Env = spec.Env
+	if len(spec.ExtraEnv) > 0 {
+		exe.Env = spec.Environ(os.Environ())
+	}
+	exe.Dir = spec.Dir
+	exe.ExtraFiles = spec.extraFiles
+	if e.gracePeriod > 0 {
+		exe.Cancel = func() error {
+			return terminate(exe.Process)
+		}
+		exe.WaitDelay = e.gracePeriod
+	}
+	e.log().Trace("command context set", "environment", spec.Redacted().Env)
 
-	if e.user != "" {
+	if spec.User != "" {
 		err := e.configureUser(ctx, cancel, exe)
 		if err != nil {
-			logger.Error("failed to configure command user", "error", err)
+			e.log().Error("failed to configure command user", "error", err)
 			return exe, ctx, cancel, err
 		}
-		logger.Trace("configured user for execution", "user", e.User)
+		e.log().Trace("configured user for execution", "user", spec.User)
 	}
 
 	return exe, ctx, cancel, nil
 }
 
-// configureUser is the base implementation of the configureUser function which must be overridden by the platform-specific executor.
+// configureUser is the base implementation of the configureUser function which delegates to the platform-specific
+// executor.
 func (e *BaseExecutor) configureUser(ctx context.Context, cancel context.CancelFunc, exe *exec.Cmd) error {
-	return errors.New("this method must be implemented by the platform-specific executor")
+	if e.platform == nil {
+		return errors.New("this method must be implemented by the platform-specific executor")
+	}
+	return e.platform.configureUser(ctx, cancel, exe)
 }
 
 // Struct and methods to allow basic execution without needing to instantiate a new Executor.
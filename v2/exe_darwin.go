@@ -2,15 +2,17 @@ package execute
 
 import (
 	"context"
+	"os"
 	"os/exec"
 	"os/user"
 	"strconv"
 	"syscall"
 )
 
-// NewExecutor creates a new Executor.
-func NewExecutor(options ...Option) Executor {
+// NewExecutor creates a new Executor, which also implements ConfigurableExecutor.
+func NewExecutor(options ...Option) ConfigurableExecutor {
 	e := &DarwinExecutor{}
+	e.platform = e
 	for _, option := range options {
 		option(e)
 	}
@@ -45,3 +47,29 @@ func (e DarwinExecutor) configureUser(ctx context.Context, cancel context.Cancel
 
 	return nil
 }
+
+// grantScriptAccess changes the owner of a staged script to the user the command is executed as so the interpreter
+// is still able to read it once privileges have been dropped.
+func (e DarwinExecutor) grantScriptAccess(path string) error {
+	u, err := user.Lookup(e.user)
+	if err != nil {
+		return err
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return err
+	}
+
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return err
+	}
+
+	return os.Chown(path, uid, gid)
+}
+
+// stageScriptInMemory is not supported on Darwin.
+func (e DarwinExecutor) stageScriptInMemory(script string) (*os.File, string, error) {
+	return nil, "", errInMemoryScriptsUnsupported
+}
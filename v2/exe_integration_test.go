@@ -1,6 +1,7 @@
 package execute
 
 import (
+	"context"
 	"io"
 	"runtime"
 	"strings"
@@ -393,6 +394,78 @@ func TestExecuteTTYReturnsErrorForEmptyCommand(t *testing.T) {
 	}
 }
 
+func TestExecuteSpecAsyncReturnsResult(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+	spec := &CommandSpec{Path: "cat", Stdin: strings.NewReader("input")}
+	result, err := NewExecutor().(SpecExecutor).ExecuteSpecAsync(context.Background(), spec)
+	if err != nil {
+		t.Fatalf("Error executing spec: %v", err)
+	}
+	out, _ := io.ReadAll(result.Stdout)
+	if err := <-result.Finished; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(out) != "input" {
+		t.Fatalf("Unexpected stdout: %q", out)
+	}
+	if !strings.HasSuffix(spec.Path, "/cat") {
+		t.Fatalf("Expected the binary to be resolved, got %q", spec.Path)
+	}
+}
+
+func TestExecuteSpecAsyncCancel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	result, err := NewExecutor().(SpecExecutor).ExecuteSpecAsync(ctx, &CommandSpec{Path: "sleep", Args: []string{"10"}})
+	if err != nil {
+		t.Fatalf("Error executing spec: %v", err)
+	}
+	cancel()
+	select {
+	case err := <-result.Finished:
+		if err == nil {
+			t.Fatal("Expected an error for a cancelled command")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the command to be killed")
+	}
+}
+
+func TestExecuteSpecAsyncRejectsOtherUser(t *testing.T) {
+	_, err := NewExecutor().(SpecExecutor).ExecuteSpecAsync(context.Background(), &CommandSpec{Path: "echo", User: "nobody"})
+	if err == nil {
+		t.Fatal("Expected an error for a spec with another user")
+	}
+	_, err = NewExecutor().(SpecExecutor).ExecuteSpecAsync(context.Background(), &CommandSpec{})
+	if err == nil {
+		t.Fatal("Expected an error for an empty spec")
+	}
+}
+
+func TestExecuteAsyncWithTimeoutGracePeriod(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+	executor := NewExecutor(WithShell("/bin/sh"), WithGracePeriod(5*time.Second))
+	result, err := executor.ExecuteAsyncWithTimeout(`trap 'echo stopping; kill $!; exit 0' TERM; sleep 10 & wait`, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Error executing command: %v", err)
+	}
+	start := time.Now()
+	out, _ := io.ReadAll(result.Stdout)
+	<-result.Finished
+	if string(out) != "stopping\n" {
+		t.Fatalf("Expected the command to be stopped gracefully, got %q", out)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Fatalf("Expected the command to exit within the grace period, took %v", elapsed)
+	}
+}
+
 func TestExecuteScriptFromString(t *testing.T) {
 	if runtime.GOOS != "windows" {
 		t.Skip("skipping test: current implementation only runs on Windows")
@@ -2,15 +2,20 @@ package execute
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"os/exec"
 	"os/user"
 	"strconv"
 	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
-// NewExecutor creates a new Executor.
-func NewExecutor(options ...Option) Executor {
+// NewExecutor creates a new Executor, which also implements ConfigurableExecutor.
+func NewExecutor(options ...Option) ConfigurableExecutor {
 	e := &LinuxExecutor{}
+	e.platform = e
 	for _, option := range options {
 		option(e)
 	}
@@ -45,3 +50,41 @@ func (e LinuxExecutor) configureUser(ctx context.Context, cancel context.CancelF
 
 	return nil
 }
+
+// grantScriptAccess changes the owner of a staged script to the user the command is executed as so the interpreter
+// is still able to read it once privileges have been dropped.
+func (e LinuxExecutor) grantScriptAccess(path string) error {
+	u, err := user.Lookup(e.user)
+	if err != nil {
+		return err
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return err
+	}
+
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return err
+	}
+
+	return os.Chown(path, uid, gid)
+}
+
+// stageScriptInMemory writes the script to an anonymous memory-backed file created with memfd_create. The file is
+// inherited by the interpreter as file descriptor 3 so the script never touches the disk.
+func (e LinuxExecutor) stageScriptInMemory(script string) (*os.File, string, error) {
+	fd, err := unix.MemfdCreate("go-execute-script", unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create memory-backed script file: %w", err)
+	}
+
+	file := os.NewFile(uintptr(fd), "go-execute-script")
+	if _, err := file.WriteString(script); err != nil {
+		file.Close()
+		return nil, "", fmt.Errorf("failed to write memory-backed script file: %w", err)
+	}
+
+	return file, "/dev/fd/3", nil
+}
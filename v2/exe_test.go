@@ -1,8 +1,12 @@
 package execute
 
 import (
+	"context"
+	"errors"
 	"reflect"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestSetEnvironment(t *testing.T) {
@@ -184,3 +188,54 @@ func TestUsingShell(t *testing.T) {
 		}
 	})
 }
+
+func TestCollect(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+	executor := NewExecutor(WithShell("sh"))
+
+	t.Run("Collect_KeepsOutputOfFailedCommands", func(t *testing.T) {
+		stdout, stderr, err := Collect(context.Background(), executor, "echo out; echo err >&2; exit 3")
+		if ExitCode(err) != 3 {
+			t.Errorf("Expected exit code 3, but got %v", err)
+		}
+		if stdout != "out\n" || stderr != "err\n" {
+			t.Errorf("Expected the output to be collected, but got %q and %q", stdout, stderr)
+		}
+	})
+
+	t.Run("Collect_KillsCommandWhenContextIsDone", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if _, _, err := Collect(ctx, executor, "exec sleep 5"); ExitCode(err) != -1 {
+			t.Errorf("Expected the killed command to report exit code -1, but got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("Expected the command to be killed, but Collect took %s", elapsed)
+		}
+	})
+
+	t.Run("Collect_UsesDeadlineWithoutContextExecutor", func(t *testing.T) {
+		// Embedding hides the methods beyond those of Executor
+		plain := struct{ Executor }{executor}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if _, _, err := Collect(ctx, plain, "exec sleep 5"); ExitCode(err) != -1 {
+			t.Errorf("Expected the timed out command to report exit code -1, but got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("Expected the command to be killed, but Collect took %s", elapsed)
+		}
+	})
+
+	t.Run("Collect_WithDoneContextWithoutContextExecutor", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, _, err := Collect(ctx, struct{ Executor }{executor}, "echo never"); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, but got %v", err)
+		}
+	})
+}
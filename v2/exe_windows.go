@@ -6,13 +6,15 @@ import (
 	"fmt"
 	"github.com/bgrewell/go-execute/v2/internal/utilities"
 	"github.com/shirou/gopsutil/v3/process"
+	"os"
 	"os/exec"
 	"syscall"
 )
 
-// NewExecutor creates a new Executor.
-func NewExecutor(options ...Option) Executor {
+// NewExecutor creates a new Executor, which also implements ConfigurableExecutor.
+func NewExecutor(options ...Option) ConfigurableExecutor {
 	e := &WindowsExecutor{}
+	e.platform = e
 	for _, option := range options {
 		option(e)
 	}
@@ -56,6 +58,16 @@ func (e WindowsExecutor) configureUser(ctx context.Context, cancel context.Cance
 	return nil
 }
 
+// grantScriptAccess is a no-op on Windows where staged scripts rely on the ACLs inherited from the script directory.
+func (e WindowsExecutor) grantScriptAccess(path string) error {
+	return nil
+}
+
+// stageScriptInMemory is not supported on Windows.
+func (e WindowsExecutor) stageScriptInMemory(script string) (*os.File, string, error) {
+	return nil, "", errInMemoryScriptsUnsupported
+}
+
 //func (e WindowsExecutor) ExecutePowershell(command string) (combined string, err error) {
 //    return e.ExecuteWithTimeout(e.encodePowershellCommand(command), 0)
 //}
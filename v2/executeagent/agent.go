@@ -0,0 +1,128 @@
+// Package executeagent exposes an execute.Executor over HTTP and provides a client-side executor that talks to it,
+// so commands can be run on hosts without SSH.
+//
+// The Server authenticates requests with a bearer token and/or client certificates (mTLS), checks commands against
+// an allowlist, restricts the environment and settings clients may choose and streams the output of commands back as
+// newline delimited JSON. The client is an execute.Transport, so the executor returned by NewExecutor resolves
+// commands, handles scripts, timeouts, dry-run mode, auditing, middleware and hooks locally while the processes run
+// on the agent. Scripts are staged on the agent, which WithFileStaging must allow.
+//
+//	// On the host
+//	server := executeagent.NewServer(execute.NewExecutor(), executeagent.WithToken(token), executeagent.WithAllowlist("systemctl"),
+//		executeagent.WithFileStaging(16, 64<<20))
+//	http.ListenAndServeTLS(":7443", "agent.crt", "agent.key", server)
+//
+//	// On the control plane
+//	e := executeagent.NewExecutor(executeagent.NewClient("https://host:7443", executeagent.WithBearerToken(token)))
+//	out, err := e.Execute("systemctl restart nginx")
+package executeagent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+const (
+	pathLookPath = "/v1/lookpath"
+	pathExec     = "/v1/exec"
+	pathFiles    = "/v1/files"
+
+	// contentTypeNDJSON is the content type of the streamed execution events.
+	contentTypeNDJSON = "application/x-ndjson"
+)
+
+// event is a single line of the stream returned for an execution. Output events carry Stream and Data, the last event
+// of a stream carries Exit.
+type event struct {
+	Stream string      `json:"stream,omitempty"`
+	Data   []byte      `json:"data,omitempty"`
+	Exit   *exitStatus `json:"exit,omitempty"`
+}
+
+// exitStatus is the outcome of an execution.
+type exitStatus struct {
+	Code  int    `json:"code"`
+	Error string `json:"error,omitempty"`
+}
+
+// errorResponse is the body of failed requests.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// pathResponse is the body of successful lookpath and file requests.
+type pathResponse struct {
+	Path string `json:"path"`
+}
+
+// ExitError is returned by the client for commands which failed on the agent.
+type ExitError struct {
+	// Code is the exit code of the command, or -1 if it didn't exit normally.
+	Code int
+	// Message is the error reported by the agent.
+	Message string
+}
+
+// ExitCode returns the exit code of the command.
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+func (e *ExitError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ServerTLSConfig returns the TLS config of an agent serving the certificate and requiring client certificates signed
+// by the CA in clientCAFile.
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	pool, err := loadCertPool(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ClientTLSConfig returns the TLS config of a client presenting the certificate and verifying the agent against the
+// CA in caFile.
+func ClientTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	pool, err := loadCertPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// loadCertPool returns a pool with the PEM encoded certificates in the file.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
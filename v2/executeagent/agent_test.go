@@ -0,0 +1,339 @@
+package executeagent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+func newTestAgent(t *testing.T, options ...ServerOption) execute.Executor {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+	server := httptest.NewServer(NewServer(execute.NewExecutor(), append([]ServerOption{WithToken("secret")}, options...)...))
+	t.Cleanup(server.Close)
+	return NewExecutor(NewClient(server.URL, WithBearerToken("secret")))
+}
+
+func TestExecute(t *testing.T) {
+	e := newTestAgent(t)
+	e.SetShell("sh")
+
+	stdout, stderr, err := e.ExecuteSeparate("echo out; echo err >&2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdout != "out\n" || stderr != "err\n" {
+		t.Errorf("unexpected output %q, %q", stdout, stderr)
+	}
+}
+
+func TestExecuteExitCode(t *testing.T) {
+	e := newTestAgent(t)
+	e.SetShell("sh")
+
+	_, err := e.Execute("exit 3")
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("expected exit code 3, got %v", err)
+	}
+
+	e.ClearShell()
+	_, err = e.Execute("this-binary-does-not-exist")
+	if !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("expected exec.ErrNotFound, got %v", err)
+	}
+}
+
+func TestExecuteAsyncWithInput(t *testing.T) {
+	e := newTestAgent(t)
+
+	result, err := e.ExecuteAsyncWithInput("cat", io.NopCloser(strings.NewReader("from the client")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, _ := io.ReadAll(result.Stdout)
+	if err := <-result.Finished; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(out) != "from the client" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	e := newTestAgent(t)
+
+	start := time.Now()
+	_, err := e.ExecuteWithTimeout("sleep 10", 200*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected an error for a command that timed out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the command to be killed, took %v", elapsed)
+	}
+}
+
+func TestExecuteScript(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+	e := newTestAgent(t, WithFileStaging(1, 1<<20))
+
+	stdout, _, err := e.ExecuteScriptFromString(execute.ScriptTypeBash, `echo "$1-$2"`, []string{"a", "b"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdout != "a-b\n" {
+		t.Errorf("unexpected output %q", stdout)
+	}
+}
+
+func TestAllowlistAndPolicy(t *testing.T) {
+	e := newTestAgent(t, WithAllowlist("echo", "sleep"), WithPolicy(func(spec *execute.CommandSpec) error {
+		if len(spec.Args) > 0 && spec.Args[0] == "forbidden" {
+			return errors.New("forbidden argument")
+		}
+		return nil
+	}))
+
+	if _, err := e.Execute("echo allowed"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := e.Execute("sh -c 'echo nope'"); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("expected sh to be rejected, got %v", err)
+	}
+	if _, err := e.Execute("echo forbidden"); err == nil || !strings.Contains(err.Error(), "forbidden argument") {
+		t.Errorf("expected the policy to reject the command, got %v", err)
+	}
+}
+
+func TestClientSettings(t *testing.T) {
+	t.Run("WorkingDir_Rejected", func(t *testing.T) {
+		e := newTestAgent(t)
+		e.SetWorkingDir(t.TempDir())
+		if _, err := e.Execute("pwd"); err == nil || !strings.Contains(err.Error(), "working directory can't be set") {
+			t.Errorf("expected the working directory to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("WorkingDir_Allowed", func(t *testing.T) {
+		dir, err := filepath.EvalSymlinks(t.TempDir())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		e := newTestAgent(t, WithClientWorkingDir())
+		e.SetWorkingDir(dir)
+		if out, err := e.Execute("pwd"); err != nil || out != dir+"\n" {
+			t.Errorf("expected %q, got %q, %v", dir+"\n", out, err)
+		}
+	})
+
+	t.Run("User_Rejected", func(t *testing.T) {
+		e := newTestAgent(t)
+		e.SetUser("nobody")
+		if _, err := e.Execute("id"); err == nil || !strings.Contains(err.Error(), "user can't be set") {
+			t.Errorf("expected the user to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Environment_DeniedVariables", func(t *testing.T) {
+		e := newTestAgent(t)
+		for _, variable := range []string{"LD_PRELOAD=/tmp/evil.so", "BASH_ENV=/tmp/evil.sh", "PATH=/tmp", "DYLD_INSERT_LIBRARIES=/tmp/evil.dylib"} {
+			e.SetEnvironment([]string{"SAFE=1", variable})
+			if _, err := e.Execute("env"); err == nil || !strings.Contains(err.Error(), "can't be set") {
+				t.Errorf("expected %s to be rejected, got %v", variable, err)
+			}
+		}
+		e.SetEnvironment([]string{"SAFE=1"})
+		if out, err := e.Execute("env"); err != nil || out != "SAFE=1\n" {
+			t.Errorf("expected 'SAFE=1\\n', got %q, %v", out, err)
+		}
+	})
+
+	t.Run("Environment_Allowlist", func(t *testing.T) {
+		e := newTestAgent(t, WithEnvAllowlist("GREETING"))
+		e.SetEnvironment([]string{"GREETING=hello"})
+		if out, err := e.Execute("printenv GREETING"); err != nil || out != "hello\n" {
+			t.Errorf("expected 'hello\\n', got %q, %v", out, err)
+		}
+		e.SetEnvironment([]string{"GREETING=hello", "OTHER=1"})
+		if _, err := e.Execute("printenv GREETING"); err == nil || !strings.Contains(err.Error(), "OTHER can't be set") {
+			t.Errorf("expected OTHER to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestFileStaging(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+	newClient := func(t *testing.T, options ...ServerOption) *Client {
+		server := httptest.NewServer(NewServer(execute.NewExecutor(), append([]ServerOption{WithToken("secret")}, options...)...))
+		t.Cleanup(server.Close)
+		return NewClient(server.URL, WithBearerToken("secret"))
+	}
+
+	t.Run("Staging_Disabled", func(t *testing.T) {
+		client := newClient(t)
+		if _, err := client.StageFile([]byte("echo hello"), ".sh", ""); err == nil || !strings.Contains(err.Error(), "not enabled") {
+			t.Errorf("expected staging to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Staging_FileLimit", func(t *testing.T) {
+		client := newClient(t, WithFileStaging(1, 1<<20))
+		path, err := client.StageFile([]byte("echo hello"), ".sh", "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := client.StageFile([]byte("echo hello"), ".sh", ""); err == nil || !strings.Contains(err.Error(), "limit of 1 staged files") {
+			t.Errorf("expected the second file to be rejected, got %v", err)
+		}
+		if err := client.RemoveFile(path); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		path, err = client.StageFile([]byte("echo hello"), ".sh", "")
+		if err != nil {
+			t.Fatalf("expected a file to be staged after removing the first, got %v", err)
+		}
+		client.RemoveFile(path)
+	})
+
+	t.Run("Staging_Quota", func(t *testing.T) {
+		client := newClient(t, WithFileStaging(4, 16))
+		path, err := client.StageFile([]byte("0123456789"), ".sh", "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer client.RemoveFile(path)
+		if _, err := client.StageFile([]byte("0123456789"), ".sh", ""); err == nil || !strings.Contains(err.Error(), "quota of 16 bytes") {
+			t.Errorf("expected the file to exceed the quota, got %v", err)
+		}
+	})
+
+	t.Run("Staging_OwnerRejected", func(t *testing.T) {
+		client := newClient(t, WithFileStaging(1, 1<<20))
+		if _, err := client.StageFile([]byte("echo hello"), ".sh", "nobody"); err == nil || !strings.Contains(err.Error(), "owner of the file can't be set") {
+			t.Errorf("expected the owner to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestExecutorWithoutSpecs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+	// Embedding hides the methods beyond those of execute.Executor
+	executor := struct{ execute.Executor }{execute.NewExecutor()}
+	server := httptest.NewServer(NewServer(executor, WithToken("secret")))
+	defer server.Close()
+
+	_, err := NewExecutor(NewClient(server.URL, WithBearerToken("secret"))).Execute("echo hello")
+	if err == nil || !strings.Contains(err.Error(), "can't execute commands") {
+		t.Errorf("expected the command to be rejected, got %v", err)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+	server := httptest.NewServer(NewServer(execute.NewExecutor(), WithToken("secret")))
+	defer server.Close()
+
+	for _, client := range []*Client{NewClient(server.URL), NewClient(server.URL, WithBearerToken("wrong"))} {
+		if _, err := NewExecutor(client).Execute("echo hello"); err == nil || !strings.Contains(err.Error(), "unauthorized") {
+			t.Errorf("expected the request to be rejected, got %v", err)
+		}
+	}
+
+	// Without any authentication method every request is rejected
+	open := httptest.NewServer(NewServer(execute.NewExecutor()))
+	defer open.Close()
+	if _, err := NewExecutor(NewClient(open.URL)).Execute("echo hello"); err == nil {
+		t.Error("expected the request to be rejected")
+	}
+}
+
+func TestClientCertificates(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+	ca, caKey := newCertificate(t, "ca", nil, nil)
+	serverCert := newKeyPair(t, "127.0.0.1", ca, caKey)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	server := httptest.NewUnstartedServer(NewServer(execute.NewExecutor(), WithClientCertificates("control-plane")))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	for name, expected := range map[string]bool{"control-plane": true, "someone-else": false} {
+		clientCert := newKeyPair(t, name, ca, caKey)
+		client := NewClient(server.URL, WithTLSConfig(&tls.Config{Certificates: []tls.Certificate{clientCert}, RootCAs: pool}))
+		out, err := NewExecutor(client).Execute("echo mtls")
+		if expected && (err != nil || out != "mtls\n") {
+			t.Errorf("%s: unexpected result %q, %v", name, out, err)
+		}
+		if !expected && err == nil {
+			t.Errorf("%s: expected the request to be rejected", name)
+		}
+	}
+}
+
+// newCertificate returns a certificate for the name signed by the parent, or a self-signed CA without a parent.
+func newCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+// newKeyPair returns a TLS certificate for the name signed by the CA.
+func newKeyPair(t *testing.T, name string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) tls.Certificate {
+	cert, key := newCertificate(t, name, ca, caKey)
+	return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}
+}
@@ -0,0 +1,227 @@
+package executeagent
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+func WithBearerToken(token string) ClientOption {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		c.http = client
+	}
+}
+
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(c *Client) {
+		c.http = &http.Client{Transport: &http.Transport{TLSClientConfig: config, ForceAttemptHTTP2: true}}
+	}
+}
+
+// Client is an execute.Transport running processes on an agent.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// NewClient returns a client for the agent at the base URL.
+func NewClient(baseURL string, options ...ClientOption) *Client {
+	c := &Client{baseURL: strings.TrimSuffix(baseURL, "/"), http: http.DefaultClient}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// NewExecutor returns an executor running its commands on the agent. Commands are resolved on the agent and scripts
+// are staged on it, while middleware, hooks, auditing and dry-run mode apply locally.
+func NewExecutor(client *Client, options ...execute.Option) execute.ConfigurableExecutor {
+	e := execute.NewExecutor(options...)
+	e.SetTransport(client)
+	return e
+}
+
+// LookPath resolves the binary on the agent.
+func (c *Client) LookPath(binary string) (string, error) {
+	resp, err := c.do(context.Background(), http.MethodGet, pathLookPath+"?"+url.Values{"binary": {binary}}.Encode(), nil)
+	if err != nil {
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.status == http.StatusNotFound {
+			return "", &exec.Error{Name: binary, Err: exec.ErrNotFound}
+		}
+		return "", err
+	}
+	return decodePath(resp)
+}
+
+// Start starts the process described by the spec on the agent. The input of the process is streamed to the agent
+// while its output is streamed back.
+func (c *Client) Start(ctx context.Context, spec *execute.CommandSpec) (execute.Process, error) {
+	if spec.TTY {
+		return nil, errors.New("commands with a TTY are not supported by the agent")
+	}
+	line, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	var body io.Reader = bytes.NewReader(append(line, '\n'))
+	if spec.Stdin != nil {
+		body = io.MultiReader(body, spec.Stdin)
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, pathExec, body)
+	if err != nil {
+		return nil, err
+	}
+
+	outReader, outWriter := io.Pipe()
+	errReader, errWriter := io.Pipe()
+	p := &process{stdout: outReader, stderr: errReader, done: make(chan struct{})}
+	go p.read(ctx, resp.Body, outWriter, errWriter)
+	return p, nil
+}
+
+// StageFile uploads the data to a new file on the agent. The owner must be empty or the user of the agent's executor.
+func (c *Client) StageFile(data []byte, extension string, owner string) (string, error) {
+	query := url.Values{"extension": {extension}, "owner": {owner}}.Encode()
+	resp, err := c.do(context.Background(), http.MethodPost, pathFiles+"?"+query, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	return decodePath(resp)
+}
+
+// RemoveFile removes a file staged by StageFile.
+func (c *Client) RemoveFile(path string) error {
+	resp, err := c.do(context.Background(), http.MethodDelete, pathFiles+"?"+url.Values{"path": {path}}.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends an authenticated request to the agent and returns the response of successful requests.
+func (c *Client) do(ctx context.Context, method string, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("agent request failed: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		var body errorResponse
+		json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body)
+		if body.Error == "" {
+			body.Error = http.StatusText(resp.StatusCode)
+		}
+		return nil, &statusError{status: resp.StatusCode, message: body.Error}
+	}
+	return resp, nil
+}
+
+// decodePath returns the path in the body of the response.
+func decodePath(resp *http.Response) (string, error) {
+	defer resp.Body.Close()
+	var body pathResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid agent response: %w", err)
+	}
+	return body.Path, nil
+}
+
+// statusError is returned for requests rejected by the agent.
+type statusError struct {
+	status  int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("agent: %s (%d)", e.message, e.status)
+}
+
+// process is a process running on the agent.
+type process struct {
+	stdout io.Reader
+	stderr io.Reader
+	done   chan struct{}
+	err    error
+}
+
+// Stdout returns the stdout of the process.
+func (p *process) Stdout() io.Reader {
+	return p.stdout
+}
+
+// Stderr returns the stderr of the process.
+func (p *process) Stderr() io.Reader {
+	return p.stderr
+}
+
+// Wait waits for the process to exit.
+func (p *process) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// read demultiplexes the events of the execution into the output of the process until its exit status arrives.
+func (p *process) read(ctx context.Context, body io.ReadCloser, stdout *io.PipeWriter, stderr *io.PipeWriter) {
+	defer close(p.done)
+	defer body.Close()
+	defer stdout.Close()
+	defer stderr.Close()
+
+	decoder := json.NewDecoder(body)
+	for {
+		var e event
+		if err := decoder.Decode(&e); err != nil {
+			if ctx.Err() != nil {
+				p.err = &ExitError{Code: -1, Message: "killed: " + ctx.Err().Error()}
+			} else {
+				p.err = fmt.Errorf("lost connection to the agent: %w", err)
+			}
+			return
+		}
+		switch {
+		case e.Exit != nil:
+			if e.Exit.Code != 0 || e.Exit.Error != "" {
+				p.err = &ExitError{Code: e.Exit.Code, Message: e.Exit.Error}
+			}
+			return
+		case e.Stream == "stdout":
+			stdout.Write(e.Data)
+		case e.Stream == "stderr":
+			stderr.Write(e.Data)
+		}
+	}
+}
+
+// Ensure the Client implements the execute.FileTransport interface.
+var _ execute.FileTransport = (*Client)(nil)
@@ -0,0 +1,563 @@
+package executeagent
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+// maxFileSize is the maximum size of files staged on the agent.
+const maxFileSize = 64 << 20
+
+// fileExtension matches the extensions accepted for staged files.
+var fileExtension = regexp.MustCompile(`^(\.[A-Za-z0-9]+)?$`)
+
+// deniedEnv lists the variables clients may not set without an environment allowlist, as they change which code the
+// dynamic loader, the shell or an interpreter runs.
+var deniedEnv = []string{
+	"PATH", "IFS", "ENV", "BASH_ENV", "SHELLOPTS", "BASHOPTS", "PS4", "PROMPT_COMMAND", "CDPATH", "GLOBIGNORE",
+	"PYTHONPATH", "PYTHONHOME", "PYTHONSTARTUP", "PERL5LIB", "PERL5OPT", "PERLLIB", "RUBYLIB", "RUBYOPT",
+	"NODE_OPTIONS", "GCONV_PATH",
+}
+
+// deniedEnvPrefixes lists the prefixes of the variables clients may not set without an environment allowlist.
+var deniedEnvPrefixes = []string{"LD_", "DYLD_", "BASH_FUNC_"}
+
+// Policy decides whether a command may be executed. The path of the spec has already been resolved. Returning an
+// error rejects the command.
+type Policy func(spec *execute.CommandSpec) error
+
+// ServerOption configures a Server.
+type ServerOption func(*Server)
+
+func WithToken(token string) ServerOption {
+	return func(s *Server) {
+		s.token = []byte(token)
+	}
+}
+
+func WithClientCertificates(names ...string) ServerOption {
+	return func(s *Server) {
+		s.certAuth = true
+		s.certNames = append(s.certNames, names...)
+	}
+}
+
+func WithAllowlist(binaries ...string) ServerOption {
+	return func(s *Server) {
+		s.allowlist = append(s.allowlist, binaries...)
+	}
+}
+
+func WithPolicy(policy Policy) ServerOption {
+	return func(s *Server) {
+		s.policies = append(s.policies, policy)
+	}
+}
+
+func WithEnvAllowlist(names ...string) ServerOption {
+	return func(s *Server) {
+		s.envAllowlist = append(s.envAllowlist, names...)
+	}
+}
+
+func WithClientWorkingDir() ServerOption {
+	return func(s *Server) {
+		s.clientDir = true
+	}
+}
+
+func WithClientUser() ServerOption {
+	return func(s *Server) {
+		s.clientUser = true
+	}
+}
+
+func WithFileStaging(maxFiles int, maxBytes int64) ServerOption {
+	return func(s *Server) {
+		s.maxFiles = maxFiles
+		s.maxBytes = maxBytes
+	}
+}
+
+// Server is an http.Handler exposing an executor to clients.
+//
+// Requests are authenticated with the bearer token set by WithToken or a verified client certificate when enabled by
+// WithClientCertificates; without either, all requests are rejected. When an allowlist is set only the binaries on it
+// may be executed, and every command must pass the policies. Note that allowing a shell or an interpreter allows any
+// command to be executed through it.
+//
+// Commands run through ExecuteSpecAsync, so the executor must implement execute.SpecExecutor, and the middleware,
+// hooks, audit sink and user of the executor apply. The environment is taken from the request, but only the variables
+// on the allowlist set by WithEnvAllowlist are accepted, or without one any variable except those of the dynamic
+// loader, the shell and interpreters such as LD_PRELOAD, BASH_ENV and PATH. Requests setting the working directory or
+// the user are rejected unless WithClientWorkingDir or WithClientUser allow it; the user must still be the user of
+// the executor. Files for scripts can only be staged once WithFileStaging sets how many files and bytes may be staged
+// at the same time.
+type Server struct {
+	executor     execute.Executor
+	token        []byte
+	certAuth     bool
+	certNames    []string
+	allowlist    []string
+	policies     []Policy
+	envAllowlist []string
+	clientDir    bool
+	clientUser   bool
+	maxFiles     int
+	maxBytes     int64
+	mux          *http.ServeMux
+
+	mu         sync.Mutex
+	files      map[string]stagedFile
+	pending    int
+	stagedSize int64
+}
+
+// stagedFile is a file staged by stageFile.
+type stagedFile struct {
+	dir  string
+	size int64
+}
+
+// NewServer returns a Server exposing the executor.
+func NewServer(executor execute.Executor, options ...ServerOption) *Server {
+	s := &Server{executor: executor, files: map[string]stagedFile{}}
+	for _, option := range options {
+		option(s)
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc(pathLookPath, s.handleLookPath)
+	s.mux.HandleFunc(pathExec, s.handleExec)
+	s.mux.HandleFunc(pathFiles, s.handleFiles)
+	return s
+}
+
+// ServeHTTP authenticates the request and dispatches it to its handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticated(r) {
+		s.logger().Warn("rejected unauthenticated agent request", "remote", r.RemoteAddr, "path", r.URL.Path)
+		writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// authenticated returns whether the request carries the token or a permitted client certificate.
+func (s *Server) authenticated(r *http.Request) bool {
+	if len(s.token) > 0 {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), s.token) == 1 {
+			return true
+		}
+	}
+	if s.certAuth && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		if len(s.certNames) == 0 {
+			return true
+		}
+		leaf := r.TLS.VerifiedChains[0][0]
+		for _, name := range s.certNames {
+			if leaf.Subject.CommonName == name {
+				return true
+			}
+			for _, dnsName := range leaf.DNSNames {
+				if dnsName == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// handleLookPath resolves a binary on the agent.
+func (s *Server) handleLookPath(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	path, err := s.lookPath(r.URL.Query().Get("binary"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if !s.allowed(path) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("%s is not allowed", path))
+		return
+	}
+	writeJSON(w, http.StatusOK, pathResponse{Path: path})
+}
+
+// handleExec executes the command described by the spec in the first line of the body. The rest of the body is the
+// input of the command, and its output is streamed back as events.
+func (s *Server) handleExec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	specs, ok := s.executor.(execute.SpecExecutor)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, errors.New("the executor of the agent can't execute commands"))
+		return
+	}
+	// The input is read while the output is written, which HTTP/1 servers don't allow by default
+	http.NewResponseController(w).EnableFullDuplex()
+
+	body := bufio.NewReader(r.Body)
+	line, err := body.ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to read the command: %w", err))
+		return
+	}
+	spec := &execute.CommandSpec{}
+	if err := json.Unmarshal(line, spec); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid command: %w", err))
+		return
+	}
+	if spec.TTY {
+		writeError(w, http.StatusBadRequest, errors.New("commands with a TTY are not supported by the agent"))
+		return
+	}
+
+	spec.Path, err = s.lookPath(spec.Path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err := s.authorize(spec); err != nil {
+		s.logger().Warn("rejected agent command", "remote", r.RemoteAddr, "path", spec.Path, "error", err)
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	spec.Stdin = body
+
+	result, err := specs.ExecuteSpecAsync(r.Context(), spec)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeNDJSON)
+	w.WriteHeader(http.StatusOK)
+	stream := &eventWriter{w: w, encoder: json.NewEncoder(w), flusher: http.NewResponseController(w)}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go stream.copy(&wg, "stdout", result.Stdout)
+	go stream.copy(&wg, "stderr", result.Stderr)
+	wg.Wait()
+
+	err = <-result.Finished
+	status := &exitStatus{Code: execute.ExitCode(err)}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	stream.write(event{Exit: status})
+}
+
+// handleFiles stages files for scripts on the agent and removes them again.
+func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		path, err := s.stageFile(http.MaxBytesReader(w, r.Body, maxFileSize), r.URL.Query().Get("extension"), r.URL.Query().Get("owner"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, pathResponse{Path: path})
+	case http.MethodDelete:
+		if err := s.removeFile(r.URL.Query().Get("path")); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// logger returns the logger of the executor, or the global logger when the executor doesn't have one.
+func (s *Server) logger() execute.Logger {
+	if e, ok := s.executor.(interface{ Logger() execute.Logger }); ok {
+		return e.Logger()
+	}
+	return execute.GetLogger()
+}
+
+// transport returns the transport of the executor, nil when it runs commands locally.
+func (s *Server) transport() execute.Transport {
+	if e, ok := s.executor.(interface{ Transport() execute.Transport }); ok {
+		return e.Transport()
+	}
+	return nil
+}
+
+// scriptDir returns the script directory of the executor, empty for the default temporary directory.
+func (s *Server) scriptDir() string {
+	if e, ok := s.executor.(interface{ ScriptDir() string }); ok {
+		return e.ScriptDir()
+	}
+	return ""
+}
+
+// lookPath resolves the binary through the transport of the executor or locally.
+func (s *Server) lookPath(binary string) (string, error) {
+	if binary == "" {
+		return "", errors.New("empty command")
+	}
+	if transport := s.transport(); transport != nil {
+		return transport.LookPath(binary)
+	}
+	return exec.LookPath(binary)
+}
+
+// authorize checks the command against the allowlist, the settings the client may choose and the policies.
+func (s *Server) authorize(spec *execute.CommandSpec) error {
+	if !s.allowed(spec.Path) {
+		return fmt.Errorf("%s is not allowed", spec.Path)
+	}
+	if spec.Dir != "" && !s.clientDir {
+		return errors.New("the working directory can't be set")
+	}
+	if spec.User != "" && !s.clientUser {
+		return errors.New("the user can't be set")
+	}
+	for _, variable := range append(append([]string(nil), spec.Env...), spec.ExtraEnv...) {
+		name, _, _ := strings.Cut(variable, "=")
+		if !s.envAllowed(name) {
+			return fmt.Errorf("the environment variable %s can't be set", name)
+		}
+	}
+	for _, policy := range s.policies {
+		if err := policy(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allowed returns whether the binary is on the allowlist, by path or by name.
+func (s *Server) allowed(path string) bool {
+	if len(s.allowlist) == 0 {
+		return true
+	}
+	name := filepath.Base(path)
+	if runtime.GOOS == "windows" {
+		name = strings.TrimSuffix(strings.ToLower(name), ".exe")
+	}
+	for _, allowed := range s.allowlist {
+		if allowed == path || allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// envAllowed returns whether clients may set the environment variable.
+func (s *Server) envAllowed(name string) bool {
+	if runtime.GOOS == "windows" {
+		name = strings.ToUpper(name)
+	}
+	if len(s.envAllowlist) > 0 {
+		for _, allowed := range s.envAllowlist {
+			if allowed == name || runtime.GOOS == "windows" && strings.ToUpper(allowed) == name {
+				return true
+			}
+		}
+		return false
+	}
+	for _, denied := range deniedEnv {
+		if denied == name {
+			return false
+		}
+	}
+	for _, prefix := range deniedEnvPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// stageFile writes the data to a new file in a private temporary directory within the script directory of the
+// executor. Files can only be staged for the user of the executor and within the limits set by WithFileStaging.
+func (s *Server) stageFile(data io.Reader, extension string, owner string) (path string, err error) {
+	if !fileExtension.MatchString(extension) {
+		return "", fmt.Errorf("invalid extension: %q", extension)
+	}
+	runAs := s.executor.User()
+	if owner != "" && !s.clientUser {
+		return "", errors.New("the owner of the file can't be set")
+	}
+	if owner != "" && owner != runAs {
+		return "", fmt.Errorf("files can't be staged for %s, the agent runs commands as %q", owner, runAs)
+	}
+
+	remaining, err := s.reserveFile()
+	if err != nil {
+		return "", err
+	}
+	defer s.releaseFile()
+
+	dir, err := os.MkdirTemp(s.scriptDir(), "go-execute-agent-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	path = filepath.Join(dir, "script"+extension)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0700)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	size, err := io.Copy(f, io.LimitReader(data, remaining+1))
+	if err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if runAs != "" {
+		if err = chown(runAs, dir, path); err != nil {
+			return "", fmt.Errorf("failed to grant %s access to the file: %w", runAs, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stagedSize+size > s.maxBytes {
+		err = fmt.Errorf("the staged files would exceed the quota of %d bytes", s.maxBytes)
+		return "", err
+	}
+	s.stagedSize += size
+	s.files[path] = stagedFile{dir: dir, size: size}
+	return path, nil
+}
+
+// reserveFile counts a file which is being staged against the limit of files and returns how many bytes may still be
+// staged.
+func (s *Server) reserveFile() (remaining int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxFiles <= 0 {
+		return 0, errors.New("file staging is not enabled")
+	}
+	if len(s.files)+s.pending >= s.maxFiles {
+		return 0, fmt.Errorf("the limit of %d staged files has been reached", s.maxFiles)
+	}
+	s.pending++
+	return s.maxBytes - s.stagedSize, nil
+}
+
+// releaseFile stops counting a file reserved by reserveFile once it was staged or failed to be.
+func (s *Server) releaseFile() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending--
+}
+
+// removeFile removes a file staged by stageFile together with its directory.
+func (s *Server) removeFile(path string) error {
+	s.mu.Lock()
+	file, ok := s.files[path]
+	delete(s.files, path)
+	s.stagedSize -= file.size
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown file: %q", path)
+	}
+	return os.RemoveAll(file.dir)
+}
+
+// chown hands the files over to the user.
+func chown(username string, paths ...string) error {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("unsupported user id %q", u.Uid)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return fmt.Errorf("unsupported group id %q", u.Gid)
+	}
+	for _, path := range paths {
+		if err := os.Chown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eventWriter writes the events of an execution to the response.
+type eventWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	encoder *json.Encoder
+	flusher *http.ResponseController
+}
+
+// write writes the event and flushes it to the client.
+func (s *eventWriter) write(e event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.encoder.Encode(e); err != nil {
+		return err
+	}
+	return s.flusher.Flush()
+}
+
+// copy streams the output as events until it is closed. Output is still drained after the client went away so the
+// process isn't blocked.
+func (s *eventWriter) copy(wg *sync.WaitGroup, stream string, r io.Reader) {
+	defer wg.Done()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			s.write(event{Stream: stream, Data: append([]byte(nil), buf[:n]...)})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeJSON writes the value as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError writes the error as the JSON body of the response.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// Ensure the Server implements the http.Handler interface.
+var _ http.Handler = (*Server)(nil)
@@ -0,0 +1,347 @@
+// Package executebatch runs batches of independent commands concurrently with a bounded number of workers.
+//
+// Run executes every command of the batch with the executor, at most a limited number at a time, and returns a report
+// with the result of every command and statistics about the batch:
+//
+//	report, err := executebatch.Run(ctx, executor, hosts, executebatch.WithParallelism(8), executebatch.WithFailFast())
+//	for _, result := range report.Results {
+//		fmt.Println(result.Command, result.State, result.Duration())
+//	}
+//	fmt.Printf("%d of %d failed in %s\n", report.Stats.Failed, report.Stats.Total, report.Stats.Elapsed)
+package executebatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+// ErrCommandFailed is wrapped by the error returned by Run when a command failed.
+var ErrCommandFailed = errors.New("command failed")
+
+// State is the final state of a command.
+type State string
+
+const (
+	// Succeeded is the state of a command that exited with exit code 0.
+	Succeeded State = "succeeded"
+	// Failed is the state of a command that failed to start, timed out or exited with a non-zero exit code.
+	Failed State = "failed"
+	// Cancelled is the state of a command that wasn't started or was killed because the batch was stopped, either
+	// after another command failed in fail-fast mode or because the context was cancelled.
+	Cancelled State = "cancelled"
+)
+
+// Order is the order results are reported in.
+type Order int
+
+const (
+	// InputOrder reports results in the order of the commands passed to Run.
+	InputOrder Order = iota
+	// CompletionOrder reports results in the order the commands finished.
+	CompletionOrder
+)
+
+// Result is the outcome of a command of a batch.
+type Result struct {
+	// Index is the position of the command in the batch.
+	Index int
+	// Command is the command.
+	Command string
+	// State is the final state of the command.
+	State State
+	// StartTime and EndTime are the times the command was started and finished. They are zero for commands that
+	// weren't started.
+	StartTime time.Time
+	EndTime   time.Time
+	// Stdout and Stderr are the output of the command.
+	Stdout string
+	Stderr string
+	// ExitCode is the exit code of the command, or -1 if it didn't exit normally or wasn't started.
+	ExitCode int
+	// Err is the error of the command, nil if it succeeded.
+	Err error
+}
+
+// Duration returns how long the command was running.
+func (r *Result) Duration() time.Duration {
+	return r.EndTime.Sub(r.StartTime)
+}
+
+// Stats are aggregate statistics of a batch.
+type Stats struct {
+	// Total is the number of commands in the batch, and Succeeded, Failed and Cancelled the number of commands in
+	// each state.
+	Total     int
+	Succeeded int
+	Failed    int
+	Cancelled int
+	// Elapsed is the wall-clock time the batch took.
+	Elapsed time.Duration
+	// TotalDuration is the sum of the durations of all commands that were started, and MinDuration, MaxDuration and
+	// MeanDuration describe their distribution.
+	TotalDuration time.Duration
+	MinDuration   time.Duration
+	MaxDuration   time.Duration
+	MeanDuration  time.Duration
+}
+
+// add records the result in the statistics.
+func (s *Stats) add(result *Result) {
+	switch result.State {
+	case Succeeded:
+		s.Succeeded++
+	case Failed:
+		s.Failed++
+	case Cancelled:
+		s.Cancelled++
+	}
+	if result.StartTime.IsZero() {
+		return
+	}
+	duration := result.Duration()
+	s.TotalDuration += duration
+	if s.MinDuration == 0 || duration < s.MinDuration {
+		s.MinDuration = duration
+	}
+	if duration > s.MaxDuration {
+		s.MaxDuration = duration
+	}
+}
+
+// Report is the outcome of a batch.
+type Report struct {
+	// Results are the results of all commands, in the order configured with WithOrder.
+	Results []*Result
+	// Stats are the statistics of the batch.
+	Stats Stats
+	// StartTime and EndTime are the times the batch was started and finished.
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// Succeeded returns whether every command succeeded.
+func (r *Report) Succeeded() bool {
+	return r.Stats.Succeeded == r.Stats.Total
+}
+
+// Failed returns the results of the commands that failed.
+func (r *Report) Failed() []*Result {
+	var failed []*Result
+	for _, result := range r.Results {
+		if result.State == Failed {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Option configures a batch.
+type Option func(b *batch)
+
+// WithParallelism sets the maximum number of commands running at the same time, which defaults to the number of CPUs.
+// A limit of 0 or less runs all commands at once.
+func WithParallelism(limit int) Option {
+	return func(b *batch) {
+		b.parallelism = limit
+	}
+}
+
+// WithFailFast stops the batch as soon as a command fails: commands that haven't been started are cancelled and
+// running commands are killed. By default every command runs regardless of the others.
+func WithFailFast() Option {
+	return func(b *batch) {
+		b.failFast = true
+	}
+}
+
+// WithTimeout sets the timeout of every command, 0 means no timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(b *batch) {
+		b.timeout = timeout
+	}
+}
+
+// WithOrder sets the order of the results in the report and of the calls to the result handler. InputOrder, the
+// default, holds back the results of commands that finished before the ones preceding them in the batch.
+func WithOrder(order Order) Option {
+	return func(b *batch) {
+		b.order = order
+	}
+}
+
+// WithResultHandler sets a function which is called with the result of every command, in the order configured with
+// WithOrder. It is called from the goroutine running the batch, so it should return quickly.
+func WithResultHandler(handler func(result *Result)) Option {
+	return func(b *batch) {
+		b.handler = handler
+	}
+}
+
+// batch is the state of a run of a batch.
+type batch struct {
+	executor    execute.Executor
+	commands    []string
+	parallelism int
+	failFast    bool
+	timeout     time.Duration
+	order       Order
+	handler     func(result *Result)
+
+	results  []*Result
+	reported []*Result
+	next     int
+}
+
+// Run executes the commands with the executor and returns the report once every command has finished or was
+// cancelled. The returned error wraps ErrCommandFailed when a command failed, or is the error of the context when it
+// was cancelled before all commands succeeded.
+func Run(ctx context.Context, executor execute.Executor, commands []string, options ...Option) (*Report, error) {
+	b := &batch{
+		executor:    executor,
+		commands:    commands,
+		parallelism: runtime.NumCPU(),
+		results:     make([]*Result, len(commands)),
+	}
+	for _, option := range options {
+		option(b)
+	}
+	workers := b.parallelism
+	if workers <= 0 || workers > len(commands) {
+		workers = len(commands)
+	}
+
+	report := &Report{StartTime: time.Now(), Stats: Stats{Total: len(commands)}}
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indexes := make(chan int)
+	done := make(chan *Result)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				result := b.run(ctx, i)
+				// The batch is stopped before the worker takes the next command
+				if result.State == Failed && b.failFast {
+					cancel()
+				}
+				done <- result
+			}
+		}()
+	}
+	go func() {
+		defer close(indexes)
+		for i := range commands {
+			indexes <- i
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for result := range done {
+		b.finish(result, &report.Stats)
+	}
+
+	report.EndTime = time.Now()
+	report.Results = b.reported
+	report.Stats.Elapsed = report.EndTime.Sub(report.StartTime)
+	if started := len(commands) - b.unstarted(); started > 0 {
+		report.Stats.MeanDuration = report.Stats.TotalDuration / time.Duration(started)
+	}
+	if report.Stats.Failed > 0 {
+		return report, fmt.Errorf("%w: %d of %d commands failed", ErrCommandFailed, report.Stats.Failed, report.Stats.Total)
+	}
+	if err := parent.Err(); err != nil && !report.Succeeded() {
+		return report, err
+	}
+	return report, nil
+}
+
+// finish records the result and reports it, along with the results it has been holding back in input order.
+func (b *batch) finish(result *Result, stats *Stats) {
+	b.results[result.Index] = result
+	stats.add(result)
+	if b.order == CompletionOrder {
+		b.report(result)
+		return
+	}
+	for b.next < len(b.results) && b.results[b.next] != nil {
+		b.report(b.results[b.next])
+		b.next++
+	}
+}
+
+// report passes the result to the handler and adds it to the report.
+func (b *batch) report(result *Result) {
+	b.reported = append(b.reported, result)
+	if b.handler != nil {
+		b.handler(result)
+	}
+}
+
+// unstarted returns the number of commands that weren't started.
+func (b *batch) unstarted() int {
+	n := 0
+	for _, result := range b.results {
+		if result.StartTime.IsZero() {
+			n++
+		}
+	}
+	return n
+}
+
+// run executes the command at the index, or cancels it when the batch has been stopped.
+func (b *batch) run(ctx context.Context, i int) *Result {
+	result := &Result{Index: i, Command: b.commands[i]}
+	if err := ctx.Err(); err != nil {
+		result.State, result.ExitCode, result.Err = Cancelled, -1, err
+		return result
+	}
+
+	result.StartTime = time.Now()
+	var err error
+	result.Stdout, result.Stderr, err = b.execute(ctx, result.Command)
+	result.EndTime = time.Now()
+	result.ExitCode = execute.ExitCode(err)
+	result.Err = err
+	switch {
+	case err == nil:
+		result.State = Succeeded
+	case stopped(ctx, err):
+		result.State = Cancelled
+	default:
+		result.State = Failed
+	}
+	return result
+}
+
+// stopped returns whether the command failed because the batch was stopped: the context is done and the error was
+// caused by it or the process was killed by a signal, which is reported as exit code -1. Commands that exited with an
+// exit code of their own failed, even when the batch was stopped in the meantime.
+func stopped(ctx context.Context, err error) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || execute.ExitCode(err) == -1
+}
+
+// execute executes the command, which is killed when the context is cancelled.
+func (b *batch) execute(ctx context.Context, command string) (string, string, error) {
+	if b.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+		defer cancel()
+	}
+	return execute.Collect(ctx, b.executor, command)
+}
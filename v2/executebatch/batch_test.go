@@ -0,0 +1,142 @@
+package executebatch
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+	executor := execute.NewExecutor(execute.WithShell("sh"))
+
+	t.Run("Run_LimitsParallelism", func(t *testing.T) {
+		var mu sync.Mutex
+		running, peak := 0, 0
+		counter := func(next execute.RunFunc) execute.RunFunc {
+			return func(spec *execute.CommandSpec) (*execute.ExecutionResult, error) {
+				mu.Lock()
+				running++
+				if running > peak {
+					peak = running
+				}
+				mu.Unlock()
+				spec.OnExit(func(result *execute.Result) {
+					mu.Lock()
+					running--
+					mu.Unlock()
+				})
+				return next(spec)
+			}
+		}
+		executor := execute.NewExecutor(execute.WithShell("sh"), execute.WithMiddleware(counter))
+		commands := []string{"sleep 0.1", "sleep 0.1", "sleep 0.1", "sleep 0.1", "sleep 0.1", "sleep 0.1"}
+
+		report, err := Run(context.Background(), executor, commands, WithParallelism(2))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if peak != 2 {
+			t.Errorf("Expected at most 2 commands at the same time, but got %d", peak)
+		}
+		if report.Stats.Succeeded != 6 || report.Stats.Elapsed < 300*time.Millisecond {
+			t.Errorf("Expected 6 commands to succeed in 3 rounds, but got %+v", report.Stats)
+		}
+		if report.Stats.MinDuration <= 0 || report.Stats.MeanDuration < report.Stats.MinDuration || report.Stats.MaxDuration < report.Stats.MeanDuration {
+			t.Errorf("Unexpected durations: %+v", report.Stats)
+		}
+	})
+
+	t.Run("Run_ReportsInOrder", func(t *testing.T) {
+		commands := []string{"sleep 0.2; echo slow", "echo fast"}
+		for _, order := range []Order{InputOrder, CompletionOrder} {
+			var handled []int
+			report, err := Run(context.Background(), executor, commands, WithParallelism(2), WithOrder(order), WithResultHandler(func(result *Result) {
+				handled = append(handled, result.Index)
+			}))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			expected := []int{0, 1}
+			if order == CompletionOrder {
+				expected = []int{1, 0}
+			}
+			for i, index := range expected {
+				if handled[i] != index || report.Results[i].Index != index {
+					t.Errorf("Order %d: expected results %v, but got %v", order, expected, handled)
+					break
+				}
+			}
+			if report.Results[0].Stdout == "" {
+				t.Errorf("Order %d: expected output, but got none", order)
+			}
+		}
+	})
+
+	t.Run("Run_FailsFast", func(t *testing.T) {
+		commands := []string{"exit 3", "exec sleep 5", "true", "true"}
+
+		start := time.Now()
+		report, err := Run(context.Background(), executor, commands, WithParallelism(2), WithFailFast())
+		if !errors.Is(err, ErrCommandFailed) {
+			t.Errorf("Expected ErrCommandFailed, but got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("Expected the running command to be killed, but the batch took %s", elapsed)
+		}
+		expected := []State{Failed, Cancelled, Cancelled, Cancelled}
+		for i, state := range expected {
+			if report.Results[i].State != state {
+				t.Errorf("Expected command %d to be %s, but got %s", i, state, report.Results[i].State)
+			}
+		}
+		if report.Results[0].ExitCode != 3 || report.Stats.Failed != 1 || report.Stats.Cancelled != 3 {
+			t.Errorf("Unexpected results: exit code %d, stats %+v", report.Results[0].ExitCode, report.Stats)
+		}
+	})
+
+	t.Run("Run_FailsFastKeepsExitCodesOfFailures", func(t *testing.T) {
+		// Without ContextExecutor the running command isn't killed and exits with its own exit code after the batch
+		// was stopped
+		plain := struct{ execute.Executor }{executor}
+		report, err := Run(context.Background(), plain, []string{"exit 3", "sleep 0.3; exit 4"}, WithParallelism(2), WithFailFast())
+		if !errors.Is(err, ErrCommandFailed) {
+			t.Errorf("Expected ErrCommandFailed, but got %v", err)
+		}
+		if result := report.Results[1]; result.State != Failed || result.ExitCode != 4 {
+			t.Errorf("Expected command 1 to fail with exit code 4, but got %s with %d", result.State, result.ExitCode)
+		}
+		if report.Stats.Failed != 2 || report.Stats.Cancelled != 0 {
+			t.Errorf("Expected both commands to fail, but got %+v", report.Stats)
+		}
+	})
+
+	t.Run("Run_ContinuesAfterFailures", func(t *testing.T) {
+		report, err := Run(context.Background(), executor, []string{"exit 1", "true", "exit 2"}, WithParallelism(1))
+		if !errors.Is(err, ErrCommandFailed) {
+			t.Errorf("Expected ErrCommandFailed, but got %v", err)
+		}
+		if report.Stats.Succeeded != 1 || report.Stats.Failed != 2 || len(report.Failed()) != 2 {
+			t.Errorf("Expected 1 command to succeed and 2 to fail, but got %+v", report.Stats)
+		}
+	})
+
+	t.Run("Run_StopsWhenContextIsDone", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		report, err := Run(ctx, executor, []string{"exec sleep 5", "true"}, WithParallelism(1))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected deadline exceeded, but got %v", err)
+		}
+		if report.Stats.Cancelled != 2 {
+			t.Errorf("Expected both commands to be cancelled, but got %+v", report.Stats)
+		}
+	})
+}
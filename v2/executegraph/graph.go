@@ -0,0 +1,224 @@
+// Package executegraph runs commands and scripts that depend on each other as a graph of tasks.
+//
+// Tasks are added to a Graph with the names of the tasks they depend on. Running the graph starts every task once all
+// of its dependencies have succeeded, runs independent tasks in parallel and returns a report with the outcome of
+// every task:
+//
+//	g := executegraph.New()
+//	g.Add(executegraph.Task{Name: "packages", Command: "apt-get install -y nginx"})
+//	g.Add(executegraph.Task{Name: "users", Command: "useradd deploy"})
+//	g.Add(executegraph.Task{Name: "config", Command: "cp nginx.conf /etc/nginx/", DependsOn: []string{"packages"}})
+//	g.Add(executegraph.Task{Name: "start", Command: "systemctl restart nginx", DependsOn: []string{"config", "users"}})
+//	report, err := g.Run(ctx, executor, executegraph.WithParallelism(4))
+//	for _, task := range report.Tasks {
+//		fmt.Println(task.Name, task.State, task.Duration())
+//	}
+package executegraph
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+// ErrTaskFailed is wrapped by the error returned by Run when a task failed.
+var ErrTaskFailed = errors.New("task failed")
+
+// Task is a node of the graph which executes a command or a script.
+type Task struct {
+	// Name uniquely identifies the task within the graph.
+	Name string
+	// Command is the command executed by the task. Exactly one of Command and Script must be set.
+	Command string
+	// Script is the script executed by the task, with the type, arguments and parameters below.
+	Script     string
+	ScriptType execute.ScriptType
+	Arguments  []string
+	Parameters map[string]string
+	// DependsOn are the names of the tasks which must succeed before the task is started.
+	DependsOn []string
+	// Timeout is the timeout of every attempt of the task, 0 means no timeout.
+	Timeout time.Duration
+	// Retries is the number of times the task is retried after it failed, waiting RetryDelay before every retry.
+	Retries    int
+	RetryDelay time.Duration
+	// Executor executes the task instead of the executor passed to Run, e.g. to run it as a different user.
+	Executor execute.Executor
+}
+
+// TaskState is the final state of a task.
+type TaskState string
+
+const (
+	// TaskSucceeded is the state of a task that exited with exit code 0.
+	TaskSucceeded TaskState = "succeeded"
+	// TaskFailed is the state of a task that failed to start, timed out or exited with a non-zero exit code.
+	TaskFailed TaskState = "failed"
+	// TaskSkipped is the state of a task that wasn't started because one of its dependencies didn't succeed.
+	TaskSkipped TaskState = "skipped"
+	// TaskCancelled is the state of a task that wasn't started or was killed because the run was stopped, either
+	// after another task failed in fail-fast mode or because the context was cancelled.
+	TaskCancelled TaskState = "cancelled"
+)
+
+// TaskResult is the outcome of a task.
+type TaskResult struct {
+	// Name is the name of the task.
+	Name string
+	// State is the final state of the task.
+	State TaskState
+	// StartTime and EndTime are the times the first attempt of the task was started and the last one finished. They
+	// are zero for tasks that weren't started.
+	StartTime time.Time
+	EndTime   time.Time
+	// Stdout and Stderr are the output of the task.
+	Stdout string
+	Stderr string
+	// ExitCode is the exit code of the task, or -1 if it didn't exit normally or wasn't started.
+	ExitCode int
+	// Attempts is the number of times the task was started, which is more than one when it was retried.
+	Attempts int
+	// Err is the error the task failed with.
+	Err error
+	// SkippedBecause is the name of the dependency that didn't succeed when the task was skipped.
+	SkippedBecause string
+}
+
+// Duration returns how long the task was running.
+func (r *TaskResult) Duration() time.Duration {
+	return r.EndTime.Sub(r.StartTime)
+}
+
+// Report is the outcome of running a graph.
+type Report struct {
+	// Tasks are the results of the tasks in the order they were added to the graph.
+	Tasks []*TaskResult
+	// StartTime and EndTime are the times the run was started and finished.
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// Task returns the result of the task with the name, or nil if there is no such task.
+func (r *Report) Task(name string) *TaskResult {
+	for _, task := range r.Tasks {
+		if task.Name == name {
+			return task
+		}
+	}
+	return nil
+}
+
+// Succeeded returns whether all tasks succeeded.
+func (r *Report) Succeeded() bool {
+	for _, task := range r.Tasks {
+		if task.State != TaskSucceeded {
+			return false
+		}
+	}
+	return true
+}
+
+// Failed returns the results of the tasks that failed.
+func (r *Report) Failed() []*TaskResult {
+	var failed []*TaskResult
+	for _, task := range r.Tasks {
+		if task.State == TaskFailed {
+			failed = append(failed, task)
+		}
+	}
+	return failed
+}
+
+// Graph is a set of tasks and their dependencies. A graph can be run more than once, but it must not be modified
+// while it is running.
+type Graph struct {
+	tasks []*Task
+	index map[string]int
+}
+
+// New returns an empty graph.
+func New() *Graph {
+	return &Graph{index: make(map[string]int)}
+}
+
+// Add adds the task to the graph. Dependencies may refer to tasks that are added later.
+func (g *Graph) Add(task Task) error {
+	switch {
+	case task.Name == "":
+		return errors.New("task name is empty")
+	case task.Command == "" && task.Script == "":
+		return fmt.Errorf("task %s: either a command or a script is required", task.Name)
+	case task.Command != "" && task.Script != "":
+		return fmt.Errorf("task %s: a task can't have both a command and a script", task.Name)
+	case task.Script != "" && task.ScriptType == "":
+		return fmt.Errorf("task %s: script type is empty", task.Name)
+	case task.Retries < 0:
+		return fmt.Errorf("task %s: retries is negative", task.Name)
+	}
+	if _, ok := g.index[task.Name]; ok {
+		return fmt.Errorf("task %s already exists", task.Name)
+	}
+	g.index[task.Name] = len(g.tasks)
+	g.tasks = append(g.tasks, &task)
+	return nil
+}
+
+// Tasks returns the tasks of the graph in the order they were added.
+func (g *Graph) Tasks() []Task {
+	tasks := make([]Task, len(g.tasks))
+	for i, task := range g.tasks {
+		tasks[i] = *task
+	}
+	return tasks
+}
+
+// Validate returns an error if a task depends on a task that doesn't exist or the dependencies form a cycle.
+func (g *Graph) Validate() error {
+	for _, task := range g.tasks {
+		for _, dependency := range task.DependsOn {
+			if _, ok := g.index[dependency]; !ok {
+				return fmt.Errorf("task %s depends on unknown task %s", task.Name, dependency)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(g.tasks))
+	var path []string
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			start := 0
+			for path[start] != g.tasks[i].Name {
+				start++
+			}
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path[start:], " -> "), g.tasks[i].Name)
+		case visited:
+			return nil
+		}
+		state[i] = visiting
+		path = append(path, g.tasks[i].Name)
+		for _, dependency := range g.tasks[i].DependsOn {
+			if err := visit(g.index[dependency]); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		return nil
+	}
+	for i := range g.tasks {
+		if err := visit(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package executegraph
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		tasks    []Task
+		expected string
+	}{
+		{
+			name:     "UnknownDependency",
+			tasks:    []Task{{Name: "a", Command: "true", DependsOn: []string{"missing"}}},
+			expected: "task a depends on unknown task missing",
+		},
+		{
+			name: "Cycle",
+			tasks: []Task{
+				{Name: "a", Command: "true"},
+				{Name: "b", Command: "true", DependsOn: []string{"a", "d"}},
+				{Name: "c", Command: "true", DependsOn: []string{"b"}},
+				{Name: "d", Command: "true", DependsOn: []string{"c"}},
+			},
+			expected: "dependency cycle: b -> d -> c -> b",
+		},
+	}
+	for _, tt := range tests {
+		g := New()
+		for _, task := range tt.tasks {
+			if err := g.Add(task); err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.name, err)
+			}
+		}
+		if err := g.Validate(); err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: expected error %q, but got %v", tt.name, tt.expected, err)
+		}
+		if _, err := g.Run(context.Background(), execute.NewExecutor()); err == nil {
+			t.Errorf("%s: expected Run to fail", tt.name)
+		}
+	}
+
+	g := New()
+	if err := g.Add(Task{Name: "a", Command: "true", Script: "true"}); err == nil {
+		t.Errorf("Expected error for task with a command and a script, but got nil")
+	}
+	g.Add(Task{Name: "a", Command: "true"})
+	if err := g.Add(Task{Name: "a", Command: "true"}); err == nil {
+		t.Errorf("Expected error for duplicate task, but got nil")
+	}
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+	executor := execute.NewExecutor(execute.WithShell("sh"))
+
+	t.Run("Run_RespectsDependencies", func(t *testing.T) {
+		g := New()
+		g.Add(Task{Name: "join", Command: "echo joined", DependsOn: []string{"left", "right"}})
+		g.Add(Task{Name: "left", Command: "sleep 0.2"})
+		g.Add(Task{Name: "right", Command: "sleep 0.2"})
+
+		report, err := g.Run(context.Background(), executor)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !report.Succeeded() {
+			t.Fatalf("Expected all tasks to succeed, but got %+v", report.Tasks)
+		}
+		left, right, join := report.Task("left"), report.Task("right"), report.Task("join")
+		if join.StartTime.Before(left.EndTime) || join.StartTime.Before(right.EndTime) {
+			t.Errorf("Expected join to start after its dependencies")
+		}
+		if !left.StartTime.Before(right.EndTime) || !right.StartTime.Before(left.EndTime) {
+			t.Errorf("Expected left and right to run in parallel")
+		}
+		if join.Stdout != "joined\n" {
+			t.Errorf("Expected output %q, but got %q", "joined\n", join.Stdout)
+		}
+		if report.Tasks[0].Name != "join" {
+			t.Errorf("Expected results in the order the tasks were added, but got %s first", report.Tasks[0].Name)
+		}
+	})
+
+	t.Run("Run_LimitsParallelism", func(t *testing.T) {
+		g := New()
+		g.Add(Task{Name: "a", Command: "sleep 0.1"})
+		g.Add(Task{Name: "b", Command: "sleep 0.1"})
+
+		report, err := g.Run(context.Background(), executor, WithParallelism(1))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if report.Task("b").StartTime.Before(report.Task("a").EndTime) {
+			t.Errorf("Expected b to start after a")
+		}
+	})
+
+	t.Run("Run_FailsFast", func(t *testing.T) {
+		g := New()
+		g.Add(Task{Name: "broken", Command: "exit 3"})
+		g.Add(Task{Name: "slow", Command: "exec sleep 5"})
+		g.Add(Task{Name: "after", Command: "true", DependsOn: []string{"broken"}})
+
+		start := time.Now()
+		report, err := g.Run(context.Background(), executor)
+		if !errors.Is(err, ErrTaskFailed) || !strings.Contains(err.Error(), "broken") {
+			t.Errorf("Expected ErrTaskFailed for broken, but got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("Expected slow to be killed, but the run took %s", elapsed)
+		}
+		expected := map[string]TaskState{"broken": TaskFailed, "slow": TaskCancelled, "after": TaskSkipped}
+		for name, state := range expected {
+			if task := report.Task(name); task.State != state {
+				t.Errorf("Expected %s to be %s, but got %s", name, state, task.State)
+			}
+		}
+		if broken := report.Task("broken"); broken.ExitCode != 3 {
+			t.Errorf("Expected exit code 3, but got %d", broken.ExitCode)
+		}
+		if after := report.Task("after"); after.SkippedBecause != "broken" {
+			t.Errorf("Expected after to be skipped because of broken, but got %q", after.SkippedBecause)
+		}
+	})
+
+	t.Run("Run_ContinuesOnError", func(t *testing.T) {
+		g := New()
+		g.Add(Task{Name: "broken", Command: "exit 1"})
+		g.Add(Task{Name: "skipped", Command: "true", DependsOn: []string{"broken"}})
+		g.Add(Task{Name: "transitive", Command: "true", DependsOn: []string{"skipped"}})
+		g.Add(Task{Name: "ok", Command: "sleep 0.1"})
+		g.Add(Task{Name: "after", Command: "echo after", DependsOn: []string{"ok"}})
+
+		var handled []string
+		report, err := g.Run(context.Background(), executor, WithContinueOnError(), WithTaskHandler(func(result *TaskResult) {
+			handled = append(handled, result.Name)
+		}))
+		if !errors.Is(err, ErrTaskFailed) {
+			t.Errorf("Expected ErrTaskFailed, but got %v", err)
+		}
+		expected := map[string]TaskState{
+			"broken":     TaskFailed,
+			"skipped":    TaskSkipped,
+			"transitive": TaskSkipped,
+			"ok":         TaskSucceeded,
+			"after":      TaskSucceeded,
+		}
+		for name, state := range expected {
+			if task := report.Task(name); task.State != state {
+				t.Errorf("Expected %s to be %s, but got %s", name, state, task.State)
+			}
+		}
+		if len(handled) != 5 {
+			t.Errorf("Expected the handler to be called for 5 tasks, but got %v", handled)
+		}
+	})
+
+	t.Run("Run_RetriesFailedTasks", func(t *testing.T) {
+		marker := filepath.Join(t.TempDir(), "marker")
+		g := New()
+		g.Add(Task{Name: "flaky", Command: "test -f " + marker + " || { touch " + marker + "; exit 1; }", Retries: 2, RetryDelay: 10 * time.Millisecond})
+		g.Add(Task{Name: "broken", Command: "exit 1", Retries: 1})
+
+		report, err := g.Run(context.Background(), executor, WithContinueOnError())
+		if !errors.Is(err, ErrTaskFailed) {
+			t.Errorf("Expected ErrTaskFailed, but got %v", err)
+		}
+		if flaky := report.Task("flaky"); flaky.State != TaskSucceeded || flaky.Attempts != 2 {
+			t.Errorf("Expected flaky to succeed after 2 attempts, but got %s after %d", flaky.State, flaky.Attempts)
+		}
+		if broken := report.Task("broken"); broken.State != TaskFailed || broken.Attempts != 2 {
+			t.Errorf("Expected broken to fail after 2 attempts, but got %s after %d", broken.State, broken.Attempts)
+		}
+	})
+
+	t.Run("Run_ExecutesScripts", func(t *testing.T) {
+		g := New()
+		g.Add(Task{Name: "script", Script: "echo \"$1\"", ScriptType: execute.ScriptTypeBash, Arguments: []string{"argument"}})
+
+		report, err := g.Run(context.Background(), executor)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if stdout := report.Task("script").Stdout; stdout != "argument\n" {
+			t.Errorf("Expected output %q, but got %q", "argument\n", stdout)
+		}
+	})
+
+	t.Run("Run_StopsWhenContextIsDone", func(t *testing.T) {
+		g := New()
+		g.Add(Task{Name: "slow", Command: "exec sleep 5"})
+		g.Add(Task{Name: "after", Command: "true", DependsOn: []string{"slow"}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		report, err := g.Run(ctx, executor, WithContinueOnError())
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected deadline exceeded, but got %v", err)
+		}
+		if slow := report.Task("slow"); slow.State != TaskCancelled {
+			t.Errorf("Expected slow to be cancelled, but got %s", slow.State)
+		}
+		if after := report.Task("after"); after.State != TaskSkipped {
+			t.Errorf("Expected after to be skipped, but got %s", after.State)
+		}
+	})
+
+	t.Run("Run_KillsScriptsWhenStopped", func(t *testing.T) {
+		g := New()
+		g.Add(Task{Name: "script", Script: "exec sleep 5", ScriptType: execute.ScriptTypeBash})
+		g.Add(Task{Name: "broken", Command: "sleep 0.1; exit 1"})
+
+		start := time.Now()
+		report, err := g.Run(context.Background(), executor, WithParallelism(2))
+		if !errors.Is(err, ErrTaskFailed) {
+			t.Errorf("Expected ErrTaskFailed, but got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("Expected the script to be killed, but Run took %s", elapsed)
+		}
+		if script := report.Task("script"); script.State != TaskCancelled {
+			t.Errorf("Expected script to be cancelled, but got %s", script.State)
+		}
+	})
+}
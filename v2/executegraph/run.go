@@ -0,0 +1,275 @@
+package executegraph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+// Option configures a run of a graph.
+type Option func(r *runner)
+
+// WithParallelism sets the maximum number of tasks running at the same time. A limit of 0, the default, runs every
+// task as soon as its dependencies have succeeded.
+func WithParallelism(limit int) Option {
+	return func(r *runner) {
+		r.parallelism = limit
+	}
+}
+
+// WithContinueOnError keeps running the tasks that don't depend on a failed task. By default the run stops as soon
+// as a task fails: tasks that haven't been started are cancelled and running commands are killed.
+func WithContinueOnError() Option {
+	return func(r *runner) {
+		r.continueOnError = true
+	}
+}
+
+// WithTaskHandler sets a function which is called with the result of every task once it has reached its final state.
+// It is called from the goroutine running the graph, so it should return quickly.
+func WithTaskHandler(handler func(result *TaskResult)) Option {
+	return func(r *runner) {
+		r.handler = handler
+	}
+}
+
+// runner is the state of a run of a graph.
+type runner struct {
+	graph           *Graph
+	executor        execute.Executor
+	parallelism     int
+	continueOnError bool
+	handler         func(result *TaskResult)
+
+	results    []*TaskResult
+	pending    []int
+	dependents [][]int
+	ready      []int
+	done       chan taskDone
+	running    int
+	finished   int
+}
+
+// taskDone is sent by the goroutine of a task once it has finished.
+type taskDone struct {
+	index  int
+	result *TaskResult
+}
+
+// Run runs the tasks of the graph with the executor and returns the report once every task has reached its final
+// state. Tasks whose dependencies didn't succeed are skipped in every mode. Scripts are only killed when the run stops
+// if the executor implements execute.ContextScriptExecutor, otherwise they run until they exit or their timeout
+// expires. The returned error wraps ErrTaskFailed when a task failed, is
+// the error of the context when it was cancelled, or describes why the graph is invalid, in which case the report is
+// nil.
+func (g *Graph) Run(ctx context.Context, executor execute.Executor, options ...Option) (*Report, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := &runner{
+		graph:      g,
+		executor:   executor,
+		results:    make([]*TaskResult, len(g.tasks)),
+		pending:    make([]int, len(g.tasks)),
+		dependents: make([][]int, len(g.tasks)),
+		done:       make(chan taskDone),
+	}
+	for _, option := range options {
+		option(r)
+	}
+	for i, task := range g.tasks {
+		r.pending[i] = len(task.DependsOn)
+		for _, dependency := range task.DependsOn {
+			d := g.index[dependency]
+			r.dependents[d] = append(r.dependents[d], i)
+		}
+		if r.pending[i] == 0 {
+			r.ready = append(r.ready, i)
+		}
+	}
+
+	report := &Report{StartTime: time.Now()}
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cancelled := parent.Done()
+	stopped := false
+
+	for r.finished < len(g.tasks) {
+		for !stopped && len(r.ready) > 0 && (r.parallelism <= 0 || r.running < r.parallelism) {
+			i := r.ready[0]
+			r.ready = r.ready[1:]
+			r.running++
+			go r.run(ctx, i)
+		}
+		if r.running == 0 {
+			break
+		}
+
+		select {
+		case done := <-r.done:
+			r.running--
+			if done.result.State == TaskFailed && ctx.Err() != nil {
+				done.result.State = TaskCancelled
+			}
+			r.finish(done.index, done.result)
+			if done.result.State == TaskSucceeded {
+				r.release(done.index)
+			} else {
+				r.skipDependents(done.index)
+				if done.result.State == TaskFailed && !r.continueOnError {
+					stopped = true
+					cancel()
+				}
+			}
+		case <-cancelled:
+			stopped = true
+			cancelled = nil
+		}
+	}
+
+	// Tasks that are still waiting for a slot or their dependencies when the run stops are cancelled
+	for i := range g.tasks {
+		if r.results[i] == nil {
+			r.finish(i, &TaskResult{Name: g.tasks[i].Name, State: TaskCancelled, ExitCode: -1, Err: context.Canceled})
+		}
+	}
+
+	report.EndTime = time.Now()
+	report.Tasks = r.results
+	if failed := report.Failed(); len(failed) > 0 {
+		names := make([]string, len(failed))
+		for i, task := range failed {
+			names[i] = task.Name
+		}
+		return report, fmt.Errorf("%w: %s", ErrTaskFailed, strings.Join(names, ", "))
+	}
+	if err := parent.Err(); err != nil && !report.Succeeded() {
+		return report, err
+	}
+	return report, nil
+}
+
+// finish records the final result of a task.
+func (r *runner) finish(i int, result *TaskResult) {
+	r.results[i] = result
+	r.finished++
+	if r.handler != nil {
+		r.handler(result)
+	}
+}
+
+// release marks the task as a satisfied dependency of its dependents and queues the ones that are ready in the order
+// they were added to the graph.
+func (r *runner) release(i int) {
+	for _, d := range r.dependents[i] {
+		r.pending[d]--
+		if r.pending[d] == 0 && r.results[d] == nil {
+			r.queue(d)
+		}
+	}
+}
+
+// queue inserts the task into the ready queue, which is ordered by the position of the tasks in the graph.
+func (r *runner) queue(i int) {
+	pos := len(r.ready)
+	for pos > 0 && r.ready[pos-1] > i {
+		pos--
+	}
+	r.ready = append(r.ready, 0)
+	copy(r.ready[pos+1:], r.ready[pos:])
+	r.ready[pos] = i
+}
+
+// skipDependents skips all tasks which depend on the task, directly or transitively.
+func (r *runner) skipDependents(i int) {
+	name := r.graph.tasks[i].Name
+	for _, d := range r.dependents[i] {
+		if r.results[d] != nil {
+			continue
+		}
+		r.finish(d, &TaskResult{
+			Name:           r.graph.tasks[d].Name,
+			State:          TaskSkipped,
+			ExitCode:       -1,
+			SkippedBecause: name,
+		})
+		r.skipDependents(d)
+	}
+}
+
+// run executes the task, retrying it when it fails, and reports its result.
+func (r *runner) run(ctx context.Context, i int) {
+	task := r.graph.tasks[i]
+	result := attempt(ctx, r.executor, task)
+	for result.Attempts <= task.Retries && result.State == TaskFailed && ctx.Err() == nil {
+		timer := time.NewTimer(task.RetryDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			continue
+		}
+		start, attempts := result.StartTime, result.Attempts
+		result = attempt(ctx, r.executor, task)
+		result.StartTime, result.Attempts = start, attempts+1
+	}
+	r.done <- taskDone{index: i, result: result}
+}
+
+// attempt executes the task once.
+func attempt(ctx context.Context, executor execute.Executor, task *Task) *TaskResult {
+	if task.Executor != nil {
+		executor = task.Executor
+	}
+
+	result := &TaskResult{Name: task.Name, StartTime: time.Now(), Attempts: 1}
+	var err error
+	if task.Script != "" {
+		result.Stdout, result.Stderr, err = executeScript(ctx, executor, task)
+	} else {
+		result.Stdout, result.Stderr, err = executeCommand(ctx, executor, task)
+	}
+	result.EndTime = time.Now()
+	result.ExitCode = execute.ExitCode(err)
+	result.Err = err
+	result.State = TaskSucceeded
+	if err != nil {
+		result.State = TaskFailed
+	}
+	return result
+}
+
+// executeScript executes the script of the task. It is killed when the context is cancelled if the executor
+// implements execute.ContextScriptExecutor, otherwise it runs until it exits or its timeout expires.
+func executeScript(ctx context.Context, executor execute.Executor, task *Task) (string, string, error) {
+	scripts, ok := executor.(execute.ContextScriptExecutor)
+	if !ok {
+		return executor.ExecuteScriptFromStringWithTimeout(task.ScriptType, task.Script, task.Arguments, task.Parameters, task.Timeout)
+	}
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, task.Timeout)
+		defer cancel()
+	}
+
+	values := make(map[string]interface{}, len(task.Parameters))
+	for name, value := range task.Parameters {
+		values[name] = value
+	}
+	return scripts.ExecuteScriptFromStringWithContext(ctx, task.ScriptType, task.Script, task.Arguments, execute.NewScriptParameters(values))
+}
+
+// executeCommand executes the command of the task, which is killed when the context is cancelled.
+func executeCommand(ctx context.Context, executor execute.Executor, task *Task) (string, string, error) {
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, task.Timeout)
+		defer cancel()
+	}
+	return execute.Collect(ctx, executor, task.Command)
+}
@@ -0,0 +1,103 @@
+package executehistory
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltBucket is the bucket holding the records.
+var boltBucket = []byte("records")
+
+// BoltStore is a Store backed by an embedded BoltDB database. Records are keyed by their start time, which makes
+// queries for a time range read only the records within the range.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens the BoltDB database at the path, creating it if it doesn't exist. A database can only be opened by one
+// process at a time, OpenBolt fails if the database is still locked by another process after one second.
+func OpenBolt(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create history bucket: %w", err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Put adds the record to the database.
+func (s *BoltStore) Put(record *Record) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode history record: %w", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put(boltKey(record.StartTime, record.ID), value)
+	})
+}
+
+// Query returns the records in the database selected by the query.
+func (s *BoltStore) Query(query Query) ([]*Record, error) {
+	var records []*Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltBucket).Cursor()
+
+		var k, v []byte
+		if query.Since.IsZero() {
+			k, v = c.First()
+		} else {
+			k, v = c.Seek(boltKey(query.Since, ""))
+		}
+		var until []byte
+		if !query.Until.IsZero() {
+			until = boltKey(query.Until, "")
+		}
+
+		for ; k != nil; k, v = c.Next() {
+			if until != nil && bytes.Compare(k, until) >= 0 {
+				break
+			}
+			record := &Record{}
+			if err := json.Unmarshal(v, record); err != nil {
+				return fmt.Errorf("failed to decode history record: %w", err)
+			}
+			if !query.Match(record) {
+				continue
+			}
+			records = append(records, record)
+			if query.Limit > 0 && len(records) == query.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Close closes the database.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// boltKey returns the key of a record, which is the big-endian start time in nanoseconds followed by the id so that
+// keys are ordered by start time.
+func boltKey(start time.Time, id string) []byte {
+	key := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(start.UnixNano()))
+	return append(key, id...)
+}
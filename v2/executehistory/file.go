@@ -0,0 +1,106 @@
+package executehistory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileStore is a Store writing one JSON record per line to a file. Every record is synced to disk before Put returns.
+// Queries read the whole file, which makes it best suited for small histories or ones that are rotated externally.
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// OpenFile opens the file store at the path, creating the file if it doesn't exist.
+func OpenFile(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	return &FileStore{path: path, file: file}, nil
+}
+
+// Put appends the record to the file.
+func (s *FileStore) Put(record *Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode history record: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	if _, err := s.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write history record: %w", err)
+	}
+	return s.file.Sync()
+}
+
+// Query returns the records in the file selected by the query. An incomplete last line, e.g. left by a crash while
+// writing a record, is ignored.
+func (s *FileStore) Query(query Query) ([]*Record, error) {
+	s.mu.Lock()
+	closed := s.file == nil
+	s.mu.Unlock()
+	if closed {
+		return nil, os.ErrClosed
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+
+	var records []*Record
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history file: %w", err)
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		record := &Record{}
+		if err := json.Unmarshal(line, record); err != nil {
+			return nil, fmt.Errorf("failed to decode history record: %w", err)
+		}
+		if query.Match(record) {
+			records = append(records, record)
+		}
+	}
+
+	// Records are appended once the execution has finished, so they are not necessarily ordered by start time
+	sortRecords(records)
+	if query.Limit > 0 && len(records) > query.Limit {
+		records = records[:query.Limit]
+	}
+	return records, nil
+}
+
+// Close closes the file.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
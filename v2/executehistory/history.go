@@ -0,0 +1,185 @@
+// Package executehistory records the executions of executors in a persistent store so they can be queried after the
+// process has exited.
+//
+// A Recorder is attached to an executor as middleware and writes a Record with the redacted spec, the result and the
+// compressed output of every execution to a Store:
+//
+//	store, err := executehistory.OpenBolt("/var/lib/myapp/history.db")
+//	if err != nil {
+//		return err
+//	}
+//	defer store.Close()
+//	recorder := executehistory.NewRecorder(store)
+//	e := execute.NewExecutor(execute.WithMiddleware(recorder.Middleware()))
+//
+//	// What failed since yesterday?
+//	records, err := store.Query(executehistory.Query{
+//		Since:  time.Now().Add(-24 * time.Hour),
+//		Status: executehistory.StatusFailed,
+//	})
+package executehistory
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+// Record is the history entry of an execution. It extends the audit record of the execution with an id and the
+// output of the process.
+type Record struct {
+	// ID uniquely identifies the record.
+	ID string `json:"id"`
+	execute.AuditRecord
+	// Stdout and Stderr are the gzip compressed output of the process, see Output.
+	Stdout []byte `json:"stdout,omitempty"`
+	Stderr []byte `json:"stderr,omitempty"`
+	// StdoutTruncated and StderrTruncated are set when the beginning of the output was dropped because it exceeded
+	// the output limit of the recorder.
+	StdoutTruncated bool `json:"stdout_truncated,omitempty"`
+	StderrTruncated bool `json:"stderr_truncated,omitempty"`
+}
+
+// Succeeded returns whether the process exited with exit code 0.
+func (r *Record) Succeeded() bool {
+	return r.ExitCode == 0 && r.Error == ""
+}
+
+// Output returns the decompressed output of the process.
+func (r *Record) Output() (stdout string, stderr string, err error) {
+	if stdout, err = decompress(r.Stdout); err != nil {
+		return "", "", err
+	}
+	if stderr, err = decompress(r.Stderr); err != nil {
+		return "", "", err
+	}
+	return stdout, stderr, nil
+}
+
+// Status selects records by the outcome of the execution.
+type Status int
+
+const (
+	// StatusAny matches all records.
+	StatusAny Status = iota
+	// StatusSucceeded matches the executions that exited with exit code 0.
+	StatusSucceeded
+	// StatusFailed matches the executions that failed to start, were killed or exited with a non-zero exit code.
+	StatusFailed
+)
+
+// Query selects records from a store. The zero value matches all records.
+type Query struct {
+	// Since and Until limit the records to the executions started within [Since, Until). A zero time doesn't limit
+	// the range.
+	Since time.Time
+	Until time.Time
+	// Status limits the records to succeeded or failed executions.
+	Status Status
+	// ExitCodes limits the records to the executions which exited with one of the exit codes.
+	ExitCodes []int
+	// Command limits the records to the executions whose command contains the string.
+	Command string
+	// Limit is the maximum number of records returned, 0 means no limit.
+	Limit int
+}
+
+// Match returns whether the record is selected by the query, not taking the limit into account.
+func (q *Query) Match(record *Record) bool {
+	if !q.Since.IsZero() && record.StartTime.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !record.StartTime.Before(q.Until) {
+		return false
+	}
+	switch q.Status {
+	case StatusSucceeded:
+		if !record.Succeeded() {
+			return false
+		}
+	case StatusFailed:
+		if record.Succeeded() {
+			return false
+		}
+	}
+	if len(q.ExitCodes) > 0 {
+		found := false
+		for _, code := range q.ExitCodes {
+			if record.ExitCode == code {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return strings.Contains(record.Command, q.Command)
+}
+
+// Store persists records. Implementations must be safe for concurrent use.
+type Store interface {
+	// Put adds the record to the store.
+	Put(record *Record) error
+	// Query returns the records selected by the query ordered by their start time, oldest first. When the query has
+	// a limit the first matching records are returned.
+	Query(query Query) ([]*Record, error)
+	// Close releases the resources of the store.
+	Close() error
+}
+
+// sortRecords orders the records by their start time.
+func sortRecords(records []*Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].StartTime.Before(records[j].StartTime)
+	})
+}
+
+// newID returns a random record id.
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("executehistory: failed to generate record id: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// compress returns the gzip compressed data, or nil when there is no data.
+func compress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// decompress returns the data decompressed by gzip.
+func decompress(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
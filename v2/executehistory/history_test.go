@@ -0,0 +1,169 @@
+package executehistory
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+func TestStores(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+
+	stores := map[string]func(path string) (Store, error){
+		"File": func(path string) (Store, error) { return OpenFile(path) },
+		"Bolt": func(path string) (Store, error) { return OpenBolt(path) },
+	}
+
+	for name, open := range stores {
+		t.Run(name+"_RecordsAndQueriesExecutions", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "history")
+			store, err := open(path)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			recorder := NewRecorder(store)
+			executor := execute.NewExecutor(execute.WithMiddleware(recorder.Middleware()), execute.WithShell("sh"))
+
+			start := time.Now()
+			if _, err := executor.Execute("echo hello; echo oops >&2"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			middle := time.Now()
+			if _, err := executor.Execute("exit 3"); err == nil {
+				t.Fatalf("Expected error, but got nil")
+			}
+			if _, err := executor.Execute("echo world"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// Records must survive reopening the store
+			if err := store.Close(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if store, err = open(path); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer store.Close()
+
+			records, err := store.Query(Query{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(records) != 3 {
+				t.Fatalf("Expected 3 records, but got %d", len(records))
+			}
+			first := records[0]
+			if first.ID == "" || first.Command != "echo hello; echo oops >&2" || first.ExitCode != 0 {
+				t.Errorf("Unexpected first record: %+v", first)
+			}
+			stdout, stderr, err := first.Output()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if stdout != "hello\n" || stderr != "oops\n" {
+				t.Errorf("Expected output %q and %q, but got %q and %q", "hello\n", "oops\n", stdout, stderr)
+			}
+
+			tests := []struct {
+				name     string
+				query    Query
+				expected []string
+			}{
+				{"Command", Query{Command: "echo"}, []string{"echo hello; echo oops >&2", "echo world"}},
+				{"Succeeded", Query{Status: StatusSucceeded}, []string{"echo hello; echo oops >&2", "echo world"}},
+				{"Failed", Query{Status: StatusFailed}, []string{"exit 3"}},
+				{"ExitCodes", Query{ExitCodes: []int{1, 3}}, []string{"exit 3"}},
+				{"Since", Query{Since: middle}, []string{"exit 3", "echo world"}},
+				{"Until", Query{Since: start, Until: middle}, []string{"echo hello; echo oops >&2"}},
+				{"Limit", Query{Limit: 2}, []string{"echo hello; echo oops >&2", "exit 3"}},
+				{"NoMatch", Query{Command: "ls"}, nil},
+			}
+			for _, tt := range tests {
+				records, err := store.Query(tt.query)
+				if err != nil {
+					t.Fatalf("%s: unexpected error: %v", tt.name, err)
+				}
+				var commands []string
+				for _, record := range records {
+					commands = append(commands, record.Command)
+				}
+				if strings.Join(commands, ",") != strings.Join(tt.expected, ",") {
+					t.Errorf("%s: expected %q, but got %q", tt.name, tt.expected, commands)
+				}
+			}
+		})
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+
+	t.Run("Recorder_TruncatesOutput", func(t *testing.T) {
+		store, err := OpenFile(filepath.Join(t.TempDir(), "history.jsonl"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer store.Close()
+		recorder := NewRecorder(store, WithOutputLimit(4))
+		executor := execute.NewExecutor(execute.WithMiddleware(recorder.Middleware()))
+
+		if _, err := executor.Execute("echo 0123456789"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		records, err := store.Query(Query{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(records) != 1 {
+			t.Fatalf("Expected 1 record, but got %d", len(records))
+		}
+		stdout, _, err := records[0].Output()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if stdout != "789\n" || !records[0].StdoutTruncated {
+			t.Errorf("Expected truncated output %q, but got %q (truncated %t)", "789\n", stdout, records[0].StdoutTruncated)
+		}
+		if records[0].StdoutBytes != 11 {
+			t.Errorf("Expected 11 stdout bytes, but got %d", records[0].StdoutBytes)
+		}
+	})
+
+	t.Run("Recorder_RecordsDryRuns", func(t *testing.T) {
+		store, err := OpenFile(filepath.Join(t.TempDir(), "history.jsonl"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer store.Close()
+		recorder := NewRecorder(store)
+		executor := execute.NewExecutor(
+			execute.WithMiddleware(recorder.Middleware()),
+			execute.WithDryRun(),
+			execute.WithDryRunResult(execute.DryRunResult{Stdout: "planned"}),
+		)
+
+		if _, err := executor.Execute("rm -rf /tmp/nothing"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		records, err := store.Query(Query{Command: "rm"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(records) != 1 || !records[0].DryRun {
+			t.Fatalf("Expected 1 dry-run record, but got %+v", records)
+		}
+		if stdout, _, _ := records[0].Output(); stdout != "planned" {
+			t.Errorf("Expected output %q, but got %q", "planned", stdout)
+		}
+	})
+}
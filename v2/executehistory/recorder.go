@@ -0,0 +1,125 @@
+package executehistory
+
+import (
+	"sync"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+// defaultOutputLimit is the default number of bytes of output recorded per stream.
+const defaultOutputLimit = 1 << 20
+
+// Option configures a Recorder.
+type Option func(r *Recorder)
+
+// WithOutputLimit sets the number of bytes of stdout and stderr recorded per execution, 1MiB by default. When the
+// output exceeds the limit its beginning is dropped. A limit of 0 disables recording the output.
+func WithOutputLimit(limit int) Option {
+	return func(r *Recorder) {
+		r.outputLimit = limit
+	}
+}
+
+// WithLogger sets the logger used to report records that couldn't be stored, the global logger by default.
+func WithLogger(logger execute.Logger) Option {
+	return func(r *Recorder) {
+		r.logger = logger
+	}
+}
+
+// Recorder writes a record of every execution of the executors it is attached to into a store.
+type Recorder struct {
+	store       Store
+	outputLimit int
+	logger      execute.Logger
+}
+
+// NewRecorder returns a new Recorder writing to the store.
+func NewRecorder(store Store, options ...Option) *Recorder {
+	r := &Recorder{
+		store:       store,
+		outputLimit: defaultOutputLimit,
+	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+// Middleware returns the middleware recording the executions of an executor. Failing to store a record is logged but
+// doesn't fail the execution.
+func (r *Recorder) Middleware() execute.Middleware {
+	return func(next execute.RunFunc) execute.RunFunc {
+		return func(spec *execute.CommandSpec) (*execute.ExecutionResult, error) {
+			stdout := &capture{limit: r.outputLimit}
+			stderr := &capture{limit: r.outputLimit}
+			if r.outputLimit > 0 {
+				spec.OnOutput(func(stream string, data []byte) {
+					if stream == "stderr" {
+						stderr.Write(data)
+					} else {
+						stdout.Write(data)
+					}
+				})
+			}
+			spec.OnExit(func(result *execute.Result) {
+				r.record(result, stdout, stderr)
+			})
+			return next(spec)
+		}
+	}
+}
+
+// record writes the record of the result to the store.
+func (r *Recorder) record(result *execute.Result, stdout *capture, stderr *capture) {
+	record := &Record{
+		ID:          newID(),
+		AuditRecord: *execute.NewAuditRecord(result),
+	}
+
+	var err error
+	if record.Stdout, record.StdoutTruncated, err = stdout.compressed(); err == nil {
+		record.Stderr, record.StderrTruncated, err = stderr.compressed()
+	}
+	if err == nil {
+		err = r.store.Put(record)
+	}
+	if err != nil {
+		r.log().Error("failed to write history record", "command", record.Command, "error", err)
+	}
+}
+
+// log returns the logger used by the recorder.
+func (r *Recorder) log() execute.Logger {
+	if r.logger != nil {
+		return r.logger
+	}
+	return execute.GetLogger()
+}
+
+// capture keeps the end of the output of a stream up to a limit.
+type capture struct {
+	mu        sync.Mutex
+	limit     int
+	data      []byte
+	truncated bool
+}
+
+// Write appends the data to the captured output, dropping the beginning of the output once it exceeds the limit.
+func (c *capture) Write(data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data = append(c.data, data...)
+	if len(c.data) > c.limit {
+		c.data = c.data[len(c.data)-c.limit:]
+		c.truncated = true
+	}
+}
+
+// compressed returns the captured output compressed and whether it was truncated.
+func (c *capture) compressed() ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := compress(c.data)
+	return data, c.truncated, err
+}
@@ -0,0 +1,179 @@
+// Package executemetrics provides Prometheus metrics for executors.
+//
+// A Collector is registered with a Prometheus registry and attached to one or more executors through its hooks:
+//
+//	collector := executemetrics.NewCollector()
+//	prometheus.MustRegister(collector)
+//	e := execute.NewExecutor(execute.WithHooks(collector.Hooks()))
+package executemetrics
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bgrewell/go-execute/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Classifier returns the value of the command label for an execution. The number of distinct values it returns
+// should be small since every value creates a new set of time series.
+type Classifier func(spec *execute.CommandSpec) string
+
+// ClassifyBinary is the default Classifier which labels executions with the name of the binary, or the script type
+// for scripts.
+func ClassifyBinary(spec *execute.CommandSpec) string {
+	if spec.ScriptType != "" {
+		return "script:" + string(spec.ScriptType)
+	}
+	name := filepath.Base(spec.Path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// ClassifyAllowlist returns a Classifier which labels executions with the name of the binary if it is in the list
+// and with "other" otherwise, which bounds the cardinality of the command label.
+func ClassifyAllowlist(binaries ...string) Classifier {
+	allowed := make(map[string]bool, len(binaries))
+	for _, binary := range binaries {
+		allowed[binary] = true
+	}
+	return func(spec *execute.CommandSpec) string {
+		if name := ClassifyBinary(spec); allowed[name] {
+			return name
+		}
+		return "other"
+	}
+}
+
+// Option configures a Collector.
+type Option func(c *Collector)
+
+// WithNamespace sets the namespace of the metric names, "execute" by default.
+func WithNamespace(namespace string) Option {
+	return func(c *Collector) {
+		c.namespace = namespace
+	}
+}
+
+// WithClassifier sets the classifier used for the command label, ClassifyBinary by default.
+func WithClassifier(classifier Classifier) Option {
+	return func(c *Collector) {
+		c.classifier = classifier
+	}
+}
+
+// WithDurationBuckets sets the buckets of the duration histogram in seconds.
+func WithDurationBuckets(buckets []float64) Option {
+	return func(c *Collector) {
+		c.durationBuckets = buckets
+	}
+}
+
+// WithOutputBuckets sets the buckets of the output size histogram in bytes.
+func WithOutputBuckets(buckets []float64) Option {
+	return func(c *Collector) {
+		c.outputBuckets = buckets
+	}
+}
+
+// Collector is a prometheus.Collector with the metrics of the executions of the executors it is attached to.
+type Collector struct {
+	namespace       string
+	classifier      Classifier
+	durationBuckets []float64
+	outputBuckets   []float64
+
+	started  *prometheus.CounterVec
+	finished *prometheus.CounterVec
+	timeouts *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	output   *prometheus.HistogramVec
+}
+
+// NewCollector returns a new Collector.
+func NewCollector(options ...Option) *Collector {
+	c := &Collector{
+		namespace:       "execute",
+		classifier:      ClassifyBinary,
+		durationBuckets: prometheus.ExponentialBuckets(0.005, 4, 10),
+		outputBuckets:   prometheus.ExponentialBuckets(64, 4, 10),
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	c.started = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: c.namespace,
+		Name:      "executions_started_total",
+		Help:      "Number of processes started.",
+	}, []string{"command"})
+	c.finished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: c.namespace,
+		Name:      "executions_finished_total",
+		Help:      "Number of executions finished by exit code. Executions that failed to start have the exit code -1.",
+	}, []string{"command", "exit_code"})
+	c.timeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: c.namespace,
+		Name:      "executions_timeouts_total",
+		Help:      "Number of processes killed because their timeout expired.",
+	}, []string{"command"})
+	c.duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: c.namespace,
+		Name:      "execution_duration_seconds",
+		Help:      "Duration of executions.",
+		Buckets:   c.durationBuckets,
+	}, []string{"command"})
+	c.output = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: c.namespace,
+		Name:      "execution_output_bytes",
+		Help:      "Number of bytes written by processes to stdout and stderr.",
+		Buckets:   c.outputBuckets,
+	}, []string{"command", "stream"})
+	return c
+}
+
+// Hooks returns the hooks which record the executions of an executor.
+func (c *Collector) Hooks() execute.Hooks {
+	return execute.Hooks{
+		AfterStart: c.afterStart,
+		OnExit:     c.onExit,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.started.Describe(ch)
+	c.finished.Describe(ch)
+	c.timeouts.Describe(ch)
+	c.duration.Describe(ch)
+	c.output.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.started.Collect(ch)
+	c.finished.Collect(ch)
+	c.timeouts.Collect(ch)
+	c.duration.Collect(ch)
+	c.output.Collect(ch)
+}
+
+// afterStart records a started execution.
+func (c *Collector) afterStart(spec *execute.CommandSpec, result *execute.ExecutionResult) {
+	c.started.WithLabelValues(c.classifier(spec)).Inc()
+}
+
+// onExit records a finished execution.
+func (c *Collector) onExit(spec *execute.CommandSpec, result *execute.Result) {
+	command := c.classifier(spec)
+	c.finished.WithLabelValues(command, strconv.Itoa(result.ExitCode)).Inc()
+	if result.TimedOut {
+		c.timeouts.WithLabelValues(command).Inc()
+	}
+	c.duration.WithLabelValues(command).Observe(result.Duration().Seconds())
+	c.output.WithLabelValues(command, "stdout").Observe(float64(result.StdoutBytes))
+	c.output.WithLabelValues(command, "stderr").Observe(float64(result.StderrBytes))
+}
+
+// Ensure the Collector implements the prometheus.Collector interface.
+var _ prometheus.Collector = (*Collector)(nil)
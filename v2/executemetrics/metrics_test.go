@@ -0,0 +1,83 @@
+package executemetrics
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+
+	t.Run("Collector_RecordsExecutions", func(t *testing.T) {
+		collector := NewCollector()
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(collector)
+		executor := execute.NewExecutor(execute.WithHooks(collector.Hooks()))
+
+		for i := 0; i < 2; i++ {
+			if _, err := executor.Execute("echo hello"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		if _, err := executor.Execute("false"); err == nil {
+			t.Fatalf("Expected error, but got nil")
+		}
+
+		expected := `
+# HELP execute_executions_finished_total Number of executions finished by exit code. Executions that failed to start have the exit code -1.
+# TYPE execute_executions_finished_total counter
+execute_executions_finished_total{command="echo",exit_code="0"} 2
+execute_executions_finished_total{command="false",exit_code="1"} 1
+# HELP execute_executions_started_total Number of processes started.
+# TYPE execute_executions_started_total counter
+execute_executions_started_total{command="echo"} 2
+execute_executions_started_total{command="false"} 1
+`
+		err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "execute_executions_finished_total", "execute_executions_started_total")
+		if err != nil {
+			t.Error(err)
+		}
+		if count := testutil.CollectAndCount(collector, "execute_execution_output_bytes"); count != 4 {
+			t.Errorf("Expected 4 output histograms, but got %d", count)
+		}
+	})
+
+	t.Run("Collector_RecordsTimeouts", func(t *testing.T) {
+		collector := NewCollector(WithClassifier(ClassifyAllowlist("echo")))
+		executor := execute.NewExecutor(execute.WithHooks(collector.Hooks()))
+
+		result, err := executor.ExecuteAsyncWithTimeout("sleep 5", 50*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		<-result.Finished
+
+		if value := testutil.ToFloat64(collector.timeouts.WithLabelValues("other")); value != 1 {
+			t.Errorf("Expected 1 timeout for the other command, but got %v", value)
+		}
+	})
+}
+
+func TestClassifyBinary(t *testing.T) {
+	tests := map[string]*execute.CommandSpec{
+		"ls":            {Path: "/usr/bin/ls"},
+		"powershell":    {Path: `C:\Windows\powershell.exe`},
+		"script:python": {Path: "/usr/bin/python3", ScriptType: execute.ScriptTypePython},
+	}
+	for expected, spec := range tests {
+		if runtime.GOOS != "windows" && strings.Contains(spec.Path, `\`) {
+			continue
+		}
+		if got := ClassifyBinary(spec); got != expected {
+			t.Errorf("Expected %s, but got %s", expected, got)
+		}
+	}
+}
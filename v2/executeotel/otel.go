@@ -0,0 +1,184 @@
+// Package executeotel provides OpenTelemetry tracing for executors.
+//
+// The middleware starts a span for every execution and ends it once the process has exited. The W3C trace context of
+// the span is injected into the environment of the process as TRACEPARENT and TRACESTATE so instrumented children
+// are able to continue the trace.
+//
+//	e := execute.NewExecutor(execute.WithMiddleware(executeotel.Middleware()))
+package executeotel
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bgrewell/go-execute/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer used by the middleware.
+const instrumentationName = "github.com/bgrewell/go-execute/v2/executeotel"
+
+// Attribute keys set on the execution spans.
+const (
+	AttributeExecutablePath = attribute.Key("process.executable.path")
+	AttributeExecutableName = attribute.Key("process.executable.name")
+	AttributeArgsCount      = attribute.Key("process.args_count")
+	AttributeExitCode       = attribute.Key("process.exit.code")
+	AttributeUser           = attribute.Key("process.owner")
+	AttributeScriptType     = attribute.Key("execute.script.type")
+	AttributeDryRun         = attribute.Key("execute.dry_run")
+	AttributeDurationMs     = attribute.Key("execute.duration_ms")
+	AttributeStdoutBytes    = attribute.Key("execute.stdout.bytes")
+	AttributeStderrBytes    = attribute.Key("execute.stderr.bytes")
+)
+
+// Option configures the tracing middleware.
+type Option func(c *config)
+
+type config struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+	context    func(spec *execute.CommandSpec) context.Context
+}
+
+// WithTracerProvider sets the tracer provider used to create spans. The global tracer provider is used by default.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.provider = provider
+	}
+}
+
+// WithPropagator sets the propagator used to inject the trace context into the environment of the process. The W3C
+// trace context propagator is used by default.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagator = propagator
+	}
+}
+
+// WithContext sets the function returning the parent context of the span for an execution. Without it every
+// execution starts a new trace.
+func WithContext(fn func(spec *execute.CommandSpec) context.Context) Option {
+	return func(c *config) {
+		c.context = fn
+	}
+}
+
+// Middleware returns an execute.Middleware which traces every execution.
+func Middleware(options ...Option) execute.Middleware {
+	c := &config{
+		provider:   otel.GetTracerProvider(),
+		propagator: propagation.TraceContext{},
+	}
+	for _, option := range options {
+		option(c)
+	}
+	tracer := c.provider.Tracer(instrumentationName)
+
+	return func(next execute.RunFunc) execute.RunFunc {
+		return func(spec *execute.CommandSpec) (*execute.ExecutionResult, error) {
+			ctx := context.Background()
+			if c.context != nil {
+				if parent := c.context(spec); parent != nil {
+					ctx = parent
+				}
+			}
+
+			name := filepath.Base(spec.Path)
+			ctx, span := tracer.Start(ctx, "exec "+name,
+				trace.WithSpanKind(trace.SpanKindInternal),
+				trace.WithAttributes(
+					AttributeExecutablePath.String(spec.Path),
+					AttributeExecutableName.String(name),
+					AttributeArgsCount.Int(len(spec.Args)),
+				),
+			)
+			if spec.User != "" {
+				span.SetAttributes(AttributeUser.String(spec.User))
+			}
+			if spec.ScriptType != "" {
+				span.SetAttributes(AttributeScriptType.String(string(spec.ScriptType)))
+			}
+			spec.ExtraEnv = injectEnv(ctx, c.propagator, spec.ExtraEnv)
+
+			var once sync.Once
+			spec.OnExit(func(result *execute.Result) {
+				once.Do(func() { endSpan(span, result) })
+			})
+
+			execResult, err := next(spec)
+			if err != nil {
+				// The error may come from a middleware that never started the command, in which case there is no result
+				once.Do(func() {
+					span.RecordError(err)
+					span.SetStatus(codes.Error, err.Error())
+					span.End()
+				})
+			}
+			return execResult, err
+		}
+	}
+}
+
+// endSpan records the result on the span and ends it.
+func endSpan(span trace.Span, result *execute.Result) {
+	span.SetAttributes(
+		AttributeExitCode.Int(result.ExitCode),
+		AttributeDurationMs.Int64(result.Duration().Milliseconds()),
+		AttributeStdoutBytes.Int64(result.StdoutBytes),
+		AttributeStderrBytes.Int64(result.StderrBytes),
+	)
+	if result.DryRun {
+		span.SetAttributes(AttributeDryRun.Bool(true))
+	}
+	if result.TimedOut {
+		span.AddEvent("timeout", trace.WithTimestamp(result.EndTime))
+	}
+	if signal := killSignal(result.Err); signal != "" {
+		span.AddEvent("killed", trace.WithTimestamp(result.EndTime), trace.WithAttributes(attribute.String("signal", signal)))
+	}
+	if result.Err != nil {
+		span.RecordError(result.Err, trace.WithTimestamp(result.EndTime))
+		span.SetStatus(codes.Error, result.Err.Error())
+	}
+	span.End(trace.WithTimestamp(result.EndTime))
+}
+
+// killSignal returns the name of the signal which terminated the process, or an empty string if it exited normally.
+func killSignal(err error) string {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ProcessState == nil {
+		return ""
+	}
+	return signalName(exitErr.ProcessState)
+}
+
+// injectEnv returns the extra environment with the trace context of ctx, replacing any trace context it contains.
+func injectEnv(ctx context.Context, propagator propagation.TextMapPropagator, env []string) []string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return env
+	}
+
+	injected := make([]string, 0, len(env)+len(carrier))
+	for _, entry := range env {
+		key, _, _ := strings.Cut(entry, "=")
+		if _, ok := carrier[strings.ToLower(key)]; ok {
+			continue
+		}
+		injected = append(injected, entry)
+	}
+	for _, key := range carrier.Keys() {
+		injected = append(injected, strings.ToUpper(key)+"="+carrier.Get(key))
+	}
+	return injected
+}
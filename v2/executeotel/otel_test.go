@@ -0,0 +1,162 @@
+package executeotel
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestProvider() (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	return provider, exporter
+}
+
+func attributeValue(span tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, attr := range span.Attributes {
+		if attr.Key == key {
+			return attr.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestMiddleware(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("skipping test: sh not available")
+	}
+
+	t.Run("Middleware_RecordsSpan", func(t *testing.T) {
+		provider, exporter := newTestProvider()
+		executor := execute.NewExecutor(execute.WithMiddleware(Middleware(WithTracerProvider(provider))))
+
+		if _, err := executor.Execute("echo hello world"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		spans := exporter.GetSpans()
+		if len(spans) != 1 {
+			t.Fatalf("Expected 1 span, but got %d", len(spans))
+		}
+		span := spans[0]
+		if span.Name != "exec echo" {
+			t.Errorf("Expected span name 'exec echo', but got '%s'", span.Name)
+		}
+		expected := map[attribute.Key]int64{
+			AttributeArgsCount:   2,
+			AttributeExitCode:    0,
+			AttributeStdoutBytes: 12,
+		}
+		for key, value := range expected {
+			got, ok := attributeValue(span, key)
+			if !ok || got.AsInt64() != value {
+				t.Errorf("Expected attribute %s=%d, but got %v", key, value, got.Emit())
+			}
+		}
+	})
+
+	t.Run("Middleware_InjectsTraceparent", func(t *testing.T) {
+		provider, exporter := newTestProvider()
+		executor := execute.NewExecutor(
+			execute.WithShell("sh"),
+			execute.WithMiddleware(Middleware(WithTracerProvider(provider))),
+		)
+
+		stdout, err := executor.Execute("echo $TRACEPARENT")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		spans := exporter.GetSpans()
+		if len(spans) != 1 {
+			t.Fatalf("Expected 1 span, but got %d", len(spans))
+		}
+		traceID := spans[0].SpanContext.TraceID().String()
+		spanID := spans[0].SpanContext.SpanID().String()
+		expected := "00-" + traceID + "-" + spanID + "-01"
+		if strings.TrimSpace(stdout) != expected {
+			t.Errorf("Expected TRACEPARENT %s, but got %s", expected, stdout)
+		}
+	})
+
+	t.Run("Middleware_WithParentContext", func(t *testing.T) {
+		provider, exporter := newTestProvider()
+		ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+		executor := execute.NewExecutor(execute.WithMiddleware(Middleware(
+			WithTracerProvider(provider),
+			WithContext(func(spec *execute.CommandSpec) context.Context { return ctx }),
+		)))
+
+		if _, err := executor.Execute("true"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		parent.End()
+
+		spans := exporter.GetSpans()
+		if len(spans) != 2 {
+			t.Fatalf("Expected 2 spans, but got %d", len(spans))
+		}
+		if spans[0].Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("Expected the execution span to be a child of the parent span")
+		}
+	})
+
+	t.Run("Middleware_RecordsTimeout", func(t *testing.T) {
+		provider, exporter := newTestProvider()
+		executor := execute.NewExecutor(execute.WithMiddleware(Middleware(WithTracerProvider(provider))))
+
+		result, err := executor.ExecuteAsyncWithTimeout("sleep 5", 50*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		<-result.Finished
+
+		spans := exporter.GetSpans()
+		if len(spans) != 1 {
+			t.Fatalf("Expected 1 span, but got %d", len(spans))
+		}
+		events := map[string]bool{}
+		for _, event := range spans[0].Events {
+			events[event.Name] = true
+		}
+		if !events["timeout"] || !events["killed"] {
+			t.Errorf("Expected timeout and killed events, but got %v", spans[0].Events)
+		}
+		if spans[0].Status.Code != codes.Error {
+			t.Errorf("Expected error status, but got %v", spans[0].Status)
+		}
+	})
+
+	t.Run("Middleware_WithStartFailure", func(t *testing.T) {
+		provider, exporter := newTestProvider()
+		denied := errors.New("denied")
+		executor := execute.NewExecutor(execute.WithMiddleware(
+			Middleware(WithTracerProvider(provider)),
+			func(next execute.RunFunc) execute.RunFunc {
+				return func(spec *execute.CommandSpec) (*execute.ExecutionResult, error) {
+					return nil, denied
+				}
+			},
+		))
+
+		if _, err := executor.Execute("true"); !errors.Is(err, denied) {
+			t.Fatalf("Expected error %v, but got %v", denied, err)
+		}
+		spans := exporter.GetSpans()
+		if len(spans) != 1 || spans[0].Status.Code != codes.Error {
+			t.Errorf("Expected 1 failed span, but got %v", spans)
+		}
+	})
+}
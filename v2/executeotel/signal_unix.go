@@ -0,0 +1,17 @@
+//go:build !windows
+
+package executeotel
+
+import (
+	"os"
+	"syscall"
+)
+
+// signalName returns the name of the signal which terminated the process.
+func signalName(state *os.ProcessState) string {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	return status.Signal().String()
+}
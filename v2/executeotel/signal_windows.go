@@ -0,0 +1,8 @@
+package executeotel
+
+import "os"
+
+// signalName always returns an empty string because processes are not terminated by signals on Windows.
+func signalName(state *os.ProcessState) string {
+	return ""
+}
@@ -0,0 +1,69 @@
+// Package executeschedule runs commands periodically on cron expressions or fixed intervals.
+//
+// Jobs are added to a Scheduler together with their schedule, timeout, jitter and the policy that applies when a run
+// is due while the previous one is still going. The result of every run is reported to a handler or a channel:
+//
+//	scheduler := executeschedule.NewScheduler(executor, executeschedule.WithHandler(func(run executeschedule.Run) {
+//		log.Printf("%s exited with %d after %s", run.Job, run.ExitCode, run.EndTime.Sub(run.StartTime))
+//	}))
+//	nightly, err := executeschedule.Cron("0 3 * * *")
+//	if err != nil {
+//		return err
+//	}
+//	scheduler.Add(executeschedule.Job{
+//		Name:     "vacuum",
+//		Command:  "vacuumdb --all",
+//		Schedule: nightly,
+//		Timeout:  time.Hour,
+//	})
+//	scheduler.Add(executeschedule.Job{
+//		Name:     "sync",
+//		Command:  "rsync -a /data backup:",
+//		Schedule: executeschedule.Every(5 * time.Minute),
+//		Jitter:   30 * time.Second,
+//		Overlap:  executeschedule.OverlapQueue,
+//	})
+//	scheduler.Start()
+//	defer scheduler.Stop(context.Background())
+package executeschedule
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule returns the times at which a job is due.
+type Schedule interface {
+	// Next returns the first time after t at which the job is due, or the zero time if it is never due again.
+	Next(t time.Time) time.Time
+}
+
+// cronParser parses standard cron expressions with an optional seconds field and descriptors such as @daily and
+// @every 1h.
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Cron returns the schedule of the cron expression. Expressions have five fields, or six when the first one is the
+// second, and descriptors such as @hourly, @daily and @every 10m are supported. Times are in the local time zone
+// unless the expression is prefixed with CRON_TZ=<zone>.
+func Cron(expr string) (Schedule, error) {
+	schedule, err := cronParser.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	return schedule, nil
+}
+
+// Every returns a schedule that is due every interval, starting one interval after the job is scheduled.
+func Every(interval time.Duration) Schedule {
+	return every(interval)
+}
+
+// every is a schedule with a fixed interval.
+type every time.Duration
+
+// Next returns t plus the interval.
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
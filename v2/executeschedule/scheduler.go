@@ -0,0 +1,381 @@
+package executeschedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+var (
+	// ErrJobNotFound is returned for jobs that haven't been added to the scheduler.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrSchedulerStopped is returned when adding or removing jobs of a stopped scheduler.
+	ErrSchedulerStopped = errors.New("scheduler is stopped")
+)
+
+// OverlapPolicy decides what happens when a run of a job is due while the previous run is still going.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip skips the run that is due. It is the default policy.
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue starts the run that is due once the previous run has finished. At most one run is queued, further
+	// runs that are due in the meantime are skipped.
+	OverlapQueue
+	// OverlapReplace cancels the previous run and starts the run that is due once the previous run has exited.
+	OverlapReplace
+)
+
+// Job is a command that is executed on a schedule.
+type Job struct {
+	// Name uniquely identifies the job within the scheduler.
+	Name string
+	// Command is the command executed by the executor of the scheduler.
+	Command string
+	// Schedule decides when the job is due.
+	Schedule Schedule
+	// Timeout is the timeout of every run, 0 means no timeout.
+	Timeout time.Duration
+	// Jitter delays every run by a random duration up to the jitter, which spreads out jobs with the same schedule.
+	Jitter time.Duration
+	// Overlap is the policy applied when a run is due while the previous run is still going.
+	Overlap OverlapPolicy
+}
+
+// Run is the report of a run of a job.
+type Run struct {
+	// Job is the name of the job.
+	Job string
+	// Command is the command of the job.
+	Command string
+	// Scheduled is the time the run was due, before the jitter was applied.
+	Scheduled time.Time
+	// StartTime and EndTime are the times the command was started and finished. They are zero for skipped runs.
+	StartTime time.Time
+	EndTime   time.Time
+	// Stdout and Stderr are the output of the command.
+	Stdout string
+	Stderr string
+	// ExitCode is the exit code of the command, or -1 if it failed to start or was terminated by a signal.
+	ExitCode int
+	// Err is the error the run failed with.
+	Err error
+	// TimedOut is set when the command was killed because the timeout of the job expired.
+	TimedOut bool
+	// Cancelled is set when the command was killed because it was replaced by a newer run or the scheduler was
+	// stopped.
+	Cancelled bool
+	// Skipped is set when the run wasn't started because the previous run was still going.
+	Skipped bool
+}
+
+// Option configures a Scheduler.
+type Option func(s *Scheduler)
+
+// WithHandler adds a function which is called with the report of every run, including skipped runs. It is called
+// from the goroutine of the run and may be called concurrently for different jobs.
+func WithHandler(handler func(run Run)) Option {
+	return func(s *Scheduler) {
+		s.handlers = append(s.handlers, handler)
+	}
+}
+
+// WithResults adds a channel receiving the report of every run, including skipped runs. Sending blocks, so the channel
+// must be drained until Stop has returned.
+func WithResults(results chan<- Run) Option {
+	return WithHandler(func(run Run) {
+		results <- run
+	})
+}
+
+// Scheduler executes jobs with an executor on their schedules. It is safe for concurrent use.
+type Scheduler struct {
+	executor execute.Executor
+	handlers []func(run Run)
+
+	mu      sync.Mutex
+	jobs    map[string]*entry
+	started bool
+	stopped bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	loops  sync.WaitGroup
+	runs   sync.WaitGroup
+}
+
+// entry is a job added to the scheduler. Its running and queued state is guarded by the mutex of the scheduler.
+type entry struct {
+	job      Job
+	stop     chan struct{}
+	removed  bool
+	running  *activeRun
+	queued   bool
+	queuedAt time.Time
+}
+
+// activeRun is a run of a job that has been started.
+type activeRun struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewScheduler returns a new Scheduler executing jobs with the executor. Jobs are only run once the scheduler has been
+// started.
+func NewScheduler(executor execute.Executor, options ...Option) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		executor: executor,
+		jobs:     make(map[string]*entry),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// Add adds the job to the scheduler. When the scheduler has already been started the job is scheduled immediately.
+func (s *Scheduler) Add(job Job) error {
+	switch {
+	case job.Name == "":
+		return errors.New("job name is empty")
+	case job.Command == "":
+		return fmt.Errorf("job %s: command is empty", job.Name)
+	case job.Schedule == nil:
+		return fmt.Errorf("job %s: schedule is nil", job.Name)
+	case job.Jitter < 0:
+		return fmt.Errorf("job %s: jitter is negative", job.Name)
+	}
+	if interval, ok := job.Schedule.(every); ok && interval <= 0 {
+		return fmt.Errorf("job %s: interval must be positive", job.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return ErrSchedulerStopped
+	}
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("job %s already exists", job.Name)
+	}
+	e := &entry{job: job, stop: make(chan struct{})}
+	s.jobs[job.Name] = e
+	if s.started {
+		s.loops.Add(1)
+		go s.loop(e)
+	}
+	return nil
+}
+
+// Remove removes the job from the scheduler. A run that is still going isn't interrupted, but a queued run is dropped.
+// Jobs can't be removed from a stopped scheduler.
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return ErrSchedulerStopped
+	}
+	e, ok := s.jobs[name]
+	if !ok {
+		return ErrJobNotFound
+	}
+	delete(s.jobs, name)
+	e.removed = true
+	e.queued = false
+	close(e.stop)
+	return nil
+}
+
+// Jobs returns the jobs of the scheduler sorted by name.
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, e := range s.jobs {
+		jobs = append(jobs, e.job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Name < jobs[j].Name
+	})
+	return jobs
+}
+
+// Start starts scheduling the jobs. Starting a scheduler that is already started or stopped has no effect.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started || s.stopped {
+		return
+	}
+	s.started = true
+	for _, e := range s.jobs {
+		s.loops.Add(1)
+		go s.loop(e)
+	}
+}
+
+// Stop stops scheduling jobs, drops the queued runs and waits for the runs that are still going to finish. Once the
+// context is done the remaining runs are cancelled and the error of the context is returned after they have exited. A
+// stopped scheduler can't be started again.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	for _, e := range s.jobs {
+		e.queued = false
+		close(e.stop)
+	}
+	s.mu.Unlock()
+	s.loops.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// loop triggers the runs of the job until it is removed or the scheduler is stopped.
+func (s *Scheduler) loop(e *entry) {
+	defer s.loops.Done()
+
+	now := time.Now()
+	for {
+		next := e.job.Schedule.Next(now)
+		if next.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(next) + jitter(e.job.Jitter))
+		select {
+		case <-e.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if skipped := s.trigger(e, next); skipped != nil {
+			s.report(*skipped)
+		}
+		if now = time.Now(); now.Before(next) {
+			now = next
+		}
+	}
+}
+
+// trigger applies the overlap policy of the job to the run that is due. It returns the report of the run if it was
+// skipped.
+func (s *Scheduler) trigger(e *entry, scheduled time.Time) *Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped || e.removed {
+		return nil
+	}
+	if e.running == nil {
+		s.start(e, scheduled, nil)
+		return nil
+	}
+
+	switch e.job.Overlap {
+	case OverlapQueue:
+		if !e.queued {
+			e.queued = true
+			e.queuedAt = scheduled
+			return nil
+		}
+	case OverlapReplace:
+		previous := e.running
+		previous.cancel()
+		s.start(e, scheduled, previous.done)
+		return nil
+	}
+	return &Run{Job: e.job.Name, Command: e.job.Command, Scheduled: scheduled, Skipped: true}
+}
+
+// start starts a run of the job once the previous run has exited. It must be called with the mutex held.
+func (s *Scheduler) start(e *entry, scheduled time.Time, previous <-chan struct{}) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	r := &activeRun{cancel: cancel, done: make(chan struct{})}
+	e.running = r
+	s.runs.Add(1)
+	go s.run(ctx, e, r, scheduled, previous)
+}
+
+// run executes the job, starts the queued run once it has finished and reports the result.
+func (s *Scheduler) run(ctx context.Context, e *entry, r *activeRun, scheduled time.Time, previous <-chan struct{}) {
+	defer s.runs.Done()
+	defer r.cancel()
+
+	if previous != nil {
+		<-previous
+	}
+	run := s.execute(ctx, e.job, scheduled)
+	close(r.done)
+
+	s.mu.Lock()
+	if e.running == r {
+		e.running = nil
+		if e.queued && !s.stopped && !e.removed {
+			e.queued = false
+			s.start(e, e.queuedAt, nil)
+		}
+	}
+	s.mu.Unlock()
+
+	s.report(run)
+}
+
+// execute executes the command of the job and returns the report of the run.
+func (s *Scheduler) execute(ctx context.Context, job Job, scheduled time.Time) Run {
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.Timeout)
+		defer cancel()
+	}
+
+	run := Run{Job: job.Name, Command: job.Command, Scheduled: scheduled, StartTime: time.Now()}
+	var err error
+	run.Stdout, run.Stderr, err = execute.Collect(ctx, s.executor, job.Command)
+	run.EndTime = time.Now()
+	run.ExitCode = execute.ExitCode(err)
+	run.Err = err
+	if err != nil && ctx.Err() != nil {
+		run.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+		run.Cancelled = !run.TimedOut
+	}
+	return run
+}
+
+// report passes the report of the run to the handlers.
+func (s *Scheduler) report(run Run) {
+	for _, handler := range s.handlers {
+		handler(run)
+	}
+}
+
+// jitter returns a random duration up to max.
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
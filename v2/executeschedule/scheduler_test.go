@@ -0,0 +1,209 @@
+package executeschedule
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+// collector records the reports of the runs of a scheduler.
+type collector struct {
+	mu   sync.Mutex
+	runs []Run
+}
+
+func (c *collector) handle(run Run) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.runs = append(c.runs, run)
+}
+
+// split returns the started and the skipped runs.
+func (c *collector) split() (started []Run, skipped []Run) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, run := range c.runs {
+		if run.Skipped {
+			skipped = append(skipped, run)
+		} else {
+			started = append(started, run)
+		}
+	}
+	return started, skipped
+}
+
+func TestCron(t *testing.T) {
+	base := time.Date(2024, 5, 1, 10, 2, 0, 0, time.UTC)
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"*/5 * * * *", time.Date(2024, 5, 1, 10, 5, 0, 0, time.UTC)},
+		{"30 0 3 * * *", time.Date(2024, 5, 2, 3, 0, 30, 0, time.UTC)},
+		{"CRON_TZ=UTC @daily", time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+		{"@every 1m", time.Date(2024, 5, 1, 10, 3, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		schedule, err := Cron(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.expr, err)
+		}
+		if next := schedule.Next(base).UTC(); !next.Equal(tt.expected) {
+			t.Errorf("%s: expected %s, but got %s", tt.expr, tt.expected, next)
+		}
+	}
+
+	if _, err := Cron("61 * * * *"); err == nil {
+		t.Errorf("Expected error, but got nil")
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires sleep and echo binaries")
+	}
+
+	t.Run("Scheduler_ReportsRunsToChannel", func(t *testing.T) {
+		results := make(chan Run, 16)
+		scheduler := NewScheduler(execute.NewExecutor(), WithResults(results))
+		if err := scheduler.Add(Job{Name: "echo", Command: "echo hello", Schedule: Every(20 * time.Millisecond)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		scheduler.Start()
+
+		for i := 0; i < 2; i++ {
+			select {
+			case run := <-results:
+				if run.Job != "echo" || run.Stdout != "hello\n" || run.ExitCode != 0 || run.Err != nil {
+					t.Errorf("Unexpected run: %+v", run)
+				}
+				if run.StartTime.Before(run.Scheduled) {
+					t.Errorf("Expected run to start after %s, but it started at %s", run.Scheduled, run.StartTime)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timed out waiting for run %d", i)
+			}
+		}
+
+		go func() {
+			for range results {
+			}
+		}()
+		if err := scheduler.Stop(context.Background()); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		close(results)
+	})
+
+	t.Run("Scheduler_SkipsOverlappingRuns", func(t *testing.T) {
+		c := &collector{}
+		scheduler := NewScheduler(execute.NewExecutor(), WithHandler(c.handle))
+		scheduler.Add(Job{Name: "slow", Command: "sleep 0.3", Schedule: Every(20 * time.Millisecond)})
+		scheduler.Start()
+		time.Sleep(200 * time.Millisecond)
+		scheduler.Stop(context.Background())
+
+		started, skipped := c.split()
+		if len(started) != 1 || len(skipped) == 0 {
+			t.Errorf("Expected 1 started and some skipped runs, but got %d and %d", len(started), len(skipped))
+		}
+	})
+
+	t.Run("Scheduler_QueuesOverlappingRuns", func(t *testing.T) {
+		c := &collector{}
+		scheduler := NewScheduler(execute.NewExecutor(), WithHandler(c.handle))
+		scheduler.Add(Job{Name: "slow", Command: "sleep 0.1", Schedule: Every(30 * time.Millisecond), Overlap: OverlapQueue})
+		scheduler.Start()
+		time.Sleep(350 * time.Millisecond)
+		scheduler.Stop(context.Background())
+
+		started, skipped := c.split()
+		if len(started) < 2 || len(skipped) == 0 {
+			t.Fatalf("Expected multiple started and some skipped runs, but got %d and %d", len(started), len(skipped))
+		}
+		for i := 1; i < len(started); i++ {
+			if started[i].StartTime.Before(started[i-1].EndTime) {
+				t.Errorf("Expected run %d to start after the previous run, but the runs overlap", i)
+			}
+		}
+	})
+
+	t.Run("Scheduler_ReplacesOverlappingRuns", func(t *testing.T) {
+		c := &collector{}
+		scheduler := NewScheduler(execute.NewExecutor(), WithHandler(c.handle))
+		scheduler.Add(Job{Name: "slow", Command: "sleep 5", Schedule: Every(50 * time.Millisecond), Overlap: OverlapReplace})
+		scheduler.Start()
+		time.Sleep(180 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := scheduler.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected deadline exceeded, but got %v", err)
+		}
+
+		started, skipped := c.split()
+		if len(started) < 2 || len(skipped) != 0 {
+			t.Fatalf("Expected multiple started and no skipped runs, but got %d and %d", len(started), len(skipped))
+		}
+		for _, run := range started {
+			if !run.Cancelled || run.Err == nil {
+				t.Errorf("Expected cancelled run, but got %+v", run)
+			}
+		}
+	})
+
+	t.Run("Scheduler_AppliesTimeout", func(t *testing.T) {
+		results := make(chan Run, 16)
+		scheduler := NewScheduler(execute.NewExecutor(), WithResults(results))
+		scheduler.Add(Job{Name: "slow", Command: "sleep 5", Schedule: Every(10 * time.Millisecond), Timeout: 50 * time.Millisecond})
+		scheduler.Start()
+		defer scheduler.Stop(context.Background())
+
+		for run := range results {
+			if run.Skipped {
+				continue
+			}
+			if !run.TimedOut || run.Cancelled || run.ExitCode != -1 {
+				t.Errorf("Expected timed out run, but got %+v", run)
+			}
+			go func() {
+				for range results {
+				}
+			}()
+			break
+		}
+	})
+
+	t.Run("Scheduler_ValidatesJobs", func(t *testing.T) {
+		scheduler := NewScheduler(execute.NewExecutor())
+		job := Job{Name: "job", Command: "true", Schedule: Every(time.Minute)}
+		if err := scheduler.Add(job); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := scheduler.Add(job); err == nil {
+			t.Errorf("Expected error for duplicate job, but got nil")
+		}
+		if err := scheduler.Add(Job{Name: "zero", Command: "true", Schedule: Every(0)}); err == nil {
+			t.Errorf("Expected error for zero interval, but got nil")
+		}
+		if err := scheduler.Remove("missing"); !errors.Is(err, ErrJobNotFound) {
+			t.Errorf("Expected ErrJobNotFound, but got %v", err)
+		}
+		if jobs := scheduler.Jobs(); len(jobs) != 1 || jobs[0].Name != "job" {
+			t.Errorf("Unexpected jobs: %+v", jobs)
+		}
+
+		scheduler.Stop(context.Background())
+		if err := scheduler.Add(Job{Name: "late", Command: "true", Schedule: Every(time.Minute)}); !errors.Is(err, ErrSchedulerStopped) {
+			t.Errorf("Expected ErrSchedulerStopped, but got %v", err)
+		}
+		if err := scheduler.Remove("job"); !errors.Is(err, ErrSchedulerStopped) {
+			t.Errorf("Expected ErrSchedulerStopped, but got %v", err)
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package executessh
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ExitError is returned when a remote process exits with a non-zero status or is terminated by a signal.
+type ExitError struct {
+	// Status is the exit status of the process, or -1 if it was terminated by a signal.
+	Status int
+	// Signal is the name of the signal, without the SIG prefix, which terminated the process.
+	Signal string
+	// Msg is the error message reported by the server.
+	Msg string
+}
+
+// ExitCode returns the exit status of the process, or -1 if it was terminated by a signal.
+func (e *ExitError) ExitCode() int {
+	return e.Status
+}
+
+func (e *ExitError) Error() string {
+	switch {
+	case e.Signal != "" && e.Msg != "":
+		return fmt.Sprintf("remote process terminated by signal %s: %s", e.Signal, e.Msg)
+	case e.Signal != "":
+		return fmt.Sprintf("remote process terminated by signal %s", e.Signal)
+	}
+	return fmt.Sprintf("remote process exited with status %d", e.Status)
+}
+
+// exitError converts the errors of an SSH session into an ExitError.
+func exitError(err error) error {
+	var sshErr *ssh.ExitError
+	if errors.As(err, &sshErr) {
+		exitErr := &ExitError{Status: sshErr.ExitStatus(), Signal: sshErr.Signal(), Msg: sshErr.Msg()}
+		if exitErr.Signal != "" {
+			exitErr.Status = -1
+		}
+		return exitErr
+	}
+	var missing *ssh.ExitMissingError
+	if errors.As(err, &missing) {
+		return &ExitError{Status: -1, Msg: missing.Error()}
+	}
+	return err
+}
@@ -0,0 +1,180 @@
+// Package executessh provides an execute.Executor which runs commands on a remote host over SSH.
+//
+// Commands are resolved by the regular executor and started through an SSH transport, so the shell and sudo
+// handling, scripts, timeouts, dry-run mode, auditing, middleware and hooks work the same way as for local commands.
+// The remote host is expected to provide a POSIX shell.
+//
+//	auth, agentConn, err := executessh.Agent()
+//	...
+//	defer agentConn.Close()
+//	e, err := executessh.Dial("host:22", executessh.Config{User: "deploy", Auth: []ssh.AuthMethod{auth}})
+//	...
+//	defer e.Close()
+//	out, err := e.Execute("uptime")
+package executessh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Config configures the SSH connection created by Dial.
+type Config struct {
+	// User is the user to authenticate as.
+	User string
+	// Auth are the authentication methods, which are tried in order.
+	Auth []ssh.AuthMethod
+	// KnownHostsFiles are the known_hosts files used to verify the host key, ~/.ssh/known_hosts by default.
+	KnownHostsFiles []string
+	// HostKeyCallback verifies the host key instead of the known_hosts files when it is set.
+	HostKeyCallback ssh.HostKeyCallback
+	// Timeout is the maximum time to wait for the connection to be established. 0 means no timeout.
+	Timeout time.Duration
+}
+
+// Executor is an execute.ConfigurableExecutor running commands on a remote host.
+type Executor struct {
+	execute.ConfigurableExecutor
+	client *ssh.Client
+}
+
+// Dial connects to the SSH server at addr and returns an Executor using the connection. The host key is verified
+// against the known_hosts files unless a HostKeyCallback is set.
+func Dial(addr string, config Config, options ...execute.Option) (*Executor, error) {
+	hostKeyCallback := config.HostKeyCallback
+	if hostKeyCallback == nil {
+		files := config.KnownHostsFiles
+		if len(files) == 0 {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to find known_hosts: %w", err)
+			}
+			files = []string{filepath.Join(home, ".ssh", "known_hosts")}
+		}
+		callback, err := KnownHosts(files...)
+		if err != nil {
+			return nil, err
+		}
+		hostKeyCallback = callback
+	}
+
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            config.User,
+		Auth:            config.Auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         config.Timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	return NewExecutor(client, options...), nil
+}
+
+// NewExecutor returns an Executor running commands through an existing SSH client. Closing the Executor closes the
+// client.
+func NewExecutor(client *ssh.Client, options ...execute.Option) *Executor {
+	e := execute.NewExecutor(options...)
+	e.SetTransport(NewTransport(client))
+	return &Executor{ConfigurableExecutor: e, client: client}
+}
+
+// Client returns the SSH client of the executor.
+func (e *Executor) Client() *ssh.Client {
+	return e.client
+}
+
+// ExecuteAsyncWithContext executes the command on the remote host and kills it when the context is done.
+func (e *Executor) ExecuteAsyncWithContext(ctx context.Context, command string) (*execute.ExecutionResult, error) {
+	return e.ConfigurableExecutor.(execute.ContextExecutor).ExecuteAsyncWithContext(ctx, command)
+}
+
+// ExecuteSpecAsync executes the command described by the spec on the remote host.
+func (e *Executor) ExecuteSpecAsync(ctx context.Context, spec *execute.CommandSpec) (*execute.ExecutionResult, error) {
+	return e.ConfigurableExecutor.(execute.SpecExecutor).ExecuteSpecAsync(ctx, spec)
+}
+
+// ExecuteScriptFromStringWithParameters executes the script with typed parameters on the remote host.
+func (e *Executor) ExecuteScriptFromStringWithParameters(scriptType execute.ScriptType, script string, arguments []string, parameters execute.ScriptParameters, timeout time.Duration) (stdout string, stderr string, err error) {
+	return e.ConfigurableExecutor.(execute.TypedScriptExecutor).ExecuteScriptFromStringWithParameters(scriptType, script, arguments, parameters, timeout)
+}
+
+// ExecuteScriptFromFileWithParameters executes the script with typed parameters on the remote host.
+func (e *Executor) ExecuteScriptFromFileWithParameters(scriptType execute.ScriptType, scriptPath string, arguments []string, parameters execute.ScriptParameters, timeout time.Duration) (stdout string, stderr string, err error) {
+	return e.ConfigurableExecutor.(execute.TypedScriptExecutor).ExecuteScriptFromFileWithParameters(scriptType, scriptPath, arguments, parameters, timeout)
+}
+
+// ExecuteScriptFromStringWithContext executes the script on the remote host and kills it when the context is done.
+func (e *Executor) ExecuteScriptFromStringWithContext(ctx context.Context, scriptType execute.ScriptType, script string, arguments []string, parameters execute.ScriptParameters) (stdout string, stderr string, err error) {
+	return e.ConfigurableExecutor.(execute.ContextScriptExecutor).ExecuteScriptFromStringWithContext(ctx, scriptType, script, arguments, parameters)
+}
+
+// Close clears the sudo password and closes the SSH connection.
+func (e *Executor) Close() {
+	e.ConfigurableExecutor.Close()
+	e.client.Close()
+}
+
+// Password returns an authentication method using the password.
+func Password(password string) ssh.AuthMethod {
+	return ssh.Password(password)
+}
+
+// Key returns an authentication method using the PEM encoded private key. The passphrase is only used for encrypted
+// keys.
+func Key(pemBytes []byte, passphrase string) (ssh.AuthMethod, error) {
+	var signer ssh.Signer
+	var err error
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(pemBytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return ssh.PublicKeys(signer), nil
+}
+
+// KeyFile returns an authentication method using the private key in the file.
+func KeyFile(path string, passphrase string) (ssh.AuthMethod, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	return Key(pemBytes, passphrase)
+}
+
+// Agent returns an authentication method using the keys of the SSH agent listening on SSH_AUTH_SOCK. The connection
+// to the agent is used whenever a key signs a handshake and must be closed with the returned io.Closer once the
+// authentication method is no longer needed.
+func Agent() (ssh.AuthMethod, io.Closer, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, errors.New("SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to the SSH agent: %w", err)
+	}
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), conn, nil
+}
+
+// KnownHosts returns a host key callback verifying host keys against the known_hosts files.
+func KnownHosts(files ...string) (ssh.HostKeyCallback, error) {
+	callback, err := knownhosts.New(files...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known_hosts: %w", err)
+	}
+	return callback, nil
+}
@@ -0,0 +1,458 @@
+package executessh
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testServer is an SSH server running the requested commands locally with sh.
+type testServer struct {
+	addr       string
+	hostKey    ssh.Signer
+	clientKey  ssh.Signer
+	knownHosts string
+
+	mu   sync.Mutex
+	envs [][]string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	s := &testServer{hostKey: newSigner(t), clientKey: newSigner(t)}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "tester" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("invalid password")
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(s.clientKey.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	config.AddHostKey(s.hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	s.addr = listener.Addr().String()
+
+	s.knownHosts = filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.addr)}, s.hostKey.PublicKey())
+	if err := os.WriteFile(s.knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write known_hosts: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *testServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.session(channel, requests)
+	}
+}
+
+func (s *testServer) session(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	var env []string
+	var cmd *exec.Cmd
+	exited := make(chan uint32, 1)
+
+	for {
+		select {
+		case status := <-exited:
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			return
+		case req, ok := <-requests:
+			if !ok {
+				if cmd != nil && cmd.Process != nil {
+					cmd.Process.Kill()
+				}
+				return
+			}
+			switch req.Type {
+			case "env":
+				var kv struct{ Name, Value string }
+				ssh.Unmarshal(req.Payload, &kv)
+				env = append(env, kv.Name+"="+kv.Value)
+				req.Reply(true, nil)
+			case "pty-req":
+				req.Reply(true, nil)
+			case "exec":
+				var payload struct{ Command string }
+				ssh.Unmarshal(req.Payload, &payload)
+				s.mu.Lock()
+				s.envs = append(s.envs, env)
+				s.mu.Unlock()
+
+				cmd = exec.Command("sh", "-c", payload.Command)
+				cmd.Env = append(os.Environ(), env...)
+				cmd.Stdout = channel
+				cmd.Stderr = channel.Stderr()
+				stdin, _ := cmd.StdinPipe()
+				if err := cmd.Start(); err != nil {
+					req.Reply(false, nil)
+					return
+				}
+				req.Reply(true, nil)
+				go func() {
+					io.Copy(stdin, channel)
+					stdin.Close()
+				}()
+				go func() {
+					cmd.Wait()
+					exited <- uint32(cmd.ProcessState.ExitCode())
+				}()
+			case "signal":
+				var payload struct{ Signal string }
+				ssh.Unmarshal(req.Payload, &payload)
+				if cmd != nil && cmd.Process != nil {
+					switch ssh.Signal(payload.Signal) {
+					case ssh.SIGTERM:
+						cmd.Process.Signal(syscall.SIGTERM)
+					case ssh.SIGKILL:
+						cmd.Process.Kill()
+					}
+				}
+				if req.WantReply {
+					req.Reply(true, nil)
+				}
+			default:
+				if req.WantReply {
+					req.Reply(false, nil)
+				}
+			}
+		}
+	}
+}
+
+func newSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	return signer
+}
+
+func (s *testServer) dial(t *testing.T, options ...execute.Option) *Executor {
+	t.Helper()
+	e, err := Dial(s.addr, Config{
+		User:            "tester",
+		Auth:            []ssh.AuthMethod{Password("secret")},
+		KnownHostsFiles: []string{s.knownHosts},
+		Timeout:         5 * time.Second,
+	}, options...)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(e.Close)
+	return e
+}
+
+func TestExecute(t *testing.T) {
+	e := newTestServer(t).dial(t)
+
+	out, err := e.Execute("echo hello world")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "hello world\n" {
+		t.Errorf("expected %q, got %q", "hello world\n", out)
+	}
+}
+
+func TestExecuteEnvAndDir(t *testing.T) {
+	s := newTestServer(t)
+	dir := t.TempDir()
+	e := s.dial(t, execute.WithShell("sh"), execute.WithEnvironment([]string{"GREETING=it's me"}), execute.WithWorkingDir(dir))
+
+	out, err := e.Execute(`echo "$GREETING"; pwd`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	real, _ := filepath.EvalSymlinks(dir)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || lines[0] != "it's me" || (lines[1] != dir && lines[1] != real) {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestExecuteExitCode(t *testing.T) {
+	e := newTestServer(t).dial(t, execute.WithShell("sh"))
+
+	_, err := e.Execute("echo failed >&2; exit 3")
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected an ExitError, got %v", err)
+	}
+	if exitErr.ExitCode() != 3 {
+		t.Errorf("expected exit code 3, got %d", exitErr.ExitCode())
+	}
+
+	_, err = e.Execute("exec this-binary-does-not-exist")
+	if err == nil {
+		t.Error("expected an error for a missing binary")
+	}
+}
+
+func TestExecuteAsyncStreaming(t *testing.T) {
+	e := newTestServer(t).dial(t, execute.WithShell("sh"))
+
+	result, err := e.ExecuteAsync("echo one; sleep 0.2; echo two >&2; echo three")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var stderr string
+	done := make(chan struct{})
+	go func() {
+		b, _ := io.ReadAll(result.Stderr)
+		stderr = string(b)
+		close(done)
+	}()
+	var lines []string
+	scanner := bufio.NewScanner(result.Stdout)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	<-done
+
+	if strings.Join(lines, ",") != "one,three" {
+		t.Errorf("unexpected stdout lines %v", lines)
+	}
+	if stderr != "two\n" {
+		t.Errorf("unexpected stderr %q", stderr)
+	}
+	if err := <-result.Finished; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	e := newTestServer(t).dial(t)
+
+	start := time.Now()
+	_, err := e.ExecuteWithTimeout("sleep 10", 200*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected an error for a command that timed out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the command to be terminated, took %v", elapsed)
+	}
+}
+
+func TestExecuteScript(t *testing.T) {
+	e := newTestServer(t).dial(t)
+
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+	out, _, err := e.ExecuteScriptFromString(execute.ScriptTypeBash, "echo \"$1-$2\"", []string{"a", "b"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "a-b\n" {
+		t.Errorf("expected %q, got %q", "a-b\n", out)
+	}
+}
+
+func TestTransportStageFile(t *testing.T) {
+	e := newTestServer(t).dial(t)
+	transport := e.Transport().(*Transport)
+
+	path, err := transport.StageFile([]byte("data"), ".txt", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(path, ".txt") {
+		t.Errorf("expected the extension to be kept, got %q", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("staged file not found: %v", err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("expected mode 0700, got %v", info.Mode().Perm())
+	}
+	if b, _ := os.ReadFile(path); string(b) != "data" {
+		t.Errorf("unexpected contents %q", b)
+	}
+
+	if err := transport.RemoveFile(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+		t.Errorf("expected the staging directory to be removed, got %v", err)
+	}
+}
+
+func TestRemoteCommand(t *testing.T) {
+	spec := &execute.CommandSpec{
+		Path:     "/bin/echo",
+		Args:     []string{"a b"},
+		Env:      []string{"A=1"},
+		ExtraEnv: []string{"B=it's"},
+		Dir:      "/tmp/x y",
+		User:     "nobody",
+	}
+	expected := `'cd' '/tmp/x y' && exec 'sudo' '-n' '-u' 'nobody' '--' 'env' 'A=1' 'B=it'\''s' '/bin/echo' 'a b'`
+	if got := remoteCommand(spec); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestDialKnownHosts(t *testing.T) {
+	s := newTestServer(t)
+
+	other := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.addr)}, newSigner(t).PublicKey())
+	os.WriteFile(other, []byte(line+"\n"), 0600)
+
+	_, err := Dial(s.addr, Config{
+		User:            "tester",
+		Auth:            []ssh.AuthMethod{Password("secret")},
+		KnownHostsFiles: []string{other},
+	})
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		t.Errorf("expected a host key mismatch, got %v", err)
+	}
+}
+
+func TestDialInvalidPassword(t *testing.T) {
+	s := newTestServer(t)
+
+	_, err := Dial(s.addr, Config{User: "tester", Auth: []ssh.AuthMethod{Password("wrong")}, KnownHostsFiles: []string{s.knownHosts}})
+	if err == nil {
+		t.Error("expected an error for an invalid password")
+	}
+}
+
+func TestDialKeyAuth(t *testing.T) {
+	s := newTestServer(t)
+
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	s.clientKey, _ = ssh.NewSignerFromKey(key)
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600)
+
+	auth, err := KeyFile(keyFile, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	e, err := Dial(s.addr, Config{User: "tester", Auth: []ssh.AuthMethod{auth}, KnownHostsFiles: []string{s.knownHosts}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer e.Close()
+	if out, err := e.Execute("echo key"); err != nil || out != "key\n" {
+		t.Errorf("unexpected result %q, %v", out, err)
+	}
+}
+
+func TestDialAgentAuth(t *testing.T) {
+	s := newTestServer(t)
+
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	s.clientKey, _ = ssh.NewSignerFromKey(key)
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatalf("failed to add key to agent: %v", err)
+	}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets are not available: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", socket)
+
+	auth, agentConn, err := Agent()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	e, err := Dial(s.addr, Config{User: "tester", Auth: []ssh.AuthMethod{auth}, KnownHostsFiles: []string{s.knownHosts}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer e.Close()
+	if out, err := e.Execute("echo agent"); err != nil || out != "agent\n" {
+		t.Errorf("unexpected result %q, %v", out, err)
+	}
+
+	if err := agentConn.Close(); err != nil {
+		t.Fatalf("unexpected error closing the agent connection: %v", err)
+	}
+	if _, err := Dial(s.addr, Config{User: "tester", Auth: []ssh.AuthMethod{auth}, KnownHostsFiles: []string{s.knownHosts}}); err == nil {
+		t.Errorf("expected authentication to fail after the agent connection was closed")
+	}
+}
@@ -0,0 +1,307 @@
+package executessh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// lookPathScript resolves a binary in the PATH of the remote user. `command -v` is not used since it returns the
+// names of shell builtins instead of their binaries.
+const lookPathScript = `case $1 in */*) if [ -x "$1" ] && [ ! -d "$1" ]; then echo "$1"; exit 0; fi; exit 1;; esac
+IFS=:; for d in $PATH; do [ -z "$d" ] && d=.; if [ -x "$d/$1" ] && [ ! -d "$d/$1" ]; then echo "$d/$1"; exit 0; fi; done; exit 1`
+
+// stageScript writes stdin to a new file in a private temporary directory and prints its path.
+const stageScript = `umask 077 && d=$(mktemp -d "${TMPDIR:-/tmp}/go-execute-XXXXXX") && cat > "$d/script$1" && chmod 700 "$d/script$1" && echo "$d/script$1"`
+
+// Transport is an execute.Transport starting processes on a remote host over SSH.
+type Transport struct {
+	// Term is the terminal type requested for commands executed with a TTY, "xterm-256color" by default.
+	Term string
+	// KillGracePeriod is the time between the SIGTERM and SIGKILL signals sent to a process when its timeout
+	// expires, 2 seconds by default.
+	KillGracePeriod time.Duration
+
+	client *ssh.Client
+	mu     sync.Mutex
+	paths  map[string]string
+	owners map[string]string
+}
+
+// NewTransport returns a transport using the SSH client.
+func NewTransport(client *ssh.Client) *Transport {
+	return &Transport{
+		Term:            "xterm-256color",
+		KillGracePeriod: 2 * time.Second,
+		client:          client,
+		paths:           map[string]string{},
+		owners:          map[string]string{},
+	}
+}
+
+// LookPath resolves the binary in the PATH of the remote user. Results are cached for the lifetime of the transport.
+func (t *Transport) LookPath(binary string) (string, error) {
+	t.mu.Lock()
+	resolved, ok := t.paths[binary]
+	t.mu.Unlock()
+	if ok {
+		return resolved, nil
+	}
+
+	out, err := t.output(shellCommand("sh", "-c", lookPathScript, "sh", binary), nil)
+	resolved = strings.TrimSpace(string(out))
+	if err != nil || resolved == "" {
+		return "", &exec.Error{Name: binary, Err: exec.ErrNotFound}
+	}
+
+	t.mu.Lock()
+	t.paths[binary] = resolved
+	t.mu.Unlock()
+	return resolved, nil
+}
+
+// Start starts the process described by the spec on the remote host.
+func (t *Transport) Start(ctx context.Context, spec *execute.CommandSpec) (execute.Process, error) {
+	session, err := t.client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSH session: %w", err)
+	}
+	p := &process{session: session, ctx: ctx, done: make(chan struct{})}
+	session.Stdin = spec.Stdin
+
+	if spec.TTY {
+		if err := p.attachTerminal(t.Term); err != nil {
+			session.Close()
+			return nil, err
+		}
+	} else {
+		stdout, err := session.StdoutPipe()
+		if err != nil {
+			session.Close()
+			return nil, err
+		}
+		stderr, err := session.StderrPipe()
+		if err != nil {
+			session.Close()
+			return nil, err
+		}
+		p.stdout, p.stderr = stdout, stderr
+	}
+
+	if err := session.Start(remoteCommand(spec)); err != nil {
+		p.restoreTerminal()
+		session.Close()
+		return nil, fmt.Errorf("failed to start remote command: %w", err)
+	}
+
+	go p.killOnDone(t.KillGracePeriod)
+	return p, nil
+}
+
+// StageFile writes the data to a new file in a private temporary directory on the remote host. When owner is set
+// the directory is handed over to the owner with sudo.
+func (t *Transport) StageFile(data []byte, extension string, owner string) (string, error) {
+	out, err := t.output(shellCommand("sh", "-c", stageScript, "sh", extension), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	staged := strings.TrimSpace(string(out))
+	if staged == "" {
+		return "", fmt.Errorf("failed to stage file on the remote host")
+	}
+
+	if owner != "" {
+		if _, err := t.output(shellCommand("sudo", "-n", "chown", "-R", owner, path.Dir(staged)), nil); err != nil {
+			t.RemoveFile(staged)
+			return "", fmt.Errorf("failed to change the owner of the staged file to %s: %w", owner, err)
+		}
+		t.mu.Lock()
+		t.owners[staged] = owner
+		t.mu.Unlock()
+	}
+	return staged, nil
+}
+
+// RemoveFile removes a file staged by StageFile together with its temporary directory.
+func (t *Transport) RemoveFile(file string) error {
+	t.mu.Lock()
+	owner := t.owners[file]
+	delete(t.owners, file)
+	t.mu.Unlock()
+
+	argv := []string{"rm", "-rf", "--", path.Dir(file)}
+	if owner != "" {
+		argv = append([]string{"sudo", "-n"}, argv...)
+	}
+	_, err := t.output(shellCommand(argv...), nil)
+	return err
+}
+
+// output runs the command in a new session and returns its stdout.
+func (t *Transport) output(command string, stdin io.Reader) ([]byte, error) {
+	session, err := t.client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSH session: %w", err)
+	}
+	defer session.Close()
+	session.Stdin = stdin
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	out, err := session.Output(command)
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return out, fmt.Errorf("%w: %s", exitError(err), msg)
+		}
+		return out, exitError(err)
+	}
+	return out, nil
+}
+
+// process is a process running in an SSH session.
+type process struct {
+	session *ssh.Session
+	ctx     context.Context
+	done    chan struct{}
+	stdout  io.Reader
+	stderr  io.Reader
+
+	termFd    int
+	termState *term.State
+}
+
+// Stdout returns the stdout of the process.
+func (p *process) Stdout() io.Reader {
+	return p.stdout
+}
+
+// Stderr returns the stderr of the process.
+func (p *process) Stderr() io.Reader {
+	return p.stderr
+}
+
+// Wait waits for the process to exit and closes the session.
+func (p *process) Wait() error {
+	err := p.session.Wait()
+	close(p.done)
+	p.session.Close()
+	p.restoreTerminal()
+
+	if err != nil && p.ctx.Err() != nil {
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) {
+			// The session was closed before the remote process reported its exit
+			return &ExitError{Status: -1, Signal: "KILL", Msg: p.ctx.Err().Error()}
+		}
+	}
+	return exitError(err)
+}
+
+// killOnDone signals the process once its context is done, first with SIGTERM and then with SIGKILL, and finally
+// closes the session in case the server doesn't support signals.
+func (p *process) killOnDone(grace time.Duration) {
+	select {
+	case <-p.done:
+		return
+	case <-p.ctx.Done():
+	}
+
+	p.session.Signal(ssh.SIGTERM)
+	select {
+	case <-p.done:
+		return
+	case <-time.After(grace):
+	}
+	p.session.Signal(ssh.SIGKILL)
+	select {
+	case <-p.done:
+		return
+	case <-time.After(grace):
+	}
+	p.session.Close()
+}
+
+// attachTerminal requests a pty for the session and attaches it to the terminal of the current process.
+func (p *process) attachTerminal(termType string) error {
+	width, height := 80, 24
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		if w, h, err := term.GetSize(fd); err == nil {
+			width, height = w, h
+		}
+	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := p.session.RequestPty(termType, height, width, modes); err != nil {
+		return fmt.Errorf("failed to request a pty: %w", err)
+	}
+	p.session.Stdout = os.Stdout
+	p.session.Stderr = os.Stderr
+
+	if term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("failed to put the terminal into raw mode: %w", err)
+		}
+		p.termFd, p.termState = fd, state
+	}
+	return nil
+}
+
+// restoreTerminal restores the terminal of the current process if it was put into raw mode.
+func (p *process) restoreTerminal() {
+	if p.termState != nil {
+		term.Restore(p.termFd, p.termState)
+		p.termState = nil
+	}
+}
+
+// remoteCommand returns the command line executed by the remote shell for the spec.
+func remoteCommand(spec *execute.CommandSpec) string {
+	var b strings.Builder
+	if spec.Dir != "" {
+		b.WriteString(shellCommand("cd", spec.Dir))
+		b.WriteString(" && ")
+	}
+	b.WriteString("exec ")
+
+	var argv []string
+	if spec.User != "" {
+		argv = append(argv, "sudo", "-n", "-u", spec.User, "--")
+	}
+	if env := spec.Environ(nil); len(env) > 0 {
+		argv = append(append(argv, "env"), env...)
+	}
+	argv = append(argv, spec.Path)
+	argv = append(argv, spec.Args...)
+	b.WriteString(shellCommand(argv...))
+	return b.String()
+}
+
+// shellCommand returns the words quoted for a POSIX shell.
+func shellCommand(words ...string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i], _ = execute.QuoteShell(word)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Ensure the Transport implements the execute.FileTransport interface.
+var _ execute.FileTransport = (*Transport)(nil)
@@ -0,0 +1,392 @@
+// Package executesupervisor keeps long-running commands, such as tunnels and agents, alive as children of the current
+// process.
+//
+// A Supervisor starts every process added to it and restarts it when it exits according to its restart policy, with
+// an exponential backoff between restarts. A process that keeps crashing is given up on once it exceeds its restart
+// limit. Cancelling the context passed to Run stops all processes, which are asked to exit and killed after the grace
+// period of the executor:
+//
+//	supervisor := executesupervisor.New(execute.NewExecutor(execute.WithGracePeriod(5 * time.Second)))
+//	supervisor.Add(executesupervisor.Process{
+//		Name:        "tunnel",
+//		Command:     "ssh -N -L 5432:localhost:5432 db.example.com",
+//		Restart:     executesupervisor.RestartAlways,
+//		MaxRestarts: 5,
+//		Window:      time.Minute,
+//		Stderr:      os.Stderr,
+//	})
+//	err := supervisor.Run(ctx)
+package executesupervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+const (
+	// defaultInitialBackoff is the delay before the first restart when the process doesn't set one.
+	defaultInitialBackoff = time.Second
+	// defaultMaxBackoff is the maximum delay between restarts when the process doesn't set one.
+	defaultMaxBackoff = time.Minute
+	// defaultMinUptime is how long a process must run before its backoff is reset when it doesn't set a duration.
+	defaultMinUptime = 10 * time.Second
+)
+
+var (
+	// ErrCrashLoop is returned by Run for processes that were given up on because they exceeded their restart limit.
+	ErrCrashLoop = errors.New("process is crash looping")
+	// ErrSupervisorStarted is returned when adding processes to a supervisor that has already been started, or
+	// running it a second time.
+	ErrSupervisorStarted = errors.New("supervisor has already been started")
+)
+
+// RestartPolicy decides whether a process is restarted when it exits.
+type RestartPolicy int
+
+const (
+	// RestartAlways restarts the process whenever it exits. It is the default policy.
+	RestartAlways RestartPolicy = iota
+	// RestartOnFailure restarts the process when it failed to start or exited with a non-zero exit code.
+	RestartOnFailure
+	// RestartNever never restarts the process.
+	RestartNever
+)
+
+// Process is a command kept alive by a supervisor.
+type Process struct {
+	// Name uniquely identifies the process within the supervisor.
+	Name string
+	// Command is the command executed by the executor of the supervisor.
+	Command string
+	// Restart is the policy deciding whether the process is restarted when it exits.
+	Restart RestartPolicy
+	// InitialBackoff is the delay before the first restart, which doubles after every restart up to MaxBackoff. They
+	// default to 1s and 1m.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MinUptime is how long the process must run for its backoff to be reset, 10s by default. Exits before that are
+	// treated as crashes.
+	MinUptime time.Duration
+	// MaxRestarts is the number of restarts allowed within Window before the process is considered to be crash
+	// looping and given up on. 0 allows unlimited restarts, and a Window of 0 counts all restarts.
+	MaxRestarts int
+	Window      time.Duration
+	// Stdout and Stderr receive the output of the process, which is discarded when they are nil. A writer shared by
+	// both streams or by several processes must be safe for concurrent use.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// State is the state of a supervised process.
+type State string
+
+const (
+	// StatePending is the state of a process that hasn't been started yet.
+	StatePending State = "pending"
+	// StateRunning is the state of a process that is running.
+	StateRunning State = "running"
+	// StateBackoff is the state of a process that is waiting to be restarted.
+	StateBackoff State = "backoff"
+	// StateExited is the state of a process that exited and isn't restarted according to its restart policy.
+	StateExited State = "exited"
+	// StateCrashLoop is the state of a process that was given up on because it exceeded its restart limit.
+	StateCrashLoop State = "crash-loop"
+	// StateStopped is the state of a process that was stopped because the supervisor was shut down.
+	StateStopped State = "stopped"
+)
+
+// Status describes a supervised process.
+type Status struct {
+	// Name is the name of the process.
+	Name string
+	// State is the state of the process.
+	State State
+	// Restarts is the number of times the process has been restarted.
+	Restarts int
+	// StartTime is the time the process was last started.
+	StartTime time.Time
+	// ExitCode and Err describe the last exit of the process. ExitCode is -1 if it didn't exit normally.
+	ExitCode int
+	Err      error
+}
+
+// EventType is the type of an Event.
+type EventType string
+
+const (
+	// EventStarted is sent when the process has been started.
+	EventStarted EventType = "started"
+	// EventExited is sent when the process has exited or failed to start.
+	EventExited EventType = "exited"
+	// EventRestarting is sent when the process is going to be restarted after the backoff.
+	EventRestarting EventType = "restarting"
+	// EventCrashLoop is sent when the process is given up on because it exceeded its restart limit.
+	EventCrashLoop EventType = "crash-loop"
+	// EventStopped is sent when the process has been stopped because the supervisor was shut down.
+	EventStopped EventType = "stopped"
+)
+
+// Event is a change of the state of a supervised process.
+type Event struct {
+	// Process is the name of the process.
+	Process string
+	// Type is the type of the event.
+	Type EventType
+	// Time is the time of the event.
+	Time time.Time
+	// Restarts is the number of times the process has been restarted.
+	Restarts int
+	// ExitCode and Err describe the exit of the process for exited events.
+	ExitCode int
+	Err      error
+	// Uptime is how long the process was running for exited events.
+	Uptime time.Duration
+	// Backoff is the delay before the restart for restarting events.
+	Backoff time.Duration
+}
+
+// Option configures a Supervisor.
+type Option func(s *Supervisor)
+
+// WithHandler adds a function which is called with every event. It is called from the goroutine supervising the
+// process and may be called concurrently for different processes.
+func WithHandler(handler func(event Event)) Option {
+	return func(s *Supervisor) {
+		s.handlers = append(s.handlers, handler)
+	}
+}
+
+// Supervisor keeps processes alive with an executor. It is safe for concurrent use.
+type Supervisor struct {
+	executor execute.Executor
+	handlers []func(event Event)
+
+	mu        sync.Mutex
+	processes []*process
+	started   bool
+}
+
+// process is the state of a supervised process, guarded by the mutex of the supervisor.
+type process struct {
+	Process
+	status Status
+}
+
+// New returns a new Supervisor executing processes with the executor. The grace period of the executor is how long
+// processes are given to exit when the supervisor is shut down before they are killed.
+func New(executor execute.Executor, options ...Option) *Supervisor {
+	s := &Supervisor{executor: executor}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// Add adds the process to the supervisor. Processes must be added before the supervisor is started.
+func (s *Supervisor) Add(p Process) error {
+	switch {
+	case p.Name == "":
+		return errors.New("process name is empty")
+	case p.Command == "":
+		return fmt.Errorf("process %s: command is empty", p.Name)
+	case p.InitialBackoff < 0 || p.MaxBackoff < 0 || p.MinUptime < 0 || p.Window < 0:
+		return fmt.Errorf("process %s: durations must not be negative", p.Name)
+	case p.MaxRestarts < 0:
+		return fmt.Errorf("process %s: max restarts must not be negative", p.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return ErrSupervisorStarted
+	}
+	for _, existing := range s.processes {
+		if existing.Name == p.Name {
+			return fmt.Errorf("process %s already exists", p.Name)
+		}
+	}
+	s.processes = append(s.processes, &process{Process: p, status: Status{Name: p.Name, State: StatePending}})
+	return nil
+}
+
+// Status returns the status of every process sorted by name.
+func (s *Supervisor) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]Status, len(s.processes))
+	for i, p := range s.processes {
+		statuses[i] = p.status
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// Run starts all processes and supervises them until the context is done, when they are stopped, or until none of
+// them is restarted anymore. It returns once every process has exited. The returned error wraps ErrCrashLoop for every
+// process that was given up on, and is nil otherwise, including after a shutdown through the context.
+func (s *Supervisor) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return ErrSupervisorStarted
+	}
+	s.started = true
+	processes := s.processes
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(len(processes))
+	for _, p := range processes {
+		go func(p *process) {
+			defer wg.Done()
+			s.supervise(ctx, p)
+		}(p)
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, status := range s.Status() {
+		if status.State == StateCrashLoop {
+			errs = append(errs, fmt.Errorf("%s: %w", status.Name, ErrCrashLoop))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// supervise runs the process and restarts it according to its policy until it is stopped or given up on.
+func (s *Supervisor) supervise(ctx context.Context, p *process) {
+	var restarts []time.Time
+	crashes := 0
+	for {
+		start := time.Now()
+		s.update(p, func(status *Status) {
+			status.State = StateRunning
+			status.StartTime = start
+		})
+		s.report(p, Event{Type: EventStarted})
+
+		err := s.execute(ctx, p)
+		uptime := time.Since(start)
+		s.update(p, func(status *Status) {
+			status.ExitCode, status.Err = execute.ExitCode(err), err
+		})
+		if ctx.Err() != nil {
+			s.stop(p)
+			return
+		}
+		s.report(p, Event{Type: EventExited, ExitCode: execute.ExitCode(err), Err: err, Uptime: uptime})
+
+		if p.Restart == RestartNever || (p.Restart == RestartOnFailure && err == nil) {
+			s.update(p, func(status *Status) {
+				status.State = StateExited
+			})
+			return
+		}
+
+		now := time.Now()
+		restarts = append(restarts, now)
+		if p.Window > 0 {
+			for len(restarts) > 0 && now.Sub(restarts[0]) > p.Window {
+				restarts = restarts[1:]
+			}
+		}
+		if p.MaxRestarts > 0 && len(restarts) > p.MaxRestarts {
+			s.update(p, func(status *Status) {
+				status.State = StateCrashLoop
+			})
+			s.report(p, Event{Type: EventCrashLoop, ExitCode: execute.ExitCode(err), Err: err})
+			return
+		}
+
+		if uptime >= p.minUptime() {
+			crashes = 0
+		}
+		delay := p.backoff(crashes)
+		crashes++
+		s.update(p, func(status *Status) {
+			status.State = StateBackoff
+		})
+		s.report(p, Event{Type: EventRestarting, Backoff: delay})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			s.stop(p)
+			return
+		}
+		s.update(p, func(status *Status) {
+			status.Restarts++
+		})
+	}
+}
+
+// execute runs the process until it exits, forwarding its output.
+func (s *Supervisor) execute(ctx context.Context, p *process) error {
+	result, err := execute.Start(ctx, s.executor, p.Command)
+	if err != nil {
+		return err
+	}
+	return result.CopyOutput(p.Stdout, p.Stderr)
+}
+
+// stop records that the process was stopped by the shutdown of the supervisor.
+func (s *Supervisor) stop(p *process) {
+	s.update(p, func(status *Status) {
+		status.State = StateStopped
+	})
+	s.report(p, Event{Type: EventStopped})
+}
+
+// update modifies the status of the process.
+func (s *Supervisor) update(p *process, fn func(status *Status)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&p.status)
+}
+
+// report passes the event of the process to the handlers.
+func (s *Supervisor) report(p *process, event Event) {
+	if len(s.handlers) == 0 {
+		return
+	}
+	s.mu.Lock()
+	event.Process, event.Time, event.Restarts = p.Name, time.Now(), p.status.Restarts
+	s.mu.Unlock()
+	for _, handler := range s.handlers {
+		handler(event)
+	}
+}
+
+// backoff returns the delay before the restart following the number of consecutive crashes.
+func (p *process) backoff(crashes int) time.Duration {
+	delay, limit := p.InitialBackoff, p.MaxBackoff
+	if delay == 0 {
+		delay = defaultInitialBackoff
+	}
+	if limit == 0 {
+		limit = defaultMaxBackoff
+	}
+	for i := 0; i < crashes && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+// minUptime returns how long the process must run for its backoff to be reset.
+func (p *process) minUptime() time.Duration {
+	if p.MinUptime == 0 {
+		return defaultMinUptime
+	}
+	return p.MinUptime
+}
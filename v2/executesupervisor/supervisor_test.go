@@ -0,0 +1,122 @@
+package executesupervisor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+func TestBackoff(t *testing.T) {
+	p := &process{Process: Process{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for crashes, delay := range expected {
+		if backoff := p.backoff(crashes); backoff != delay {
+			t.Errorf("Expected backoff %s after %d crashes, but got %s", delay, crashes, backoff)
+		}
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+	executor := execute.NewExecutor(execute.WithShell("sh"))
+
+	t.Run("Supervisor_GivesUpOnCrashLoops", func(t *testing.T) {
+		var mu sync.Mutex
+		var events []EventType
+		s := New(executor, WithHandler(func(event Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, event.Type)
+		}))
+		if err := s.Add(Process{Name: "crashing", Command: "exit 1", InitialBackoff: 10 * time.Millisecond, MaxRestarts: 2, Window: time.Minute}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		err := s.Run(context.Background())
+		if !errors.Is(err, ErrCrashLoop) {
+			t.Errorf("Expected ErrCrashLoop, but got %v", err)
+		}
+		status := s.Status()[0]
+		if status.State != StateCrashLoop || status.Restarts != 2 || status.ExitCode != 1 {
+			t.Errorf("Expected the process to be given up on after 2 restarts, but got %+v", status)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		started := 0
+		for _, event := range events {
+			if event == EventStarted {
+				started++
+			}
+		}
+		if started != 3 || events[len(events)-1] != EventCrashLoop {
+			t.Errorf("Expected 3 starts followed by a crash loop, but got %v", events)
+		}
+	})
+
+	t.Run("Supervisor_AppliesRestartPolicies", func(t *testing.T) {
+		marker := filepath.Join(t.TempDir(), "marker")
+		s := New(executor)
+		s.Add(Process{Name: "flaky", Command: "test -f " + marker + " || { touch " + marker + "; exit 1; }", Restart: RestartOnFailure, InitialBackoff: 10 * time.Millisecond})
+		s.Add(Process{Name: "once", Command: "exit 2", Restart: RestartNever})
+
+		if err := s.Run(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		statuses := s.Status()
+		if flaky := statuses[0]; flaky.State != StateExited || flaky.Restarts != 1 || flaky.ExitCode != 0 {
+			t.Errorf("Expected flaky to exit successfully after 1 restart, but got %+v", flaky)
+		}
+		if once := statuses[1]; once.State != StateExited || once.Restarts != 0 || once.ExitCode != 2 {
+			t.Errorf("Expected once to exit with 2 without restarts, but got %+v", once)
+		}
+	})
+
+	t.Run("Supervisor_ForwardsOutput", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		s := New(executor)
+		s.Add(Process{Name: "output", Command: "echo out; echo err >&2", Restart: RestartNever, Stdout: &stdout, Stderr: &stderr})
+
+		if err := s.Run(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if stdout.String() != "out\n" || stderr.String() != "err\n" {
+			t.Errorf("Expected the output to be forwarded, but got %q and %q", stdout.String(), stderr.String())
+		}
+	})
+
+	t.Run("Supervisor_StopsProcessesOnCancellation", func(t *testing.T) {
+		s := New(executor)
+		s.Add(Process{Name: "daemon", Command: "exec sleep 5"})
+		s.Add(Process{Name: "restarting", Command: "exit 1", InitialBackoff: time.Minute})
+		if err := s.Add(Process{Name: "daemon", Command: "true"}); err == nil {
+			t.Errorf("Expected error for duplicate process, but got nil")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := s.Run(ctx); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("Expected the processes to be stopped, but Run took %s", elapsed)
+		}
+		for _, status := range s.Status() {
+			if status.State != StateStopped {
+				t.Errorf("Expected %s to be stopped, but got %s", status.Name, status.State)
+			}
+		}
+		if err := s.Run(context.Background()); !errors.Is(err, ErrSupervisorStarted) {
+			t.Errorf("Expected ErrSupervisorStarted, but got %v", err)
+		}
+	})
+}
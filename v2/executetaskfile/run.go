@@ -0,0 +1,109 @@
+package executetaskfile
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+	"github.com/bgrewell/go-execute/v2/executegraph"
+)
+
+// Graph returns the task graph of the file. Every task is executed by its own executor, created with the options
+// followed by the environment, working directory, user and shell of the task. The options configure everything the
+// file can't, such as sudo credentials, logging and middleware.
+func (f *File) Graph(options ...execute.Option) (*executegraph.Graph, error) {
+	g := executegraph.New()
+	for i := range f.Tasks {
+		task := &f.Tasks[i]
+
+		script := task.Script
+		if task.ScriptFile != "" {
+			data, err := os.ReadFile(f.resolve(task.ScriptFile))
+			if err != nil {
+				return nil, fmt.Errorf("task %s: failed to read script: %w", task.Name, err)
+			}
+			script = string(data)
+		}
+
+		timeout := task.Timeout
+		if timeout == 0 {
+			timeout = f.Timeout
+		}
+		err := g.Add(executegraph.Task{
+			Name:       task.Name,
+			Command:    task.Command,
+			Script:     script,
+			ScriptType: task.Type,
+			Arguments:  task.Args,
+			Parameters: task.Params,
+			DependsOn:  task.DependsOn,
+			Timeout:    time.Duration(timeout),
+			Retries:    task.Retries,
+			RetryDelay: time.Duration(task.RetryDelay),
+			Executor:   execute.NewExecutor(append(options[:len(options):len(options)], f.executorOptions(task)...)...),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// RunOptions returns the options of the file for running its graph.
+func (f *File) RunOptions() []executegraph.Option {
+	options := []executegraph.Option{executegraph.WithParallelism(f.Parallelism)}
+	if f.ContinueOnError {
+		options = append(options, executegraph.WithContinueOnError())
+	}
+	return options
+}
+
+// Run runs the tasks of the file with executors created with the options and returns the report of the run, see
+// Graph and executegraph.Graph.Run.
+func (f *File) Run(ctx context.Context, options ...execute.Option) (*executegraph.Report, error) {
+	g, err := f.Graph(options...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, task := range g.Tasks() {
+			task.Executor.Close()
+		}
+	}()
+	return g.Run(ctx, nil, f.RunOptions()...)
+}
+
+// executorOptions returns the options configuring the executor of the task.
+func (f *File) executorOptions(task *Task) []execute.Option {
+	var options []execute.Option
+	if env := f.environment(task); env != nil {
+		options = append(options, execute.WithEnvironment(env))
+	}
+	dir := task.Dir
+	if dir == "" {
+		dir = f.Dir
+	}
+	if dir != "" {
+		options = append(options, execute.WithWorkingDir(f.resolve(dir)))
+	}
+	user := task.User
+	if user == "" {
+		user = f.User
+	}
+	if user != "" {
+		options = append(options, execute.WithUser(user))
+	}
+	shell := task.Shell
+	if shell == "" {
+		shell = f.Shell
+	}
+	if shell != "" {
+		options = append(options, execute.WithShell(shell))
+	}
+	return options
+}
@@ -0,0 +1,285 @@
+// Package executetaskfile loads workflows of commands and scripts from YAML or JSON task files and runs them as a task
+// graph with an executor.
+//
+// A task file lists tasks with their dependencies, and every task runs with the environment, working directory, user,
+// shell and timeout of the task or the defaults of the file:
+//
+//	version: 1
+//	parallelism: 4
+//	env:
+//	  APP_ENV: production
+//	tasks:
+//	  - name: packages
+//	    command: apt-get install -y nginx
+//	    user: root
+//	    retries: 2
+//	    retry_delay: 10s
+//	  - name: config
+//	    script_file: scripts/configure.sh
+//	    type: bash
+//	    depends_on: [packages]
+//	    timeout: 5m
+//
+// Files are strictly validated: unknown fields, invalid values and problems with the dependencies are all reported
+// before anything is executed. Schema is a JSON Schema of the format for editors and other tools.
+package executetaskfile
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+	"github.com/bgrewell/go-execute/v2/executegraph"
+	"gopkg.in/yaml.v3"
+)
+
+// Version is the version of the task file format.
+const Version = 1
+
+// Schema is the JSON Schema of the task file format.
+//
+//go:embed schema.json
+var Schema []byte
+
+// File is a task file.
+type File struct {
+	// Version is the version of the format, which must be 1.
+	Version int `yaml:"version"`
+	// Env, Dir, User, Shell and Timeout are the defaults of the tasks.
+	Env     map[string]string `yaml:"env,omitempty"`
+	Dir     string            `yaml:"dir,omitempty"`
+	User    string            `yaml:"user,omitempty"`
+	Shell   string            `yaml:"shell,omitempty"`
+	Timeout Duration          `yaml:"timeout,omitempty"`
+	// Parallelism is the maximum number of tasks running at the same time, 0 means no limit.
+	Parallelism int `yaml:"parallelism,omitempty"`
+	// ContinueOnError keeps running the tasks that don't depend on a failed task instead of stopping the run.
+	ContinueOnError bool `yaml:"continue_on_error,omitempty"`
+	// Tasks are the tasks of the file.
+	Tasks []Task `yaml:"tasks"`
+
+	// base is the directory relative paths in the file are resolved against.
+	base string
+}
+
+// Task is a task of a task file.
+type Task struct {
+	// Name uniquely identifies the task within the file.
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	// Command is the command executed by the task. Exactly one of Command, Script and ScriptFile must be set.
+	Command string `yaml:"command,omitempty"`
+	// Script is the script executed by the task and ScriptFile the path of a file containing it, relative to the
+	// directory of the task file. Type is the script type.
+	Script     string             `yaml:"script,omitempty"`
+	ScriptFile string             `yaml:"script_file,omitempty"`
+	Type       execute.ScriptType `yaml:"type,omitempty"`
+	// Args and Params are the arguments and named parameters passed to the script.
+	Args   []string          `yaml:"args,omitempty"`
+	Params map[string]string `yaml:"params,omitempty"`
+	// Env is added to the environment of the file. Dir, User, Shell and Timeout override the defaults of the file.
+	Env     map[string]string `yaml:"env,omitempty"`
+	Dir     string            `yaml:"dir,omitempty"`
+	User    string            `yaml:"user,omitempty"`
+	Shell   string            `yaml:"shell,omitempty"`
+	Timeout Duration          `yaml:"timeout,omitempty"`
+	// Retries is the number of times the task is retried after it failed, waiting RetryDelay before every retry.
+	Retries    int      `yaml:"retries,omitempty"`
+	RetryDelay Duration `yaml:"retry_delay,omitempty"`
+	// DependsOn are the names of the tasks which must succeed before the task is started.
+	DependsOn []string `yaml:"depends_on,omitempty"`
+}
+
+// Duration is a time.Duration written as a string such as "1m30s".
+type Duration time.Duration
+
+// UnmarshalYAML parses the duration from a string.
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q, expected a value such as 30s or 5m", value.Line, s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalYAML returns the duration as a string.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+// Load reads and validates the task file at the path. Relative paths in the file are resolved against the directory
+// of the file.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read task file: %w", err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data, filepath.Dir(abs))
+}
+
+// Parse parses and validates a task file in YAML or JSON format. Relative paths in the file are resolved against the
+// working directory.
+func Parse(data []byte) (*File, error) {
+	return parse(data, "")
+}
+
+// parse parses and validates the task file with relative paths resolved against the base directory.
+func parse(data []byte, base string) (*File, error) {
+	f := &File{base: base}
+	if err := decode(data, f); err != nil {
+		return nil, fmt.Errorf("invalid task file: %w", err)
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// decode decodes the task file, rejecting unknown fields.
+func decode(data []byte, f *File) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(f); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("file is empty")
+		}
+		return err
+	}
+	return nil
+}
+
+// Validate returns an error describing every problem of the task file, or nil if it is valid.
+func (f *File) Validate() error {
+	var problems []error
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if f.Version != Version {
+		report("version: must be %d, got %d", Version, f.Version)
+	}
+	if f.Parallelism < 0 {
+		report("parallelism: must not be negative")
+	}
+	if f.Timeout < 0 {
+		report("timeout: must not be negative")
+	}
+	if len(f.Tasks) == 0 {
+		report("tasks: at least one task is required")
+	}
+
+	names := make(map[string]bool, len(f.Tasks))
+	for i, task := range f.Tasks {
+		prefix := fmt.Sprintf("tasks[%d]", i)
+		if task.Name == "" {
+			report("%s: name is required", prefix)
+		} else {
+			prefix = fmt.Sprintf("tasks[%d] (%s)", i, task.Name)
+			if names[task.Name] {
+				report("%s: duplicate task name", prefix)
+			}
+			names[task.Name] = true
+		}
+
+		bodies := 0
+		for _, body := range []string{task.Command, task.Script, task.ScriptFile} {
+			if body != "" {
+				bodies++
+			}
+		}
+		if bodies != 1 {
+			report("%s: exactly one of command, script and script_file is required", prefix)
+		}
+		if task.Command != "" {
+			if task.Type != "" || len(task.Args) > 0 || len(task.Params) > 0 {
+				report("%s: type, args and params are only allowed for scripts", prefix)
+			}
+		} else if task.Type == "" {
+			report("%s: type is required for scripts", prefix)
+		} else if _, ok := execute.LookupScriptType(task.Type); !ok {
+			report("%s: unknown script type %q, expected one of %v", prefix, task.Type, execute.ScriptTypes())
+		}
+		if task.ScriptFile != "" {
+			if _, err := os.Stat(f.resolve(task.ScriptFile)); err != nil {
+				report("%s: script_file: %v", prefix, err)
+			}
+		}
+		if task.Timeout < 0 || task.RetryDelay < 0 {
+			report("%s: timeout and retry_delay must not be negative", prefix)
+		}
+		if task.Retries < 0 {
+			report("%s: retries must not be negative", prefix)
+		}
+	}
+
+	for i, task := range f.Tasks {
+		for _, dependency := range task.DependsOn {
+			if !names[dependency] {
+				report("tasks[%d] (%s): depends on unknown task %q", i, task.Name, dependency)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid task file: %w", errors.Join(problems...))
+	}
+
+	// Cycles are only detected once all tasks and dependencies are known to be valid. The graph only needs the names
+	// and dependencies, so the name stands in for the command instead of reading script files and creating executors.
+	g := executegraph.New()
+	for _, task := range f.Tasks {
+		g.Add(executegraph.Task{Name: task.Name, Command: task.Name, DependsOn: task.DependsOn})
+	}
+	if err := g.Validate(); err != nil {
+		return fmt.Errorf("invalid task file: %w", err)
+	}
+	return nil
+}
+
+// resolve returns the path relative to the directory of the task file.
+func (f *File) resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) || f.base == "" {
+		return path
+	}
+	return filepath.Join(f.base, path)
+}
+
+// environment returns the environment of the task, or nil if neither the file nor the task set variables.
+func (f *File) environment(task *Task) []string {
+	if len(f.Env) == 0 && len(task.Env) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(f.Env)+len(task.Env))
+	for key, value := range f.Env {
+		merged[key] = value
+	}
+	for key, value := range task.Env {
+		merged[key] = value
+	}
+	keys := make([]string, 0, len(merged))
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	env := os.Environ()
+	for _, key := range keys {
+		env = append(env, key+"="+merged[key])
+	}
+	return env
+}
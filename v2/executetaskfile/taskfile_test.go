@@ -0,0 +1,209 @@
+package executetaskfile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2/executegraph"
+)
+
+func TestLoad(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "scripts", "work"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "scripts", "greet.sh"), []byte("echo \"$GREETING $1 from $(basename \"$PWD\")\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	taskfile := `
+version: 1
+shell: /bin/sh
+env:
+  GREETING: hello
+tasks:
+  - name: first
+    command: echo "$GREETING $TARGET"
+    env:
+      TARGET: world
+  - name: script
+    script_file: scripts/greet.sh
+    type: bash
+    args: [there]
+    dir: scripts/work
+    depends_on: [first]
+  - name: inline
+    script: exit 4
+    type: bash
+    retries: 1
+    retry_delay: 10ms
+    depends_on: [first]
+  - name: skipped
+    command: "true"
+    depends_on: [inline]
+`
+	path := filepath.Join(dir, "tasks.yml")
+	if err := os.WriteFile(path, []byte(taskfile), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if retryDelay := time.Duration(file.Tasks[2].RetryDelay); retryDelay != 10*time.Millisecond {
+		t.Errorf("Expected retry delay of 10ms, but got %s", retryDelay)
+	}
+
+	report, err := file.Run(context.Background())
+	if !errors.Is(err, executegraph.ErrTaskFailed) {
+		t.Errorf("Expected ErrTaskFailed, but got %v", err)
+	}
+	if first := report.Task("first"); first.Stdout != "hello world\n" {
+		t.Errorf("Expected output %q, but got %q (%v)", "hello world\n", first.Stdout, first.Err)
+	}
+	if script := report.Task("script"); script.Stdout != "hello there from work\n" {
+		t.Errorf("Expected output %q, but got %q (%v)", "hello there from work\n", script.Stdout, script.Err)
+	}
+	if inline := report.Task("inline"); inline.State != executegraph.TaskFailed || inline.ExitCode != 4 || inline.Attempts != 2 {
+		t.Errorf("Expected inline to fail with exit code 4 after 2 attempts, but got %+v", inline)
+	}
+	if skipped := report.Task("skipped"); skipped.State != executegraph.TaskSkipped {
+		t.Errorf("Expected skipped to be skipped, but got %s", skipped.State)
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Run("Parse_AcceptsJSON", func(t *testing.T) {
+		file, err := Parse([]byte(`{"version": 1, "timeout": "1m", "parallelism": 2, "tasks": [{"name": "a", "command": "true"}]}`))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if time.Duration(file.Timeout) != time.Minute || file.Parallelism != 2 || file.Tasks[0].Command != "true" {
+			t.Errorf("Unexpected file: %+v", file)
+		}
+	})
+
+	t.Run("Parse_RejectsUnknownFields", func(t *testing.T) {
+		_, err := Parse([]byte("version: 1\ntasks:\n  - name: a\n    comand: true\n"))
+		if err == nil || !strings.Contains(err.Error(), "comand") {
+			t.Errorf("Expected error for unknown field, but got %v", err)
+		}
+	})
+
+	t.Run("Parse_RejectsInvalidDurations", func(t *testing.T) {
+		_, err := Parse([]byte("version: 1\ntasks:\n  - name: a\n    command: \"true\"\n    timeout: 30\n"))
+		if err == nil || !strings.Contains(err.Error(), "invalid duration") {
+			t.Errorf("Expected error for invalid duration, but got %v", err)
+		}
+	})
+
+	t.Run("Parse_ReportsAllProblems", func(t *testing.T) {
+		_, err := Parse([]byte(`
+version: 2
+tasks:
+  - command: "true"
+  - name: both
+    command: "true"
+    script: "true"
+    type: bash
+  - name: unknown-type
+    script: "true"
+    type: cobol
+  - name: dangling
+    command: "true"
+    depends_on: [missing]
+`))
+		if err == nil {
+			t.Fatalf("Expected error, but got nil")
+		}
+		for _, problem := range []string{
+			"version: must be 1, got 2",
+			"tasks[0]: name is required",
+			"tasks[1] (both): exactly one of command, script and script_file is required",
+			`tasks[2] (unknown-type): unknown script type "cobol"`,
+			`tasks[3] (dangling): depends on unknown task "missing"`,
+		} {
+			if !strings.Contains(err.Error(), problem) {
+				t.Errorf("Expected error to contain %q, but got %v", problem, err)
+			}
+		}
+	})
+
+	t.Run("Parse_RejectsCycles", func(t *testing.T) {
+		_, err := Parse([]byte(`
+version: 1
+tasks:
+  - {name: a, command: "true", depends_on: [b]}
+  - {name: b, command: "true", depends_on: [a]}
+`))
+		if err == nil || !strings.Contains(err.Error(), "dependency cycle: a -> b -> a") {
+			t.Errorf("Expected error for cycle, but got %v", err)
+		}
+	})
+
+	t.Run("Parse_RejectsCyclesOfScriptTasks", func(t *testing.T) {
+		_, err := Parse([]byte(`
+version: 1
+tasks:
+  - {name: a, type: bash, script: "echo a", depends_on: [c]}
+  - {name: b, command: "true", depends_on: [a]}
+  - {name: c, type: python, script: "print(1)", depends_on: [b]}
+`))
+		if err == nil || !strings.Contains(err.Error(), "dependency cycle: a -> c -> b -> a") {
+			t.Errorf("Expected error for cycle, but got %v", err)
+		}
+	})
+}
+
+func TestSchema(t *testing.T) {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+		Defs       struct {
+			Task struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"task"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		t.Fatalf("Invalid schema: %v", err)
+	}
+
+	// The schema must describe exactly the fields of the types
+	tests := []struct {
+		name       string
+		typ        reflect.Type
+		properties map[string]json.RawMessage
+	}{
+		{"File", reflect.TypeOf(File{}), schema.Properties},
+		{"Task", reflect.TypeOf(Task{}), schema.Defs.Task.Properties},
+	}
+	for _, tt := range tests {
+		var fields, properties []string
+		for i := 0; i < tt.typ.NumField(); i++ {
+			if tag := tt.typ.Field(i).Tag.Get("yaml"); tag != "" {
+				fields = append(fields, strings.Split(tag, ",")[0])
+			}
+		}
+		for property := range tt.properties {
+			properties = append(properties, property)
+		}
+		sort.Strings(fields)
+		sort.Strings(properties)
+		if !reflect.DeepEqual(fields, properties) {
+			t.Errorf("%s: expected schema properties %v, but got %v", tt.name, fields, properties)
+		}
+	}
+}
@@ -0,0 +1,514 @@
+// Package executetest provides implementations of the execute.Executor interface for testing code that depends on it
+// without spawning real processes.
+//
+// Fake returns canned responses for commands matched by exact value, regular expression or a custom matcher, and
+// Recorder records the interactions with a real executor to a cassette file which can later be replayed
+// deterministically, for example in CI.
+package executetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+	"github.com/bgrewell/go-execute/v2/internal"
+)
+
+// ErrNoMatch is returned by the Fake when no rule matches a call.
+var ErrNoMatch = errors.New("executetest: no rule matches the call")
+
+// Method identifies the family of Executor methods a call was made through.
+type Method string
+
+const (
+	MethodExecute Method = "execute"
+	MethodAsync   Method = "async"
+	MethodScript  Method = "script"
+	MethodTTY     Method = "tty"
+)
+
+// Call describes a single call made to an executor.
+type Call struct {
+	// Method is the family of Executor methods the call was made through.
+	Method Method `json:"method"`
+	// Command is the command for Execute, Async and TTY calls, the script contents for scripts passed as strings and
+	// the script path for scripts passed as files.
+	Command string `json:"command"`
+	// ScriptType is the type of script for script calls.
+	ScriptType execute.ScriptType `json:"script_type,omitempty"`
+	// Arguments are the positional arguments passed to scripts.
+	Arguments []string `json:"arguments,omitempty"`
+	// Parameters are the named parameters passed to scripts formatted as strings.
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// Timeout is the timeout the call was made with, 0 if there was none.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// Response is the canned result of a call.
+type Response struct {
+	// Stdout is the output written to stdout.
+	Stdout string
+	// Stderr is the output written to stderr.
+	Stderr string
+	// ExitCode is the exit code of the command. A non-zero exit code results in an *ExitError.
+	ExitCode int
+	// Err is returned as the error of the call instead of the exit error when set.
+	Err error
+	// Delay is how long the command appears to run. When it exceeds the timeout of the call the call fails with
+	// context.DeadlineExceeded just like a real command would.
+	Delay time.Duration
+}
+
+// ExitError is returned for responses with a non-zero exit code. Like exec.ExitError it implements ExitCode.
+type ExitError struct {
+	Code int
+}
+
+// Error returns the error message in the same format as exec.ExitError.
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit code of the command.
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// err returns the error for the response.
+func (r Response) err() error {
+	if r.Err != nil {
+		return r.Err
+	}
+	if r.ExitCode != 0 {
+		return &ExitError{Code: r.ExitCode}
+	}
+	return nil
+}
+
+// Rule matches calls and returns a canned response for them.
+type Rule struct {
+	match    func(call Call) bool
+	response Response
+	times    int
+	used     int
+}
+
+// Return sets the output and exit code returned for matching calls.
+func (r *Rule) Return(stdout, stderr string, exitCode int) *Rule {
+	r.response.Stdout = stdout
+	r.response.Stderr = stderr
+	r.response.ExitCode = exitCode
+	return r
+}
+
+// ReturnError sets the error returned for matching calls.
+func (r *Rule) ReturnError(err error) *Rule {
+	r.response.Err = err
+	return r
+}
+
+// Respond sets the complete response returned for matching calls.
+func (r *Rule) Respond(response Response) *Rule {
+	r.response = response
+	return r
+}
+
+// Delay sets how long matching calls appear to run.
+func (r *Rule) Delay(d time.Duration) *Rule {
+	r.response.Delay = d
+	return r
+}
+
+// Times limits how often the rule matches. Once used up the following rules are considered. The default of 0 allows
+// the rule to match any number of times.
+func (r *Rule) Times(n int) *Rule {
+	r.times = n
+	return r
+}
+
+// Fake is a programmable execute.Executor. Calls are matched against the rules in the order they were added and the
+// response of the first matching rule is returned. Calls that don't match any rule fail with ErrNoMatch. Only the
+// settings of execute.Executor are stored; the Fake doesn't implement execute.ConfigurableExecutor, so dry-run mode,
+// middleware and the other settings of real executors don't apply to it.
+type Fake struct {
+	mu    sync.Mutex
+	rules []*Rule
+	calls []Call
+	settings
+}
+
+// NewFake returns a Fake without any rules.
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+// On adds a rule matching calls with exactly the given command.
+func (f *Fake) On(command string) *Rule {
+	return f.OnFunc(func(call Call) bool {
+		return call.Command == command
+	})
+}
+
+// OnRegex adds a rule matching calls with commands matching the regular expression. It panics if the expression
+// can't be compiled.
+func (f *Fake) OnRegex(pattern string) *Rule {
+	re := regexp.MustCompile(pattern)
+	return f.OnFunc(func(call Call) bool {
+		return re.MatchString(call.Command)
+	})
+}
+
+// OnFunc adds a rule matching calls for which the function returns true.
+func (f *Fake) OnFunc(match func(call Call) bool) *Rule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rule := &Rule{match: match}
+	f.rules = append(f.rules, rule)
+	return rule
+}
+
+// Calls returns all calls made to the fake in order.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Reset removes all rules and recorded calls.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = nil
+	f.calls = nil
+}
+
+// respond records the call and returns the response of the first matching rule.
+func (f *Fake) respond(call Call) (Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+	for _, rule := range f.rules {
+		if rule.times > 0 && rule.used >= rule.times {
+			continue
+		}
+		if rule.match(call) {
+			rule.used++
+			return rule.response, nil
+		}
+	}
+	return Response{}, fmt.Errorf("%w: %s %q", ErrNoMatch, call.Method, call.Command)
+}
+
+// run returns the output of a synchronous call.
+func (f *Fake) run(call Call) (stdout string, stderr string, err error) {
+	response, err := f.respond(call)
+	if err != nil {
+		return "", "", err
+	}
+	if call.Timeout > 0 && response.Delay > call.Timeout {
+		time.Sleep(call.Timeout)
+		return "", "", context.DeadlineExceeded
+	}
+	time.Sleep(response.Delay)
+	return response.Stdout, response.Stderr, response.err()
+}
+
+// runAsync returns the ExecutionResult of an asynchronous call which is cancelled when ctx is done.
+func (f *Fake) runAsync(ctx context.Context, call Call, stdin io.ReadCloser) (*execute.ExecutionResult, error) {
+	response, err := f.respond(call)
+	if err != nil {
+		return nil, err
+	}
+	if stdin != nil {
+		go func() {
+			io.Copy(io.Discard, stdin)
+			stdin.Close()
+		}()
+	}
+	return asyncResult(ctx, response, call.Timeout), nil
+}
+
+// asyncResult returns an ExecutionResult which produces the response once its delay has passed.
+func asyncResult(ctx context.Context, response Response, timeout time.Duration) *execute.ExecutionResult {
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	outReader, outWriter := io.Pipe()
+	errReader, errWriter := io.Pipe()
+	stdout := internal.NewExecReadWriter(outReader)
+	stderr := internal.NewExecReadWriter(errReader)
+
+	finished := make(chan error, 1)
+	go func() {
+		defer close(finished)
+		defer cancel()
+
+		timer := time.NewTimer(response.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			outWriter.Close()
+			errWriter.Close()
+			finished <- ctx.Err()
+			return
+		}
+
+		io.WriteString(outWriter, response.Stdout)
+		outWriter.Close()
+		io.WriteString(errWriter, response.Stderr)
+		errWriter.Close()
+		stdout.Wait()
+		stderr.Wait()
+		finished <- response.err()
+	}()
+
+	return &execute.ExecutionResult{
+		Stdout:   stdout,
+		Stderr:   stderr,
+		Finished: finished,
+		Ctx:      ctx,
+	}
+}
+
+// Execute returns the combined output of the matching response.
+func (f *Fake) Execute(command string) (combined string, err error) {
+	return f.ExecuteWithTimeout(command, 0)
+}
+
+// ExecuteSeparate returns the output of the matching response.
+func (f *Fake) ExecuteSeparate(command string) (stdout string, stderr string, err error) {
+	return f.ExecuteSeparateWithTimeout(command, 0)
+}
+
+// ExecuteAsync returns an ExecutionResult for the matching response.
+func (f *Fake) ExecuteAsync(command string) (*execute.ExecutionResult, error) {
+	return f.ExecuteAsyncWithTimeout(command, 0)
+}
+
+// ExecuteAsyncWithInput returns an ExecutionResult for the matching response. The input is discarded.
+func (f *Fake) ExecuteAsyncWithInput(command string, stdin io.ReadCloser) (*execute.ExecutionResult, error) {
+	return f.runAsync(context.Background(), Call{Method: MethodAsync, Command: command}, stdin)
+}
+
+// ExecuteWithTimeout returns the combined output of the matching response.
+func (f *Fake) ExecuteWithTimeout(command string, timeout time.Duration) (combined string, err error) {
+	stdout, stderr, err := f.ExecuteSeparateWithTimeout(command, timeout)
+	return stdout + stderr, err
+}
+
+// ExecuteSeparateWithTimeout returns the output of the matching response.
+func (f *Fake) ExecuteSeparateWithTimeout(command string, timeout time.Duration) (stdout string, stderr string, err error) {
+	return f.run(Call{Method: MethodExecute, Command: command, Timeout: timeout})
+}
+
+// ExecuteAsyncWithTimeout returns an ExecutionResult for the matching response.
+func (f *Fake) ExecuteAsyncWithTimeout(command string, timeout time.Duration) (*execute.ExecutionResult, error) {
+	return f.runAsync(context.Background(), Call{Method: MethodAsync, Command: command, Timeout: timeout}, nil)
+}
+
+// ExecuteAsyncWithContext returns an ExecutionResult for the matching response which is cancelled when the context
+// is done. The deadline of the context isn't part of the call since it depends on when the call was made.
+func (f *Fake) ExecuteAsyncWithContext(ctx context.Context, command string) (*execute.ExecutionResult, error) {
+	return f.runAsync(ctx, Call{Method: MethodAsync, Command: command}, nil)
+}
+
+// ExecuteScriptFromString returns the output of the response matching the script contents.
+func (f *Fake) ExecuteScriptFromString(scriptType execute.ScriptType, script string, arguments []string, parameters map[string]string) (stdout string, stderr string, err error) {
+	return f.ExecuteScriptFromStringWithTimeout(scriptType, script, arguments, parameters, 0)
+}
+
+// ExecuteScriptFromStringWithTimeout returns the output of the response matching the script contents.
+func (f *Fake) ExecuteScriptFromStringWithTimeout(scriptType execute.ScriptType, script string, arguments []string, parameters map[string]string, timeout time.Duration) (stdout string, stderr string, err error) {
+	return f.run(scriptCall(scriptType, script, arguments, parameters, timeout))
+}
+
+// ExecuteScriptFromFile returns the output of the response matching the script path.
+func (f *Fake) ExecuteScriptFromFile(scriptType execute.ScriptType, scriptPath string, arguments []string, parameters map[string]string) (stdout string, stderr string, err error) {
+	return f.ExecuteScriptFromFileWithTimeout(scriptType, scriptPath, arguments, parameters, 0)
+}
+
+// ExecuteScriptFromFileWithTimeout returns the output of the response matching the script path.
+func (f *Fake) ExecuteScriptFromFileWithTimeout(scriptType execute.ScriptType, scriptPath string, arguments []string, parameters map[string]string, timeout time.Duration) (stdout string, stderr string, err error) {
+	return f.run(scriptCall(scriptType, scriptPath, arguments, parameters, timeout))
+}
+
+// ExecuteScriptFromStringWithParameters returns the output of the response matching the script contents.
+func (f *Fake) ExecuteScriptFromStringWithParameters(scriptType execute.ScriptType, script string, arguments []string, parameters execute.ScriptParameters, timeout time.Duration) (stdout string, stderr string, err error) {
+	return f.run(scriptCall(scriptType, script, arguments, parameterStrings(parameters), timeout))
+}
+
+// ExecuteScriptFromFileWithParameters returns the output of the response matching the script path.
+func (f *Fake) ExecuteScriptFromFileWithParameters(scriptType execute.ScriptType, scriptPath string, arguments []string, parameters execute.ScriptParameters, timeout time.Duration) (stdout string, stderr string, err error) {
+	return f.run(scriptCall(scriptType, scriptPath, arguments, parameterStrings(parameters), timeout))
+}
+
+// ExecuteScriptFromFS returns the output of the response matching the script path.
+func (f *Fake) ExecuteScriptFromFS(fsys fs.FS, scriptPath string, scriptType execute.ScriptType, arguments []string, parameters map[string]string) (stdout string, stderr string, err error) {
+	return f.ExecuteScriptFromFSWithTimeout(fsys, scriptPath, scriptType, arguments, parameters, 0)
+}
+
+// ExecuteScriptFromFSWithTimeout returns the output of the response matching the script path.
+func (f *Fake) ExecuteScriptFromFSWithTimeout(fsys fs.FS, scriptPath string, scriptType execute.ScriptType, arguments []string, parameters map[string]string, timeout time.Duration) (stdout string, stderr string, err error) {
+	return f.run(scriptCall(scriptType, scriptPath, arguments, parameters, timeout))
+}
+
+// ExecuteTTY returns the error of the matching response. The output is discarded.
+func (f *Fake) ExecuteTTY(command string) error {
+	_, _, err := f.run(Call{Method: MethodTTY, Command: command})
+	return err
+}
+
+// ExecuteSpecAsync returns an ExecutionResult for the response matching the command of the spec, or its command line
+// when the command is empty. The input is discarded.
+func (f *Fake) ExecuteSpecAsync(ctx context.Context, spec *execute.CommandSpec) (*execute.ExecutionResult, error) {
+	var stdin io.ReadCloser
+	if spec.Stdin != nil {
+		stdin = io.NopCloser(spec.Stdin)
+	}
+	return f.runAsync(ctx, Call{Method: MethodAsync, Command: specCommand(spec), Timeout: spec.Timeout}, stdin)
+}
+
+// specCommand returns the command of the spec, or its command line when the command is empty.
+func specCommand(spec *execute.CommandSpec) string {
+	if spec.Command != "" {
+		return spec.Command
+	}
+	return spec.String()
+}
+
+// scriptCall returns the Call for a script.
+func scriptCall(scriptType execute.ScriptType, script string, arguments []string, parameters map[string]string, timeout time.Duration) Call {
+	return Call{
+		Method:     MethodScript,
+		Command:    script,
+		ScriptType: scriptType,
+		Arguments:  arguments,
+		Parameters: parameters,
+		Timeout:    timeout,
+	}
+}
+
+// parameterStrings returns the typed parameters formatted as strings.
+func parameterStrings(parameters execute.ScriptParameters) map[string]string {
+	if len(parameters) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(parameters))
+	for _, param := range parameters {
+		values[param.Name] = fmt.Sprint(param.Value)
+	}
+	return values
+}
+
+// settings stores the configuration set through the Executor interface.
+type settings struct {
+	mu           sync.Mutex
+	environment  []string
+	user         string
+	shell        string
+	workingDir   string
+	sudoPassword string
+}
+
+// SetEnvironment sets the environment.
+func (s *settings) SetEnvironment(env []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.environment = env
+}
+
+// Environment returns the environment.
+func (s *settings) Environment() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.environment
+}
+
+// SetUser sets the user.
+func (s *settings) SetUser(user string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user = user
+}
+
+// User returns the user.
+func (s *settings) User() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.user
+}
+
+// SetShell sets the shell.
+func (s *settings) SetShell(shell string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shell = shell
+}
+
+// ClearShell clears the shell.
+func (s *settings) ClearShell() {
+	s.SetShell("")
+}
+
+// Shell returns the shell.
+func (s *settings) Shell() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shell
+}
+
+// UsingShell returns whether a shell is set.
+func (s *settings) UsingShell() bool {
+	return s.Shell() != ""
+}
+
+// WorkingDir returns the working directory.
+func (s *settings) WorkingDir() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.workingDir
+}
+
+// SetWorkingDir sets the working directory.
+func (s *settings) SetWorkingDir(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workingDir = dir
+}
+
+// SetSudoCredentials sets the sudo password.
+func (s *settings) SetSudoCredentials(password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sudoPassword = password
+}
+
+// SudoCredentials returns the sudo password, which allows tests to assert that it was configured.
+func (s *settings) SudoCredentials() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sudoPassword
+}
+
+// Close clears the sudo password.
+func (s *settings) Close() {
+	s.SetSudoCredentials("")
+}
+
+// Ensure the Fake implements the Executor interface and the optional interfaces it supports.
+var (
+	_ execute.Executor            = (*Fake)(nil)
+	_ execute.ContextExecutor     = (*Fake)(nil)
+	_ execute.SpecExecutor        = (*Fake)(nil)
+	_ execute.TypedScriptExecutor = (*Fake)(nil)
+	_ execute.FSScriptExecutor    = (*Fake)(nil)
+)
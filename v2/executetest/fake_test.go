@@ -0,0 +1,137 @@
+package executetest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+func TestFakeExecute(t *testing.T) {
+	fake := NewFake()
+	fake.On("whoami").Return("root\n", "", 0)
+	fake.OnRegex(`^apt-get install`).Return("", "E: Could not get lock", 100)
+	fake.On("flaky").Return("first", "", 1).Times(1)
+	fake.On("flaky").Return("second", "", 0)
+
+	t.Run("Execute_WithExactMatch", func(t *testing.T) {
+		out, err := fake.Execute("whoami")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if out != "root\n" {
+			t.Errorf("Expected output 'root\\n', but got '%s'", out)
+		}
+	})
+
+	t.Run("ExecuteSeparate_WithRegexMatchAndExitCode", func(t *testing.T) {
+		stdout, stderr, err := fake.ExecuteSeparate("apt-get install -y curl")
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 100 {
+			t.Fatalf("Expected exit code 100, but got %v", err)
+		}
+		if stdout != "" || stderr != "E: Could not get lock" {
+			t.Errorf("Unexpected output: stdout '%s', stderr '%s'", stdout, stderr)
+		}
+	})
+
+	t.Run("Execute_WithTimesLimit", func(t *testing.T) {
+		first, err := fake.Execute("flaky")
+		if err == nil || first != "first" {
+			t.Errorf("Expected first response, but got '%s' (%v)", first, err)
+		}
+		second, err := fake.Execute("flaky")
+		if err != nil || second != "second" {
+			t.Errorf("Expected second response, but got '%s' (%v)", second, err)
+		}
+	})
+
+	t.Run("Execute_WithoutMatch", func(t *testing.T) {
+		if _, err := fake.Execute("unknown"); !errors.Is(err, ErrNoMatch) {
+			t.Errorf("Expected ErrNoMatch, but got %v", err)
+		}
+	})
+
+	t.Run("Calls_RecordsAllCalls", func(t *testing.T) {
+		calls := fake.Calls()
+		if len(calls) != 5 {
+			t.Fatalf("Expected 5 calls, but got %d", len(calls))
+		}
+		if calls[0].Method != MethodExecute || calls[0].Command != "whoami" {
+			t.Errorf("Unexpected first call: %+v", calls[0])
+		}
+	})
+}
+
+func TestFakeDelay(t *testing.T) {
+	fake := NewFake()
+	fake.On("sleep").Return("done", "", 0).Delay(50 * time.Millisecond)
+
+	t.Run("ExecuteWithTimeout_ExceedsTimeout", func(t *testing.T) {
+		_, err := fake.ExecuteWithTimeout("sleep", 10*time.Millisecond)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, but got %v", err)
+		}
+	})
+
+	t.Run("ExecuteAsync_ProducesOutputAfterDelay", func(t *testing.T) {
+		start := time.Now()
+		result, err := fake.ExecuteAsync("sleep")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		stdout, err := io.ReadAll(result.Stdout)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := <-result.Finished; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(stdout) != "done" {
+			t.Errorf("Expected stdout 'done', but got '%s'", stdout)
+		}
+		if time.Since(start) < 50*time.Millisecond {
+			t.Errorf("Expected the output to be delayed")
+		}
+	})
+}
+
+func TestFakeScripts(t *testing.T) {
+	fake := NewFake()
+	fake.OnFunc(func(call Call) bool {
+		return call.Method == MethodScript && call.Parameters["name"] == "World"
+	}).Return("Hello, World", "", 0)
+
+	stdout, _, err := fake.ExecuteScriptFromString("powershell", "Write-Output $name", nil, map[string]string{"name": "World"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stdout != "Hello, World" {
+		t.Errorf("Expected stdout 'Hello, World', but got '%s'", stdout)
+	}
+}
+
+func TestFakeSettings(t *testing.T) {
+	fake := NewFake()
+
+	t.Run("Settings_StoresExecutorSettings", func(t *testing.T) {
+		fake.SetEnvironment([]string{"A=1"})
+		fake.SetSudoCredentials("secret")
+		if env := fake.Environment(); len(env) != 1 || env[0] != "A=1" {
+			t.Errorf("Expected environment [A=1], but got %v", env)
+		}
+		if password := fake.SudoCredentials(); password != "secret" {
+			t.Errorf("Expected sudo password 'secret', but got '%s'", password)
+		}
+	})
+
+	t.Run("Settings_NotConfigurable", func(t *testing.T) {
+		var executor execute.Executor = fake
+		if _, ok := executor.(execute.ConfigurableExecutor); ok {
+			t.Errorf("Expected the fake not to implement execute.ConfigurableExecutor")
+		}
+	})
+}
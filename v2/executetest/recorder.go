@@ -0,0 +1,450 @@
+package executetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2"
+	"github.com/bgrewell/go-execute/v2/internal"
+)
+
+// Mode controls whether a Recorder records or replays interactions.
+type Mode int
+
+const (
+	// ModeReplay replays the interactions stored in the cassette without executing anything.
+	ModeReplay Mode = iota
+	// ModeRecord executes calls with the real executor and records them to the cassette.
+	ModeRecord
+	// ModeAuto replays the cassette when it exists and records a new one otherwise.
+	ModeAuto
+)
+
+// Interaction is a recorded call and the result it produced.
+type Interaction struct {
+	Call     Call   `json:"call"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+	// Error is the message of errors other than a non-zero exit code.
+	Error string `json:"error,omitempty"`
+	// TimedOut is set when the call exceeded its timeout.
+	TimedOut bool `json:"timed_out,omitempty"`
+}
+
+// response returns the Response which replays the interaction.
+func (i Interaction) response() Response {
+	response := Response{Stdout: i.Stdout, Stderr: i.Stderr, ExitCode: i.ExitCode}
+	switch {
+	case i.TimedOut:
+		response.Err = context.DeadlineExceeded
+	case i.Error != "":
+		response.Err = errors.New(i.Error)
+	}
+	return response
+}
+
+// Cassette is the list of recorded interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// LoadCassette reads a cassette from the file.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cassette := &Cassette{}
+	if err := json.Unmarshal(data, cassette); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	return cassette, nil
+}
+
+// Save writes the cassette to the file.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Recorder is an execute.Executor which records the calls made to a real executor to a cassette, or replays a
+// previously recorded cassette. When replaying, calls are matched exactly against the recorded calls and each recorded
+// interaction is used once in the order it was recorded, so repeated calls replay deterministically. Settings beyond
+// those of execute.Executor, such as the script directory, are configured on the real executor.
+type Recorder struct {
+	path     string
+	mode     Mode
+	executor execute.Executor
+	mu       sync.Mutex
+	cassette *Cassette
+}
+
+// NewRecorder returns a Recorder for the cassette at path. The real executor is only used when recording and may be
+// nil in ModeReplay.
+func NewRecorder(path string, mode Mode, real execute.Executor) (*Recorder, error) {
+	if mode == ModeAuto {
+		mode = ModeRecord
+		if _, err := os.Stat(path); err == nil {
+			mode = ModeReplay
+		}
+	}
+
+	r := &Recorder{path: path, mode: mode, cassette: &Cassette{}}
+	switch mode {
+	case ModeRecord:
+		if real == nil {
+			return nil, errors.New("executetest: recording requires a real executor")
+		}
+		r.executor = real
+	case ModeReplay:
+		cassette, err := LoadCassette(path)
+		if err != nil {
+			return nil, err
+		}
+		fake := NewFake()
+		for _, interaction := range cassette.Interactions {
+			call := interaction.Call
+			fake.OnFunc(func(c Call) bool {
+				return reflect.DeepEqual(normalizeCall(c), normalizeCall(call))
+			}).Respond(interaction.response()).Times(1)
+		}
+		r.cassette = cassette
+		r.executor = fake
+	default:
+		return nil, fmt.Errorf("executetest: unknown mode %d", mode)
+	}
+	return r, nil
+}
+
+// Mode returns whether the recorder is recording or replaying.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Interactions returns the interactions recorded so far, or the replayed interactions in ModeReplay.
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Interaction(nil), r.cassette.Interactions...)
+}
+
+// Stop saves the cassette when recording. It does nothing when replaying.
+func (r *Recorder) Stop() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cassette.Save(r.path)
+}
+
+// record adds an interaction to the cassette when recording.
+func (r *Recorder) record(call Call, stdout, stderr string, err error) {
+	if r.mode != ModeRecord {
+		return
+	}
+	interaction := Interaction{Call: call, Stdout: stdout, Stderr: stderr}
+	var exitErr interface{ ExitCode() int }
+	switch {
+	case err == nil:
+	case errors.Is(err, context.DeadlineExceeded):
+		interaction.TimedOut = true
+	case errors.As(err, &exitErr) && exitErr.ExitCode() > 0:
+		interaction.ExitCode = exitErr.ExitCode()
+	default:
+		interaction.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+}
+
+// separate runs a synchronous call and records it.
+func (r *Recorder) separate(call Call, fn func() (string, string, error)) (stdout string, stderr string, err error) {
+	stdout, stderr, err = fn()
+	r.record(call, stdout, stderr, err)
+	return stdout, stderr, err
+}
+
+// async runs an asynchronous call. When recording, the output is passed through to the caller while being captured
+// and the interaction is recorded once the command has finished.
+func (r *Recorder) async(call Call, fn func() (*execute.ExecutionResult, error)) (*execute.ExecutionResult, error) {
+	result, err := fn()
+	if r.mode != ModeRecord {
+		return result, err
+	}
+	if err != nil {
+		r.record(call, "", "", err)
+		return nil, err
+	}
+
+	var outBuf, errBuf bytes.Buffer
+	outReader, outWriter := io.Pipe()
+	errReader, errWriter := io.Pipe()
+	stdout := internal.NewExecReadWriter(outReader)
+	stderr := internal.NewExecReadWriter(errReader)
+
+	finished := make(chan error, 1)
+	go func() {
+		defer close(finished)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			io.Copy(io.MultiWriter(outWriter, &outBuf), result.Stdout)
+			outWriter.Close()
+		}()
+		go func() {
+			defer wg.Done()
+			io.Copy(io.MultiWriter(errWriter, &errBuf), result.Stderr)
+			errWriter.Close()
+		}()
+		wg.Wait()
+
+		err := <-result.Finished
+		r.record(call, outBuf.String(), errBuf.String(), err)
+		finished <- err
+	}()
+
+	return &execute.ExecutionResult{
+		Stdout:   stdout,
+		Stderr:   stderr,
+		Finished: finished,
+		Ctx:      result.Ctx,
+	}, nil
+}
+
+// Execute records or replays the call.
+func (r *Recorder) Execute(command string) (combined string, err error) {
+	return r.ExecuteWithTimeout(command, 0)
+}
+
+// ExecuteSeparate records or replays the call.
+func (r *Recorder) ExecuteSeparate(command string) (stdout string, stderr string, err error) {
+	return r.ExecuteSeparateWithTimeout(command, 0)
+}
+
+// ExecuteAsync records or replays the call.
+func (r *Recorder) ExecuteAsync(command string) (*execute.ExecutionResult, error) {
+	return r.ExecuteAsyncWithTimeout(command, 0)
+}
+
+// ExecuteAsyncWithInput records or replays the call. The input itself is not recorded.
+func (r *Recorder) ExecuteAsyncWithInput(command string, stdin io.ReadCloser) (*execute.ExecutionResult, error) {
+	return r.async(Call{Method: MethodAsync, Command: command}, func() (*execute.ExecutionResult, error) {
+		return r.executor.ExecuteAsyncWithInput(command, stdin)
+	})
+}
+
+// ExecuteWithTimeout records or replays the call.
+func (r *Recorder) ExecuteWithTimeout(command string, timeout time.Duration) (combined string, err error) {
+	stdout, stderr, err := r.ExecuteSeparateWithTimeout(command, timeout)
+	return stdout + stderr, err
+}
+
+// ExecuteSeparateWithTimeout records or replays the call.
+func (r *Recorder) ExecuteSeparateWithTimeout(command string, timeout time.Duration) (stdout string, stderr string, err error) {
+	return r.separate(Call{Method: MethodExecute, Command: command, Timeout: timeout}, func() (string, string, error) {
+		return r.executor.ExecuteSeparateWithTimeout(command, timeout)
+	})
+}
+
+// ExecuteAsyncWithTimeout records or replays the call.
+func (r *Recorder) ExecuteAsyncWithTimeout(command string, timeout time.Duration) (*execute.ExecutionResult, error) {
+	return r.async(Call{Method: MethodAsync, Command: command, Timeout: timeout}, func() (*execute.ExecutionResult, error) {
+		return r.executor.ExecuteAsyncWithTimeout(command, timeout)
+	})
+}
+
+// ExecuteAsyncWithContext records or replays the call. The timeout isn't recorded since it depends on when the call
+// was made. Recording requires the real executor to implement execute.ContextExecutor.
+func (r *Recorder) ExecuteAsyncWithContext(ctx context.Context, command string) (*execute.ExecutionResult, error) {
+	return r.async(Call{Method: MethodAsync, Command: command}, func() (*execute.ExecutionResult, error) {
+		contexts, ok := r.executor.(execute.ContextExecutor)
+		if !ok {
+			return nil, fmt.Errorf("executetest: %T does not implement execute.ContextExecutor", r.executor)
+		}
+		return contexts.ExecuteAsyncWithContext(ctx, command)
+	})
+}
+
+// ExecuteScriptFromString records or replays the call.
+func (r *Recorder) ExecuteScriptFromString(scriptType execute.ScriptType, script string, arguments []string, parameters map[string]string) (stdout string, stderr string, err error) {
+	return r.ExecuteScriptFromStringWithTimeout(scriptType, script, arguments, parameters, 0)
+}
+
+// ExecuteScriptFromStringWithTimeout records or replays the call.
+func (r *Recorder) ExecuteScriptFromStringWithTimeout(scriptType execute.ScriptType, script string, arguments []string, parameters map[string]string, timeout time.Duration) (stdout string, stderr string, err error) {
+	return r.separate(scriptCall(scriptType, script, arguments, parameters, timeout), func() (string, string, error) {
+		return r.executor.ExecuteScriptFromStringWithTimeout(scriptType, script, arguments, parameters, timeout)
+	})
+}
+
+// ExecuteScriptFromFile records or replays the call.
+func (r *Recorder) ExecuteScriptFromFile(scriptType execute.ScriptType, scriptPath string, arguments []string, parameters map[string]string) (stdout string, stderr string, err error) {
+	return r.ExecuteScriptFromFileWithTimeout(scriptType, scriptPath, arguments, parameters, 0)
+}
+
+// ExecuteScriptFromFileWithTimeout records or replays the call.
+func (r *Recorder) ExecuteScriptFromFileWithTimeout(scriptType execute.ScriptType, scriptPath string, arguments []string, parameters map[string]string, timeout time.Duration) (stdout string, stderr string, err error) {
+	return r.separate(scriptCall(scriptType, scriptPath, arguments, parameters, timeout), func() (string, string, error) {
+		return r.executor.ExecuteScriptFromFileWithTimeout(scriptType, scriptPath, arguments, parameters, timeout)
+	})
+}
+
+// ExecuteScriptFromStringWithParameters records or replays the call. Recording requires the real executor to implement
+// execute.TypedScriptExecutor.
+func (r *Recorder) ExecuteScriptFromStringWithParameters(scriptType execute.ScriptType, script string, arguments []string, parameters execute.ScriptParameters, timeout time.Duration) (stdout string, stderr string, err error) {
+	return r.separate(scriptCall(scriptType, script, arguments, parameterStrings(parameters), timeout), func() (string, string, error) {
+		scripts, ok := r.executor.(execute.TypedScriptExecutor)
+		if !ok {
+			return "", "", fmt.Errorf("executetest: %T does not implement execute.TypedScriptExecutor", r.executor)
+		}
+		return scripts.ExecuteScriptFromStringWithParameters(scriptType, script, arguments, parameters, timeout)
+	})
+}
+
+// ExecuteScriptFromFileWithParameters records or replays the call. Recording requires the real executor to implement
+// execute.TypedScriptExecutor.
+func (r *Recorder) ExecuteScriptFromFileWithParameters(scriptType execute.ScriptType, scriptPath string, arguments []string, parameters execute.ScriptParameters, timeout time.Duration) (stdout string, stderr string, err error) {
+	return r.separate(scriptCall(scriptType, scriptPath, arguments, parameterStrings(parameters), timeout), func() (string, string, error) {
+		scripts, ok := r.executor.(execute.TypedScriptExecutor)
+		if !ok {
+			return "", "", fmt.Errorf("executetest: %T does not implement execute.TypedScriptExecutor", r.executor)
+		}
+		return scripts.ExecuteScriptFromFileWithParameters(scriptType, scriptPath, arguments, parameters, timeout)
+	})
+}
+
+// ExecuteScriptFromFS records or replays the call.
+func (r *Recorder) ExecuteScriptFromFS(fsys fs.FS, scriptPath string, scriptType execute.ScriptType, arguments []string, parameters map[string]string) (stdout string, stderr string, err error) {
+	return r.ExecuteScriptFromFSWithTimeout(fsys, scriptPath, scriptType, arguments, parameters, 0)
+}
+
+// ExecuteScriptFromFSWithTimeout records or replays the call. Recording requires the real executor to implement
+// execute.FSScriptExecutor.
+func (r *Recorder) ExecuteScriptFromFSWithTimeout(fsys fs.FS, scriptPath string, scriptType execute.ScriptType, arguments []string, parameters map[string]string, timeout time.Duration) (stdout string, stderr string, err error) {
+	return r.separate(scriptCall(scriptType, scriptPath, arguments, parameters, timeout), func() (string, string, error) {
+		scripts, ok := r.executor.(execute.FSScriptExecutor)
+		if !ok {
+			return "", "", fmt.Errorf("executetest: %T does not implement execute.FSScriptExecutor", r.executor)
+		}
+		return scripts.ExecuteScriptFromFSWithTimeout(fsys, scriptPath, scriptType, arguments, parameters, timeout)
+	})
+}
+
+// ExecuteTTY records or replays the call. Only the error is recorded as the output is written to the terminal.
+func (r *Recorder) ExecuteTTY(command string) error {
+	_, _, err := r.separate(Call{Method: MethodTTY, Command: command}, func() (string, string, error) {
+		return "", "", r.executor.ExecuteTTY(command)
+	})
+	return err
+}
+
+// ExecuteSpecAsync records or replays the call. The input itself is not recorded. Recording requires the real executor
+// to implement execute.SpecExecutor.
+func (r *Recorder) ExecuteSpecAsync(ctx context.Context, spec *execute.CommandSpec) (*execute.ExecutionResult, error) {
+	call := Call{Method: MethodAsync, Command: specCommand(spec), Timeout: spec.Timeout}
+	return r.async(call, func() (*execute.ExecutionResult, error) {
+		specs, ok := r.executor.(execute.SpecExecutor)
+		if !ok {
+			return nil, fmt.Errorf("executetest: %T does not implement execute.SpecExecutor", r.executor)
+		}
+		return specs.ExecuteSpecAsync(ctx, spec)
+	})
+}
+
+// SetEnvironment sets the environment of the underlying executor.
+func (r *Recorder) SetEnvironment(env []string) {
+	r.executor.SetEnvironment(env)
+}
+
+// Environment returns the environment of the underlying executor.
+func (r *Recorder) Environment() []string {
+	return r.executor.Environment()
+}
+
+// SetUser sets the user of the underlying executor.
+func (r *Recorder) SetUser(user string) {
+	r.executor.SetUser(user)
+}
+
+// User returns the user of the underlying executor.
+func (r *Recorder) User() string {
+	return r.executor.User()
+}
+
+// SetShell sets the shell of the underlying executor.
+func (r *Recorder) SetShell(shell string) {
+	r.executor.SetShell(shell)
+}
+
+// ClearShell clears the shell of the underlying executor.
+func (r *Recorder) ClearShell() {
+	r.executor.ClearShell()
+}
+
+// Shell returns the shell of the underlying executor.
+func (r *Recorder) Shell() string {
+	return r.executor.Shell()
+}
+
+// UsingShell returns whether the underlying executor uses a shell.
+func (r *Recorder) UsingShell() bool {
+	return r.executor.UsingShell()
+}
+
+// WorkingDir returns the working directory of the underlying executor.
+func (r *Recorder) WorkingDir() string {
+	return r.executor.WorkingDir()
+}
+
+// SetWorkingDir sets the working directory of the underlying executor.
+func (r *Recorder) SetWorkingDir(dir string) {
+	r.executor.SetWorkingDir(dir)
+}
+
+// SetSudoCredentials sets the sudo password of the underlying executor. It is never recorded.
+func (r *Recorder) SetSudoCredentials(password string) {
+	r.executor.SetSudoCredentials(password)
+}
+
+// Close closes the underlying executor.
+func (r *Recorder) Close() {
+	r.executor.Close()
+}
+
+// normalizeCall returns the call with empty collections replaced by nil so calls compare equal after a round trip
+// through JSON.
+func normalizeCall(call Call) Call {
+	if len(call.Arguments) == 0 {
+		call.Arguments = nil
+	}
+	if len(call.Parameters) == 0 {
+		call.Parameters = nil
+	}
+	return call
+}
+
+// Ensure the Recorder implements the Executor interface and the optional interfaces it supports.
+var (
+	_ execute.Executor            = (*Recorder)(nil)
+	_ execute.ContextExecutor     = (*Recorder)(nil)
+	_ execute.SpecExecutor        = (*Recorder)(nil)
+	_ execute.TypedScriptExecutor = (*Recorder)(nil)
+	_ execute.FSScriptExecutor    = (*Recorder)(nil)
+)
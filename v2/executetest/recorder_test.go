@@ -0,0 +1,81 @@
+package executetest
+
+import (
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/bgrewell/go-execute/v2"
+)
+
+func TestRecorderRecordAndReplay(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+
+	recorder, err := NewRecorder(cassette, ModeAuto, execute.NewExecutor(execute.WithDefaultShell()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if recorder.Mode() != ModeRecord {
+		t.Fatalf("Expected recorder to record when the cassette doesn't exist")
+	}
+	recorded, err := recorder.Execute("echo recorded")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = recorder.Execute("exit 3")
+	if err == nil {
+		t.Fatalf("Expected error, but got nil")
+	}
+	result, err := recorder.ExecuteAsync("echo async")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	asyncOut, _ := io.ReadAll(result.Stdout)
+	if err := <-result.Finished; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := recorder.Stop(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	replayer, err := NewRecorder(cassette, ModeAuto, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if replayer.Mode() != ModeReplay {
+		t.Fatalf("Expected recorder to replay when the cassette exists")
+	}
+
+	replayed, err := replayer.Execute("echo recorded")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if replayed != recorded || strings.TrimSpace(replayed) != "recorded" {
+		t.Errorf("Expected replayed output '%s', but got '%s'", recorded, replayed)
+	}
+
+	_, err = replayer.Execute("exit 3")
+	exitErr, ok := err.(*ExitError)
+	if !ok || exitErr.ExitCode() != 3 {
+		t.Errorf("Expected exit code 3, but got %v", err)
+	}
+
+	result, err = replayer.ExecuteAsync("echo async")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	replayedAsync, _ := io.ReadAll(result.Stdout)
+	if string(replayedAsync) != string(asyncOut) {
+		t.Errorf("Expected replayed async output '%s', but got '%s'", asyncOut, replayedAsync)
+	}
+
+	// Every interaction is only replayed once
+	if _, err := replayer.Execute("echo recorded"); err == nil {
+		t.Errorf("Expected error when the interaction has been used up, but got nil")
+	}
+}
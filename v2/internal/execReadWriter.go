@@ -57,7 +57,7 @@ func (rwc *ExecReadWriter) Write(p []byte) (n int, err error) {
 
 	n, err = rwc.buffer.Write(p)
 	if rwc.readPending {
-		rwc.cond.Signal()
+		rwc.cond.Broadcast()
 	}
 
 	return n, err
@@ -93,8 +93,9 @@ func (rwc *ExecReadWriter) readFromReader() {
 		if n > 0 {
 			rwc.mu.Lock()
 			rwc.buffer.Write(buf[:n])
+			// The condition is shared with Wait, so every waiter is woken to make sure the pending reader is among them
 			if rwc.readPending {
-				rwc.cond.Signal()
+				rwc.cond.Broadcast()
 			}
 			rwc.mu.Unlock()
 		}
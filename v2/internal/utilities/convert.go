@@ -0,0 +1,19 @@
+package utilities
+
+import (
+	"bytes"
+	"encoding/base64"
+	"unicode/utf16"
+)
+
+// ConvertToUTF16LEBase64String encodes the command as base64 encoded UTF-16LE which is the format expected by the
+// -EncodedCommand parameter of PowerShell.
+func ConvertToUTF16LEBase64String(command string) string {
+	utf16Command := utf16.Encode([]rune(command))
+	buffer := new(bytes.Buffer)
+	for _, code := range utf16Command {
+		buffer.WriteByte(byte(code))
+		buffer.WriteByte(byte(code >> 8))
+	}
+	return base64.StdEncoding.EncodeToString(buffer.Bytes())
+}
@@ -0,0 +1,12 @@
+package utilities
+
+import "testing"
+
+func TestConvertToUTF16LEBase64String(t *testing.T) {
+	// Generated with: [Convert]::ToBase64String([Text.Encoding]::Unicode.GetBytes('Write-Output "hi"'))
+	expected := "VwByAGkAdABlAC0ATwB1AHQAcAB1AHQAIAAiAGgAaQAiAA=="
+	result := ConvertToUTF16LEBase64String(`Write-Output "hi"`)
+	if result != expected {
+		t.Fatalf("Unexpected result: %v", result)
+	}
+}
@@ -0,0 +1,512 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultJobRetention is how long finished jobs are kept by default.
+	defaultJobRetention = time.Hour
+	// defaultJobOutputLimit is the default number of bytes of output buffered per job.
+	defaultJobOutputLimit = 1 << 20
+	// subscriberBuffer is the number of output chunks buffered per subscriber.
+	subscriberBuffer = 256
+)
+
+var (
+	// ErrJobNotFound is returned for unknown jobs, including jobs that have already been garbage collected.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobManagerClosed is returned when submitting jobs to a closed JobManager.
+	ErrJobManagerClosed = errors.New("job manager is closed")
+)
+
+// JobState is the state of a job.
+type JobState string
+
+const (
+	JobPending   JobState = "pending"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// Finished returns whether the state is final.
+func (s JobState) Finished() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCancelled
+}
+
+// JobOutput is a chunk of output written by a job.
+type JobOutput struct {
+	// Stream is the stream the output was written to, "stdout" or "stderr".
+	Stream string `json:"stream"`
+	// Data is the output.
+	Data []byte `json:"data"`
+	// Time is the time the output was read.
+	Time time.Time `json:"time"`
+}
+
+// JobStatus is a snapshot of the state of a job.
+type JobStatus struct {
+	ID          string    `json:"id"`
+	Command     string    `json:"command"`
+	State       JobState  `json:"state"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	StartedAt   time.Time `json:"started_at,omitempty"`
+	FinishedAt  time.Time `json:"finished_at,omitempty"`
+	// ExitCode is the exit code of the command once it has finished, or -1 if it didn't exit normally.
+	ExitCode int `json:"exit_code"`
+	// Error is the error the job failed with.
+	Error string `json:"error,omitempty"`
+	// OutputTruncated is set when older output was discarded to stay within the output limit.
+	OutputTruncated bool `json:"output_truncated,omitempty"`
+}
+
+// Job is an asynchronous execution managed by a JobManager. It is safe for concurrent use.
+type Job struct {
+	seq     uint64
+	id      string
+	command string
+	timeout time.Duration
+	limit   int
+	done    chan struct{}
+
+	mu          sync.Mutex
+	state       JobState
+	submittedAt time.Time
+	startedAt   time.Time
+	finishedAt  time.Time
+	exitCode    int
+	err         error
+	output      []JobOutput
+	outputSize  int
+	truncated   bool
+	subscribers map[chan JobOutput]struct{}
+	cancel      context.CancelFunc
+	cancelled   bool
+}
+
+// ID returns the id of the job.
+func (j *Job) ID() string {
+	return j.id
+}
+
+// Command returns the command executed by the job.
+func (j *Job) Command() string {
+	return j.command
+}
+
+// State returns the current state of the job.
+func (j *Job) State() JobState {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state
+}
+
+// Status returns a snapshot of the state of the job.
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := JobStatus{
+		ID:              j.id,
+		Command:         j.command,
+		State:           j.state,
+		SubmittedAt:     j.submittedAt,
+		StartedAt:       j.startedAt,
+		FinishedAt:      j.finishedAt,
+		ExitCode:        j.exitCode,
+		OutputTruncated: j.truncated,
+	}
+	if j.err != nil {
+		status.Error = j.err.Error()
+	}
+	return status
+}
+
+// Err returns the error the job failed with, or nil while it is running or when it succeeded.
+func (j *Job) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// Output returns the buffered output of the job.
+func (j *Job) Output() []JobOutput {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]JobOutput(nil), j.output...)
+}
+
+// Done returns a channel which is closed once the job has finished.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// setState changes the state of an unfinished job.
+func (j *Job) setState(state JobState) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.state = state
+	if state == JobRunning {
+		j.startedAt = time.Now()
+	}
+}
+
+// append buffers the output and passes it on to the subscribers. Subscribers that don't keep up miss output.
+func (j *Job) append(stream string, data []byte) {
+	chunk := JobOutput{Stream: stream, Data: append([]byte(nil), data...), Time: time.Now()}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.output = append(j.output, chunk)
+	j.outputSize += len(chunk.Data)
+	for j.outputSize > j.limit && len(j.output) > 0 {
+		j.truncated = true
+		excess := j.outputSize - j.limit
+		if excess >= len(j.output[0].Data) {
+			j.outputSize -= len(j.output[0].Data)
+			j.output = j.output[1:]
+			continue
+		}
+		j.output[0].Data = j.output[0].Data[excess:]
+		j.outputSize -= excess
+	}
+
+	for subscriber := range j.subscribers {
+		select {
+		case subscriber <- chunk:
+		default:
+		}
+	}
+}
+
+// finish records the outcome of the job and notifies the subscribers and waiters.
+func (j *Job) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.finishedAt = time.Now()
+	j.exitCode = ExitCode(err)
+	j.err = err
+	switch {
+	case j.cancelled:
+		j.state = JobCancelled
+	case err != nil:
+		j.state = JobFailed
+	default:
+		j.state = JobSucceeded
+	}
+	for subscriber := range j.subscribers {
+		close(subscriber)
+	}
+	j.subscribers = nil
+	if j.cancel != nil {
+		j.cancel()
+	}
+	close(j.done)
+}
+
+// JobOption configures a JobManager.
+type JobOption func(*JobManager)
+
+func WithJobRetention(retention time.Duration) JobOption {
+	return func(m *JobManager) {
+		m.retention = retention
+	}
+}
+
+func WithJobOutputLimit(bytes int) JobOption {
+	return func(m *JobManager) {
+		m.outputLimit = bytes
+	}
+}
+
+func WithJobConcurrency(n int) JobOption {
+	return func(m *JobManager) {
+		m.concurrency = n
+	}
+}
+
+// JobManager runs commands asynchronously as jobs identified by an id, keeps track of their state and buffers their
+// recent output. Jobs wait in the pending state while the concurrency limit is reached. Finished jobs are garbage
+// collected once the retention period has passed.
+type JobManager struct {
+	executor    Executor
+	retention   time.Duration
+	outputLimit int
+	concurrency int
+	slots       chan struct{}
+	ctx         context.Context
+	stop        context.CancelFunc
+	wg          sync.WaitGroup
+
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	nextID uint64
+	closed bool
+}
+
+// NewJobManager returns a JobManager running its jobs with the executor. By default finished jobs are kept for an
+// hour, the last MiB of output is buffered per job and the number of concurrent jobs is unlimited. A retention of 0
+// keeps finished jobs forever.
+func NewJobManager(executor Executor, options ...JobOption) *JobManager {
+	m := &JobManager{
+		executor:    executor,
+		retention:   defaultJobRetention,
+		outputLimit: defaultJobOutputLimit,
+		jobs:        map[string]*Job{},
+	}
+	for _, option := range options {
+		option(m)
+	}
+	if m.concurrency > 0 {
+		m.slots = make(chan struct{}, m.concurrency)
+	}
+	m.ctx, m.stop = context.WithCancel(context.Background())
+
+	if m.retention > 0 {
+		m.wg.Add(1)
+		go m.collect()
+	}
+	return m
+}
+
+// Submit starts the command as a new job.
+func (m *JobManager) Submit(command string) (*Job, error) {
+	return m.SubmitWithTimeout(command, 0)
+}
+
+// SubmitWithTimeout starts the command as a new job which is killed once the timeout expires. The timeout starts
+// once the job leaves the pending state.
+func (m *JobManager) SubmitWithTimeout(command string, timeout time.Duration) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrJobManagerClosed
+	}
+
+	m.nextID++
+	job := &Job{
+		seq:         m.nextID,
+		id:          fmt.Sprintf("job-%d", m.nextID),
+		command:     command,
+		timeout:     timeout,
+		limit:       m.outputLimit,
+		done:        make(chan struct{}),
+		state:       JobPending,
+		submittedAt: time.Now(),
+		subscribers: map[chan JobOutput]struct{}{},
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	job.cancel = cancel
+	m.jobs[job.id] = job
+
+	m.wg.Add(1)
+	go m.run(ctx, job)
+	return job, nil
+}
+
+// Get returns the job with the id.
+func (m *JobManager) Get(id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return job, nil
+}
+
+// List returns all jobs in the order they were submitted.
+func (m *JobManager) List() []*Job {
+	m.mu.Lock()
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].seq < jobs[j].seq
+	})
+	return jobs
+}
+
+// Cancel cancels the job. Pending jobs are never started and running jobs are killed. Cancelling a finished job has
+// no effect.
+func (m *JobManager) Cancel(id string) error {
+	job, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if !job.state.Finished() {
+		job.cancelled = true
+		job.cancel()
+	}
+	return nil
+}
+
+// Wait waits until the job has finished or the context is done.
+func (m *JobManager) Wait(ctx context.Context, id string) (*Job, error) {
+	job, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-job.done:
+		return job, nil
+	case <-ctx.Done():
+		return job, ctx.Err()
+	}
+}
+
+// Subscribe returns a channel receiving the output of the job, starting with the buffered output. The channel is
+// closed once the job has finished or the returned function is called to unsubscribe. Subscribers that don't keep up
+// with the output miss the chunks that don't fit into the buffer of the channel.
+func (m *JobManager) Subscribe(id string) (<-chan JobOutput, func(), error) {
+	job, err := m.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	ch := make(chan JobOutput, len(job.output)+subscriberBuffer)
+	for _, chunk := range job.output {
+		ch <- chunk
+	}
+	if job.state.Finished() {
+		close(ch)
+		return ch, func() {}, nil
+	}
+	job.subscribers[ch] = struct{}{}
+
+	unsubscribe := func() {
+		job.mu.Lock()
+		defer job.mu.Unlock()
+		if _, ok := job.subscribers[ch]; ok {
+			delete(job.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe, nil
+}
+
+// Close cancels all unfinished jobs, waits for them to finish and stops the garbage collection. Jobs can't be
+// submitted to a closed JobManager, but the finished jobs can still be inspected.
+func (m *JobManager) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	for _, job := range m.jobs {
+		job.mu.Lock()
+		if !job.state.Finished() {
+			job.cancelled = true
+		}
+		job.mu.Unlock()
+	}
+	m.mu.Unlock()
+
+	m.stop()
+	m.wg.Wait()
+}
+
+// run runs the job once a slot is available.
+func (m *JobManager) run(ctx context.Context, job *Job) {
+	defer m.wg.Done()
+
+	if m.slots != nil {
+		select {
+		case m.slots <- struct{}{}:
+			defer func() { <-m.slots }()
+		case <-ctx.Done():
+			job.finish(ctx.Err())
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		job.finish(ctx.Err())
+		return
+	}
+
+	job.setState(JobRunning)
+	if job.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.timeout)
+		defer cancel()
+	}
+
+	result, err := Start(ctx, m.executor, job.command)
+	if err != nil {
+		job.finish(err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go m.read(&wg, job, "stdout", result.Stdout)
+	go m.read(&wg, job, "stderr", result.Stderr)
+	wg.Wait()
+	job.finish(<-result.Finished)
+}
+
+// read buffers the output of the job until the stream is closed.
+func (m *JobManager) read(wg *sync.WaitGroup, job *Job, stream string, r io.Reader) {
+	defer wg.Done()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			job.append(stream, buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// collect periodically removes finished jobs older than the retention period.
+func (m *JobManager) collect() {
+	defer m.wg.Done()
+	interval := m.retention / 2
+	if interval < time.Second {
+		interval = time.Second
+	} else if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.removeExpired(now)
+		}
+	}
+}
+
+// removeExpired removes the jobs which finished before the retention period.
+func (m *JobManager) removeExpired(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, job := range m.jobs {
+		job.mu.Lock()
+		expired := job.state.Finished() && now.Sub(job.finishedAt) > m.retention
+		job.mu.Unlock()
+		if expired {
+			delete(m.jobs, id)
+		}
+	}
+}
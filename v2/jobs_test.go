@@ -0,0 +1,159 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestJobManager(t *testing.T, options ...JobOption) *JobManager {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on Windows")
+	}
+	m := NewJobManager(NewExecutor(WithShell("/bin/sh")), options...)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func waitJob(t *testing.T, m *JobManager, id string) *Job {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	job, err := m.Wait(ctx, id)
+	if err != nil {
+		t.Fatalf("Failed waiting for %s: %v", id, err)
+	}
+	return job
+}
+
+func TestJobManagerStates(t *testing.T) {
+	m := newTestJobManager(t)
+
+	ok, _ := m.Submit("echo hello")
+	failed, _ := m.Submit("echo oops >&2; exit 3")
+	if waitJob(t, m, ok.ID()).State() != JobSucceeded {
+		t.Errorf("Expected %s to succeed, got %+v", ok.ID(), ok.Status())
+	}
+	status := waitJob(t, m, failed.ID()).Status()
+	if status.State != JobFailed || status.ExitCode != 3 || status.Error == "" {
+		t.Errorf("Expected %s to fail with exit code 3, got %+v", failed.ID(), status)
+	}
+
+	output := ok.Output()
+	if len(output) != 1 || output[0].Stream != "stdout" || string(output[0].Data) != "hello\n" {
+		t.Errorf("Unexpected output %+v", output)
+	}
+
+	jobs := m.List()
+	if len(jobs) != 2 || jobs[0] != ok || jobs[1] != failed {
+		t.Errorf("Expected the jobs in submission order, got %v", jobs)
+	}
+	if _, err := m.Get("job-unknown"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestJobManagerCancel(t *testing.T) {
+	m := newTestJobManager(t, WithJobConcurrency(1))
+
+	running, _ := m.Submit("exec sleep 10")
+	time.Sleep(50 * time.Millisecond)
+	pending, _ := m.Submit("echo never")
+	time.Sleep(100 * time.Millisecond)
+	if running.State() != JobRunning || pending.State() != JobPending {
+		t.Fatalf("Expected running and pending jobs, got %s and %s", running.State(), pending.State())
+	}
+
+	if err := m.Cancel(pending.ID()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := m.Cancel(running.ID()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state := waitJob(t, m, running.ID()).State(); state != JobCancelled {
+		t.Errorf("Expected the running job to be cancelled, got %s", state)
+	}
+	if state := waitJob(t, m, pending.ID()).State(); state != JobCancelled || len(pending.Output()) != 0 {
+		t.Errorf("Expected the pending job to be cancelled without running, got %s", state)
+	}
+}
+
+func TestJobManagerTimeout(t *testing.T) {
+	m := newTestJobManager(t)
+
+	job, _ := m.SubmitWithTimeout("exec sleep 10", 100*time.Millisecond)
+	if state := waitJob(t, m, job.ID()).State(); state != JobFailed {
+		t.Errorf("Expected the job to fail, got %s", state)
+	}
+}
+
+func TestJobManagerSubscribe(t *testing.T) {
+	m := newTestJobManager(t)
+
+	job, _ := m.Submit("echo one; sleep 0.2; echo two >&2")
+	time.Sleep(100 * time.Millisecond)
+	output, _, err := m.Subscribe(job.ID())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var received []string
+	for chunk := range output {
+		received = append(received, chunk.Stream+":"+string(chunk.Data))
+	}
+	if strings.Join(received, ",") != "stdout:one\n,stderr:two\n" {
+		t.Errorf("Unexpected output %q", received)
+	}
+
+	// Subscribing to a finished job replays its output
+	output, _, _ = m.Subscribe(job.ID())
+	if n := len(output); n != 2 {
+		t.Errorf("Expected the buffered output to be replayed, got %d chunks", n)
+	}
+}
+
+func TestJobManagerOutputLimit(t *testing.T) {
+	m := newTestJobManager(t, WithJobOutputLimit(4))
+
+	job, _ := m.Submit("printf 0123456789")
+	waitJob(t, m, job.ID())
+	var data []byte
+	for _, chunk := range job.Output() {
+		data = append(data, chunk.Data...)
+	}
+	if string(data) != "6789" || !job.Status().OutputTruncated {
+		t.Errorf("Expected the last 4 bytes of output, got %q", data)
+	}
+}
+
+func TestJobManagerRetention(t *testing.T) {
+	m := newTestJobManager(t, WithJobRetention(time.Minute))
+
+	job, _ := m.Submit("true")
+	waitJob(t, m, job.ID())
+	m.removeExpired(time.Now())
+	if _, err := m.Get(job.ID()); err != nil {
+		t.Errorf("Expected the job to be retained, got %v", err)
+	}
+	m.removeExpired(time.Now().Add(2 * time.Minute))
+	if _, err := m.Get(job.ID()); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected the job to be collected, got %v", err)
+	}
+}
+
+func TestJobManagerClose(t *testing.T) {
+	m := newTestJobManager(t)
+
+	job, _ := m.Submit("exec sleep 10")
+	time.Sleep(50 * time.Millisecond)
+	m.Close()
+	if state := job.State(); state != JobCancelled {
+		t.Errorf("Expected the job to be cancelled, got %s", state)
+	}
+	if _, err := m.Submit("true"); !errors.Is(err, ErrJobManagerClosed) {
+		t.Errorf("Expected ErrJobManagerClosed, got %v", err)
+	}
+}
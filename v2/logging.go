@@ -1,7 +1,12 @@
 package execute
 
+import (
+	"path/filepath"
+	"sync/atomic"
+)
+
 var (
-	logger Logger = &NoOpLogger{}
+	globalLogger atomic.Value
 )
 
 // Logger provides the logging interface for integrating your logging with the go-execute module
@@ -14,8 +19,117 @@ type Logger interface {
 	Fatal(msg string, fields ...interface{})
 }
 
+// loggerHolder wraps the global logger since an atomic.Value requires all stored values to have the same type.
+type loggerHolder struct {
+	logger Logger
+}
+
+// SetLogger sets the logger used by all executors that don't have their own logger. It is safe to call while
+// executors are running. A nil logger disables logging.
 func SetLogger(custom Logger) {
-	logger = custom
+	if custom == nil {
+		custom = &NoOpLogger{}
+	}
+	globalLogger.Store(loggerHolder{logger: custom})
+}
+
+// GetLogger returns the logger used by all executors that don't have their own logger.
+func GetLogger() Logger {
+	if holder, ok := globalLogger.Load().(loggerHolder); ok {
+		return holder.logger
+	}
+	return &NoOpLogger{}
+}
+
+// SetLogger sets the logger of the executor, which takes precedence over the global logger. A nil logger makes the
+// executor use the global logger again.
+func (e *BaseExecutor) SetLogger(logger Logger) {
+	e.logger = logger
+}
+
+// Logger returns the logger of the executor, or the global logger if the executor doesn't have its own logger.
+func (e *BaseExecutor) Logger() Logger {
+	return e.log()
+}
+
+// log returns the logger used by the executor.
+func (e *BaseExecutor) log() Logger {
+	if e.logger != nil {
+		return e.logger
+	}
+	return GetLogger()
+}
+
+// NewFieldLogger returns a Logger which adds the fields to every message logged with the base logger, e.g. to tag all
+// messages of an executor with a component or job id.
+func NewFieldLogger(base Logger, fields ...interface{}) Logger {
+	return &fieldLogger{base: base, fields: fields}
+}
+
+// fieldLogger is a Logger adding fields to every message.
+type fieldLogger struct {
+	base   Logger
+	fields []interface{}
+}
+
+func (l *fieldLogger) with(fields []interface{}) []interface{} {
+	return append(append(make([]interface{}, 0, len(l.fields)+len(fields)), l.fields...), fields...)
+}
+
+func (l *fieldLogger) Trace(msg string, fields ...interface{}) { l.base.Trace(msg, l.with(fields)...) }
+func (l *fieldLogger) Debug(msg string, fields ...interface{}) { l.base.Debug(msg, l.with(fields)...) }
+func (l *fieldLogger) Info(msg string, fields ...interface{})  { l.base.Info(msg, l.with(fields)...) }
+func (l *fieldLogger) Warn(msg string, fields ...interface{})  { l.base.Warn(msg, l.with(fields)...) }
+func (l *fieldLogger) Error(msg string, fields ...interface{}) { l.base.Error(msg, l.with(fields)...) }
+func (l *fieldLogger) Fatal(msg string, fields ...interface{}) { l.base.Fatal(msg, l.with(fields)...) }
+
+// LogLevel selects the level at which messages are logged.
+type LogLevel int
+
+const (
+	LogLevelOff LogLevel = iota
+	LogLevelTrace
+	LogLevelDebug
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+// logAt logs the message at the level. Nothing is logged for LogLevelOff.
+func logAt(logger Logger, level LogLevel, msg string, fields ...interface{}) {
+	switch level {
+	case LogLevelTrace:
+		logger.Trace(msg, fields...)
+	case LogLevelDebug:
+		logger.Debug(msg, fields...)
+	case LogLevelInfo:
+		logger.Info(msg, fields...)
+	case LogLevelWarn:
+		logger.Warn(msg, fields...)
+	case LogLevelError:
+		logger.Error(msg, fields...)
+	}
+}
+
+// SetOutputLogging sets the levels at which the lines the processes write to stdout and stderr are logged. The output
+// is still returned to the caller as usual. LogLevelOff, the default, disables logging of the output.
+func (e *BaseExecutor) SetOutputLogging(stdout LogLevel, stderr LogLevel) {
+	e.stdoutLogLevel = stdout
+	e.stderrLogLevel = stderr
+}
+
+// OutputLogging returns the levels at which the output of processes is logged.
+func (e *BaseExecutor) OutputLogging() (stdout LogLevel, stderr LogLevel) {
+	return e.stdoutLogLevel, e.stderrLogLevel
+}
+
+// outputLogger returns a function logging the lines of a stream of the process at the level.
+func (e *BaseExecutor) outputLogger(spec *CommandSpec, stream string, level LogLevel) func(line string) {
+	logger := e.log()
+	binary := filepath.Base(spec.Path)
+	return func(line string) {
+		logAt(logger, level, "process output", "binary", binary, "stream", stream, "line", line)
+	}
 }
 
 // NoOpLogger is the default logging implementation which doesn't do anything with any of the logging messages
@@ -0,0 +1,104 @@
+package execute
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// memoryLogger is a Logger collecting the messages in memory.
+type memoryLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *memoryLogger) log(level, msg string, fields ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprint(level, " ", msg, " ", fields))
+}
+
+func (l *memoryLogger) Trace(msg string, fields ...interface{}) { l.log("trace", msg, fields...) }
+func (l *memoryLogger) Debug(msg string, fields ...interface{}) { l.log("debug", msg, fields...) }
+func (l *memoryLogger) Info(msg string, fields ...interface{})  { l.log("info", msg, fields...) }
+func (l *memoryLogger) Warn(msg string, fields ...interface{})  { l.log("warn", msg, fields...) }
+func (l *memoryLogger) Error(msg string, fields ...interface{}) { l.log("error", msg, fields...) }
+func (l *memoryLogger) Fatal(msg string, fields ...interface{}) { l.log("fatal", msg, fields...) }
+
+func (l *memoryLogger) contains(message string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, m := range l.messages {
+		if m == message {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLogger(t *testing.T) {
+	t.Run("Logger_DefaultsToGlobalLogger", func(t *testing.T) {
+		global := &memoryLogger{}
+		SetLogger(global)
+		defer SetLogger(nil)
+
+		executor := &BaseExecutor{}
+		if executor.Logger() != global {
+			t.Errorf("Expected the global logger to be used")
+		}
+		own := &memoryLogger{}
+		executor.SetLogger(own)
+		if executor.Logger() != own {
+			t.Errorf("Expected the executor logger to be used")
+		}
+	})
+
+	t.Run("SetLogger_WithNil", func(t *testing.T) {
+		SetLogger(nil)
+		if _, ok := GetLogger().(*NoOpLogger); !ok {
+			t.Errorf("Expected the NoOpLogger, but got %T", GetLogger())
+		}
+	})
+
+	t.Run("NewFieldLogger_AddsFields", func(t *testing.T) {
+		base := &memoryLogger{}
+		logger := NewFieldLogger(base, "component", "test")
+		logger.Info("hello", "key", "value")
+
+		if !base.contains("info hello [component test key value]") {
+			t.Errorf("Expected the fields to be added, but got %v", base.messages)
+		}
+	})
+}
+
+func TestOutputLogging(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+
+	logger := &memoryLogger{}
+	executor := NewExecutor(
+		WithShell("sh"),
+		WithLogger(logger),
+		WithOutputLogging(LogLevelInfo, LogLevelWarn),
+	)
+
+	stdout, err := executor.Execute("printf 'one\\ntwo\\r\\nthree'; echo oops >&2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stdout != "one\ntwo\r\nthreeoops\n" {
+		t.Errorf("Expected the output to still be returned, but got %q", stdout)
+	}
+	for _, expected := range []string{
+		"info process output [binary sh stream stdout line one]",
+		"info process output [binary sh stream stdout line two]",
+		"info process output [binary sh stream stdout line three]",
+		"warn process output [binary sh stream stderr line oops]",
+	} {
+		if !logger.contains(expected) {
+			t.Errorf("Expected message %q, but got %v", expected, logger.messages)
+		}
+	}
+}
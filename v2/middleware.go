@@ -0,0 +1,62 @@
+package execute
+
+// RunFunc executes the command described by the spec and returns the ExecutionResult used to interact with the
+// running process.
+type RunFunc func(spec *CommandSpec) (*ExecutionResult, error)
+
+// Middleware wraps the execution of every command of an executor, including asynchronous, script and TTY executions.
+// A middleware may modify the spec before calling next, replace the returned ExecutionResult, call next more than once
+// or not at all. The outcome of the execution can be observed by registering a function with spec.OnExit.
+//
+//	func logging(next execute.RunFunc) execute.RunFunc {
+//		return func(spec *execute.CommandSpec) (*execute.ExecutionResult, error) {
+//			spec.OnExit(func(result *execute.Result) {
+//				log.Printf("%s exited with %d", spec, result.ExitCode)
+//			})
+//			return next(spec)
+//		}
+//	}
+type Middleware func(next RunFunc) RunFunc
+
+// Hooks are called at the stages of the lifecycle of every command of an executor. All hooks are optional.
+type Hooks struct {
+	// BeforeStart is called with the resolved spec before the command is started. It may modify the spec, and
+	// returning an error prevents the command from being started.
+	BeforeStart func(spec *CommandSpec) error
+	// AfterStart is called once the command has been started.
+	AfterStart func(spec *CommandSpec, result *ExecutionResult)
+	// OnExit is called once the command has finished or failed to start, before the Finished channel of the
+	// ExecutionResult is signaled.
+	OnExit func(spec *CommandSpec, result *Result)
+}
+
+// AddMiddleware appends middleware to the chain of the executor. The first middleware added is the outermost one.
+func (e *BaseExecutor) AddMiddleware(middleware ...Middleware) {
+	e.middleware = append(e.middleware, middleware...)
+}
+
+// AddHooks adds lifecycle hooks to the executor. Hooks are called in the order they were added.
+func (e *BaseExecutor) AddHooks(hooks Hooks) {
+	e.hooks = append(e.hooks, hooks)
+}
+
+// beforeStart calls the BeforeStart hooks and stops at the first error.
+func (e *BaseExecutor) beforeStart(spec *CommandSpec) error {
+	for _, hooks := range e.hooks {
+		if hooks.BeforeStart != nil {
+			if err := hooks.BeforeStart(spec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// afterStart calls the AfterStart hooks.
+func (e *BaseExecutor) afterStart(spec *CommandSpec, result *ExecutionResult) {
+	for _, hooks := range e.hooks {
+		if hooks.AfterStart != nil {
+			hooks.AfterStart(spec, result)
+		}
+	}
+}
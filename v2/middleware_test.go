@@ -0,0 +1,158 @@
+package execute
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+
+	t.Run("Middleware_CalledInOrder", func(t *testing.T) {
+		var mu sync.Mutex
+		var calls []string
+		record := func(name string) Middleware {
+			return func(next RunFunc) RunFunc {
+				return func(spec *CommandSpec) (*ExecutionResult, error) {
+					mu.Lock()
+					calls = append(calls, name)
+					mu.Unlock()
+					spec.OnExit(func(result *Result) {
+						mu.Lock()
+						calls = append(calls, name+"-exit")
+						mu.Unlock()
+					})
+					return next(spec)
+				}
+			}
+		}
+		executor := NewExecutor(WithMiddleware(record("outer"), record("inner")))
+
+		if _, err := executor.Execute("true"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		expected := "outer,inner,inner-exit,outer-exit"
+		if strings.Join(calls, ",") != expected {
+			t.Errorf("Expected calls %s, but got %v", expected, calls)
+		}
+	})
+
+	t.Run("Middleware_RewritesCommand", func(t *testing.T) {
+		echo, err := exec.LookPath("echo")
+		if err != nil {
+			t.Skip("skipping test: echo not available")
+		}
+		rewrite := func(next RunFunc) RunFunc {
+			return func(spec *CommandSpec) (*ExecutionResult, error) {
+				spec.Path = echo
+				spec.Args = append([]string{"rewritten"}, spec.Args...)
+				return next(spec)
+			}
+		}
+		executor := NewExecutor(WithMiddleware(rewrite))
+
+		stdout, err := executor.Execute("printf original")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if stdout != "rewritten original\n" {
+			t.Errorf("Expected 'rewritten original\\n', but got '%s'", stdout)
+		}
+	})
+
+	t.Run("Middleware_AppliesToScripts", func(t *testing.T) {
+		if _, err := exec.LookPath("bash"); err != nil {
+			t.Skip("skipping test: bash not available")
+		}
+		var scriptType ScriptType
+		capture := func(next RunFunc) RunFunc {
+			return func(spec *CommandSpec) (*ExecutionResult, error) {
+				scriptType = spec.ScriptType
+				return next(spec)
+			}
+		}
+		executor := NewExecutor(WithMiddleware(capture))
+
+		if _, _, err := executor.ExecuteScriptFromString(ScriptTypeBash, "echo hello", nil, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if scriptType != ScriptTypeBash {
+			t.Errorf("Expected the middleware to see the bash script, but got %q", scriptType)
+		}
+	})
+}
+
+func TestHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+
+	t.Run("Hooks_CalledInLifecycleOrder", func(t *testing.T) {
+		var mu sync.Mutex
+		var calls []string
+		var exitResult *Result
+		add := func(name string) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, name)
+		}
+		executor := NewExecutor(WithHooks(Hooks{
+			BeforeStart: func(spec *CommandSpec) error { add("before"); return nil },
+			AfterStart:  func(spec *CommandSpec, result *ExecutionResult) { add("after") },
+			OnExit: func(spec *CommandSpec, result *Result) {
+				add("exit")
+				exitResult = result
+			},
+		}))
+
+		result, err := executor.ExecuteAsync("echo hello")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		<-result.Finished
+
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.Join(calls, ",") != "before,after,exit" {
+			t.Errorf("Expected calls before,after,exit, but got %v", calls)
+		}
+		if exitResult == nil || exitResult.ExitCode != 0 || exitResult.StdoutBytes != 6 {
+			t.Errorf("Unexpected exit result: %+v", exitResult)
+		}
+	})
+
+	t.Run("Hooks_BeforeStartPreventsExecution", func(t *testing.T) {
+		denied := errors.New("denied by policy")
+		marker := filepath.Join(t.TempDir(), "marker")
+		var exitErr error
+		executor := NewExecutor(WithHooks(Hooks{
+			BeforeStart: func(spec *CommandSpec) error {
+				if filepath.Base(spec.Path) == "touch" {
+					return denied
+				}
+				return nil
+			},
+			OnExit: func(spec *CommandSpec, result *Result) { exitErr = result.Err },
+		}))
+
+		if _, err := executor.Execute("touch " + marker); !errors.Is(err, denied) {
+			t.Fatalf("Expected error %v, but got %v", denied, err)
+		}
+		if !errors.Is(exitErr, denied) {
+			t.Errorf("Expected OnExit to receive the policy error, but got %v", exitErr)
+		}
+		if _, err := os.Stat(marker); !os.IsNotExist(err) {
+			t.Errorf("Expected the command to not be executed")
+		}
+	})
+}
@@ -1,9 +1,22 @@
 package execute
 
-import "runtime"
+import (
+	"runtime"
+	"time"
+)
 
 type Option func(executor Executor)
 
+// configure returns an option which applies fn to executors implementing ConfigurableExecutor and is ignored by other
+// executors.
+func configure(fn func(e ConfigurableExecutor)) Option {
+	return func(e Executor) {
+		if c, ok := e.(ConfigurableExecutor); ok {
+			fn(c)
+		}
+	}
+}
+
 func WithEnvironment(env []string) Option {
 	return func(e Executor) {
 		e.SetEnvironment(env)
@@ -43,3 +56,81 @@ func WithSudoCredentials(password string) Option {
 		e.SetSudoCredentials(password)
 	}
 }
+
+func WithScriptDir(dir string) Option {
+	return configure(func(e ConfigurableExecutor) {
+		e.SetScriptDir(dir)
+	})
+}
+
+func WithInMemoryScripts() Option {
+	return configure(func(e ConfigurableExecutor) {
+		e.SetInMemoryScripts(true)
+	})
+}
+
+func WithGracePeriod(period time.Duration) Option {
+	return configure(func(e ConfigurableExecutor) {
+		e.SetGracePeriod(period)
+	})
+}
+
+func WithRetry(policy RetryPolicy) Option {
+	return configure(func(e ConfigurableExecutor) {
+		e.SetRetryPolicy(&policy)
+	})
+}
+
+func WithDryRun() Option {
+	return configure(func(e ConfigurableExecutor) {
+		e.SetDryRun(true)
+	})
+}
+
+func WithDryRunResult(result DryRunResult) Option {
+	return configure(func(e ConfigurableExecutor) {
+		e.SetDryRunResult(result)
+	})
+}
+
+func WithAuditSink(sink AuditSink) Option {
+	return configure(func(e ConfigurableExecutor) {
+		e.SetAuditSink(sink)
+	})
+}
+
+func WithSensitiveEnv(names ...string) Option {
+	return configure(func(e ConfigurableExecutor) {
+		e.SetSensitiveEnv(names)
+	})
+}
+
+func WithMiddleware(middleware ...Middleware) Option {
+	return configure(func(e ConfigurableExecutor) {
+		e.AddMiddleware(middleware...)
+	})
+}
+
+func WithHooks(hooks Hooks) Option {
+	return configure(func(e ConfigurableExecutor) {
+		e.AddHooks(hooks)
+	})
+}
+
+func WithLogger(logger Logger) Option {
+	return configure(func(e ConfigurableExecutor) {
+		e.SetLogger(logger)
+	})
+}
+
+func WithOutputLogging(stdout LogLevel, stderr LogLevel) Option {
+	return configure(func(e ConfigurableExecutor) {
+		e.SetOutputLogging(stdout, stderr)
+	})
+}
+
+func WithTransport(transport Transport) Option {
+	return configure(func(e ConfigurableExecutor) {
+		e.SetTransport(transport)
+	})
+}
@@ -0,0 +1,64 @@
+package pkg
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+const (
+	// LevelTrace is the slog level used for trace messages, below slog.LevelDebug.
+	LevelTrace = slog.LevelDebug - 4
+	// LevelFatal is the slog level used for fatal messages, above slog.LevelError.
+	LevelFatal = slog.LevelError + 4
+)
+
+// NewSlogLogger returns a logger writing to the slog logger. A nil logger uses slog.Default().
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogLogger{slogLogger: logger}
+}
+
+// SlogLogger adapts a *slog.Logger to the Logger interface of the execute package. Fields are passed to slog as
+// alternating keys and values.
+type SlogLogger struct {
+	slogLogger *slog.Logger
+}
+
+// With returns a child logger which adds the fields to every message.
+func (l *SlogLogger) With(fields ...interface{}) *SlogLogger {
+	return &SlogLogger{slogLogger: l.slogLogger.With(fields...)}
+}
+
+// Slog returns the underlying slog logger.
+func (l *SlogLogger) Slog() *slog.Logger {
+	return l.slogLogger
+}
+
+func (l *SlogLogger) Trace(msg string, fields ...interface{}) {
+	l.slogLogger.Log(context.Background(), LevelTrace, msg, fields...)
+}
+
+func (l *SlogLogger) Debug(msg string, fields ...interface{}) {
+	l.slogLogger.Debug(msg, fields...)
+}
+
+func (l *SlogLogger) Info(msg string, fields ...interface{}) {
+	l.slogLogger.Info(msg, fields...)
+}
+
+func (l *SlogLogger) Warn(msg string, fields ...interface{}) {
+	l.slogLogger.Warn(msg, fields...)
+}
+
+func (l *SlogLogger) Error(msg string, fields ...interface{}) {
+	l.slogLogger.Error(msg, fields...)
+}
+
+// Fatal logs the message at LevelFatal and exits the process like the Fatal level of zap.
+func (l *SlogLogger) Fatal(msg string, fields ...interface{}) {
+	l.slogLogger.Log(context.Background(), LevelFatal, msg, fields...)
+	os.Exit(1)
+}
@@ -1,32 +1,154 @@
 package pkg
 
 import (
+	"os"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"os"
 )
 
+// TraceLevel is the zap level used for trace messages, below zapcore.DebugLevel.
+const TraceLevel = zapcore.DebugLevel - 1
+
+// NewZapLogger returns a logger writing JSON to os.Stdout at the Info level.
 func NewZapLogger() *ZapLogger {
+	logger, err := NewZapLoggerWithOptions()
+	if err != nil {
+		// The default options don't open any sinks so they can't fail
+		panic(err)
+	}
+	return logger
+}
+
+// ZapOption configures a ZapLogger created by NewZapLoggerWithOptions.
+type ZapOption func(c *zapConfig)
+
+type zapConfig struct {
+	level   zapcore.Level
+	encoder zapcore.Encoder
+	writer  zapcore.WriteSyncer
+	paths   []string
+	options []zap.Option
+}
+
+// ZapLevel sets the initial level of the logger, zapcore.InfoLevel by default.
+func ZapLevel(level zapcore.Level) ZapOption {
+	return func(c *zapConfig) {
+		c.level = level
+	}
+}
+
+// ZapEncoder sets the encoder of the logger, a JSON encoder with the production config by default.
+func ZapEncoder(encoder zapcore.Encoder) ZapOption {
+	return func(c *zapConfig) {
+		c.encoder = encoder
+	}
+}
+
+// ZapJSONEncoder uses a JSON encoder with the production config.
+func ZapJSONEncoder() ZapOption {
+	return ZapEncoder(zapcore.NewJSONEncoder(ZapEncoderConfig()))
+}
+
+// ZapConsoleEncoder uses a human-readable console encoder.
+func ZapConsoleEncoder() ZapOption {
+	config := ZapEncoderConfig()
+	config.EncodeTime = zapcore.ISO8601TimeEncoder
+	return ZapEncoder(zapcore.NewConsoleEncoder(config))
+}
+
+// ZapWriter sets the sink the logger writes to, os.Stdout by default.
+func ZapWriter(writer zapcore.WriteSyncer) ZapOption {
+	return func(c *zapConfig) {
+		c.writer = writer
+	}
+}
+
+// ZapOutputPaths sets the sinks the logger writes to by their zap URLs or paths, e.g. "stderr" or "/var/log/app.log".
+func ZapOutputPaths(paths ...string) ZapOption {
+	return func(c *zapConfig) {
+		c.paths = paths
+	}
+}
+
+// ZapOptions adds options, such as zap.AddCaller, to the zap logger.
+func ZapOptions(options ...zap.Option) ZapOption {
+	return func(c *zapConfig) {
+		c.options = append(c.options, options...)
+	}
+}
+
+// ZapEncoderConfig returns the production encoder config with a level encoder which is aware of TraceLevel.
+func ZapEncoderConfig() zapcore.EncoderConfig {
+	config := zap.NewProductionEncoderConfig()
+	config.EncodeLevel = LevelEncoder
+	return config
+}
+
+// LevelEncoder encodes levels like zapcore.LowercaseLevelEncoder and encodes TraceLevel as "trace".
+func LevelEncoder(level zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	if level == TraceLevel {
+		enc.AppendString("trace")
+		return
+	}
+	zapcore.LowercaseLevelEncoder(level, enc)
+}
+
+// NewZapLoggerWithOptions returns a logger configured by the options.
+func NewZapLoggerWithOptions(options ...ZapOption) (*ZapLogger, error) {
+	config := &zapConfig{
+		level: zapcore.InfoLevel,
+	}
+	for _, option := range options {
+		option(config)
+	}
+	if config.encoder == nil {
+		config.encoder = zapcore.NewJSONEncoder(ZapEncoderConfig())
+	}
+
+	writer := config.writer
+	if len(config.paths) > 0 {
+		sink, _, err := zap.Open(config.paths...)
+		if err != nil {
+			return nil, err
+		}
+		if writer != nil {
+			sink = zapcore.NewMultiWriteSyncer(writer, sink)
+		}
+		writer = sink
+	}
+	if writer == nil {
+		writer = zapcore.Lock(os.Stdout)
+	}
 
 	// Create an AtomicLevel to manage log level dynamically
-	atom := zap.NewAtomicLevel()
+	atom := zap.NewAtomicLevelAt(config.level)
 
-	// Set the initial log level
-	atom.SetLevel(zap.InfoLevel)
+	logger := zap.New(zapcore.NewCore(config.encoder, writer, atom), config.options...)
+	return &ZapLogger{
+		zapLogger: logger,
+		sugar:     logger.Sugar(),
+		atom:      atom,
+	}, nil
+}
 
-	logger := zap.New(zapcore.NewCore(
-		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
-		zapcore.Lock(os.Stdout),
-		atom,
-	))
+// NewZapLoggerFrom wraps an existing zap logger. The level of the returned logger starts at TraceLevel so the
+// existing logger decides which messages are written until SetLevel is used to restrict it further.
+func NewZapLoggerFrom(logger *zap.Logger) *ZapLogger {
+	atom := zap.NewAtomicLevelAt(TraceLevel)
+	logger = logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &levelCore{Core: core, level: atom}
+	}))
 	return &ZapLogger{
 		zapLogger: logger,
+		sugar:     logger.Sugar(),
 		atom:      atom,
 	}
 }
 
 type ZapLogger struct {
 	zapLogger *zap.Logger
+	sugar     *zap.SugaredLogger
 	atom      zap.AtomicLevel
 }
 
@@ -36,26 +158,67 @@ func (l *ZapLogger) SetLevel(level zapcore.Level) {
 	l.atom.SetLevel(level)
 }
 
+// With returns a child logger which adds the fields to every message. The child shares the level of its parent.
+func (l *ZapLogger) With(fields ...interface{}) *ZapLogger {
+	sugar := l.sugar.With(fields...)
+	return &ZapLogger{
+		zapLogger: sugar.Desugar(),
+		sugar:     sugar,
+		atom:      l.atom,
+	}
+}
+
+// Zap returns the underlying zap logger.
+func (l *ZapLogger) Zap() *zap.Logger {
+	return l.zapLogger
+}
+
+// Sync flushes any buffered log entries.
+func (l *ZapLogger) Sync() error {
+	return l.zapLogger.Sync()
+}
+
 func (l *ZapLogger) Trace(msg string, fields ...interface{}) {
-	l.zapLogger.Sugar().Debugw(msg, fields...) // Zap does not have a Trace level, using Debug instead
+	l.sugar.Logw(TraceLevel, msg, fields...)
 }
 
 func (l *ZapLogger) Debug(msg string, fields ...interface{}) {
-	l.zapLogger.Sugar().Debugw(msg, fields...)
+	l.sugar.Debugw(msg, fields...)
 }
 
 func (l *ZapLogger) Info(msg string, fields ...interface{}) {
-	l.zapLogger.Sugar().Infow(msg, fields...)
+	l.sugar.Infow(msg, fields...)
 }
 
 func (l *ZapLogger) Warn(msg string, fields ...interface{}) {
-	l.zapLogger.Sugar().Warnw(msg, fields...)
+	l.sugar.Warnw(msg, fields...)
 }
 
 func (l *ZapLogger) Error(msg string, fields ...interface{}) {
-	l.zapLogger.Sugar().Errorw(msg, fields...)
+	l.sugar.Errorw(msg, fields...)
 }
 
 func (l *ZapLogger) Fatal(msg string, fields ...interface{}) {
-	l.zapLogger.Sugar().Fatalw(msg, fields...)
+	l.sugar.Fatalw(msg, fields...)
+}
+
+// levelCore restricts the entries written by a core to the level of a ZapLogger.
+type levelCore struct {
+	zapcore.Core
+	level zap.AtomicLevel
+}
+
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return c.level.Enabled(level) && c.Core.Enabled(level)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.level.Enabled(entry.Level) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
 }
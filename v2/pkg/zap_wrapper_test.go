@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestZapLogger(t *testing.T) {
+	t.Run("NewZapLoggerWithOptions_WithWriterAndTrace", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := NewZapLoggerWithOptions(ZapWriter(zapcore.AddSync(&buf)), ZapLevel(TraceLevel))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		logger.With("job", "42").Trace("tracing", "key", "value")
+
+		out := buf.String()
+		for _, expected := range []string{`"level":"trace"`, `"msg":"tracing"`, `"job":"42"`, `"key":"value"`} {
+			if !strings.Contains(out, expected) {
+				t.Errorf("Expected output to contain %s, but got %s", expected, out)
+			}
+		}
+	})
+
+	t.Run("NewZapLoggerWithOptions_FiltersTraceAtDebug", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := NewZapLoggerWithOptions(ZapWriter(zapcore.AddSync(&buf)), ZapLevel(zapcore.DebugLevel), ZapConsoleEncoder())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		logger.Trace("hidden")
+		logger.Debug("visible")
+
+		if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "visible") {
+			t.Errorf("Expected only the debug message, but got %s", buf.String())
+		}
+	})
+
+	t.Run("NewZapLoggerFrom_WrapsExistingLogger", func(t *testing.T) {
+		core, logs := observer.New(zapcore.DebugLevel)
+		logger := NewZapLoggerFrom(zap.New(core))
+
+		logger.Info("first")
+		logger.SetLevel(zapcore.WarnLevel)
+		logger.With("component", "test").Info("filtered")
+		logger.Warn("second")
+
+		entries := logs.All()
+		if len(entries) != 2 || entries[0].Message != "first" || entries[1].Message != "second" {
+			t.Errorf("Expected the first and second messages, but got %v", entries)
+		}
+	})
+}
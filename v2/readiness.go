@@ -0,0 +1,325 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bgrewell/go-execute/v2/internal"
+)
+
+const (
+	// readinessInterval is how often probes that don't depend on the output are checked.
+	readinessInterval = 100 * time.Millisecond
+	// readinessCheckTimeout limits how long a single check of a probe may take.
+	readinessCheckTimeout = time.Second
+	// readinessOutputLimit is the number of bytes of every stream kept for output probes and errors.
+	readinessOutputLimit = 64 * 1024
+)
+
+// ErrProcessExited is wrapped by the error returned by WaitReady when the process exited before it was ready.
+var ErrProcessExited = errors.New("process exited before it was ready")
+
+// watchMu guards the watchers of all execution results.
+var watchMu sync.Mutex
+
+// ReadinessProbe is a condition a started process must meet before it is considered ready.
+type ReadinessProbe struct {
+	description string
+	output      bool
+	check       func(ctx context.Context, w *processWatch) bool
+}
+
+// String returns a description of the condition.
+func (p ReadinessProbe) String() string {
+	return p.description
+}
+
+// OutputMatches is met once the stdout or stderr of the process matches the regular expression.
+func OutputMatches(pattern *regexp.Regexp) ReadinessProbe {
+	return ReadinessProbe{
+		description: fmt.Sprintf("output matching %q", pattern),
+		output:      true,
+		check: func(ctx context.Context, w *processWatch) bool {
+			stdout, stderr := w.output()
+			return pattern.MatchString(stdout) || pattern.MatchString(stderr)
+		},
+	}
+}
+
+// StdoutMatches is met once the stdout of the process matches the regular expression.
+func StdoutMatches(pattern *regexp.Regexp) ReadinessProbe {
+	return ReadinessProbe{
+		description: fmt.Sprintf("stdout matching %q", pattern),
+		output:      true,
+		check: func(ctx context.Context, w *processWatch) bool {
+			stdout, _ := w.output()
+			return pattern.MatchString(stdout)
+		},
+	}
+}
+
+// StderrMatches is met once the stderr of the process matches the regular expression.
+func StderrMatches(pattern *regexp.Regexp) ReadinessProbe {
+	return ReadinessProbe{
+		description: fmt.Sprintf("stderr matching %q", pattern),
+		output:      true,
+		check: func(ctx context.Context, w *processWatch) bool {
+			_, stderr := w.output()
+			return pattern.MatchString(stderr)
+		},
+	}
+}
+
+// TCPListening is met once a TCP connection to the address, such as "localhost:8080", succeeds.
+func TCPListening(address string) ReadinessProbe {
+	return ReadinessProbe{
+		description: fmt.Sprintf("TCP connections on %s", address),
+		check: func(ctx context.Context, w *processWatch) bool {
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, "tcp", address)
+			if err != nil {
+				return false
+			}
+			conn.Close()
+			return true
+		},
+	}
+}
+
+// HTTPReady is met once a GET request to the URL returns a 2xx status code.
+func HTTPReady(url string) ReadinessProbe {
+	return ReadinessProbe{
+		description: fmt.Sprintf("HTTP 2xx from %s", url),
+		check: func(ctx context.Context, w *processWatch) bool {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return false
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return false
+			}
+			defer resp.Body.Close()
+			io.Copy(io.Discard, resp.Body)
+			return resp.StatusCode >= 200 && resp.StatusCode < 300
+		},
+	}
+}
+
+// FileExists is met once the file at the path exists, e.g. a pid file or a unix socket.
+func FileExists(path string) ReadinessProbe {
+	return ReadinessProbe{
+		description: fmt.Sprintf("file %s", path),
+		check: func(ctx context.Context, w *processWatch) bool {
+			_, err := os.Stat(path)
+			return err == nil
+		},
+	}
+}
+
+// ReadinessError is returned by WaitReady when the process didn't become ready.
+type ReadinessError struct {
+	// Probe describes the first condition that wasn't met.
+	Probe string
+	// Err is the reason, which wraps ErrProcessExited and the exit error when the process exited, or is the error
+	// of the context when the timeout expired.
+	Err error
+	// Stdout and Stderr are the last output of the process, up to 64KiB of each stream.
+	Stdout string
+	Stderr string
+}
+
+// Error returns the reason followed by the output of the process.
+func (e *ReadinessError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "process not ready, waiting for %s: %v", e.Probe, e.Err)
+	if stdout := strings.TrimRight(e.Stdout, "\n"); stdout != "" {
+		fmt.Fprintf(&b, "\nstdout:\n%s", stdout)
+	}
+	if stderr := strings.TrimRight(e.Stderr, "\n"); stderr != "" {
+		fmt.Fprintf(&b, "\nstderr:\n%s", stderr)
+	}
+	return b.String()
+}
+
+// Unwrap returns the reason.
+func (e *ReadinessError) Unwrap() error {
+	return e.Err
+}
+
+// WaitReady blocks until the process meets all conditions of the probes, and returns a ReadinessError if it exits
+// before or the timeout expires first. A timeout of 0 means no timeout. See WaitReadyContext.
+func (r *ExecutionResult) WaitReady(timeout time.Duration, probes ...ReadinessProbe) error {
+	ctx, cancel := timeoutContext(context.Background(), timeout)
+	if cancel != nil {
+		defer cancel()
+	}
+	return r.WaitReadyContext(ctx, probes...)
+}
+
+// WaitReadyContext blocks until the process meets all conditions of the probes, and returns a ReadinessError if it
+// exits before or the context is done first. The process keeps running when it isn't ready in time.
+//
+// The first call starts observing the process. It modifies the result in place: Stdout, Stderr and Finished are
+// replaced with equivalents that provide the same output and exit error, while the originals are consumed by the
+// observer. Readers and channels taken from the result before the first call no longer deliver the output or the exit
+// error, and the fields must not be read concurrently with the first call; read them again once it returned. Output
+// written before the first call is not lost.
+func (r *ExecutionResult) WaitReadyContext(ctx context.Context, probes ...ReadinessProbe) error {
+	w := r.watch()
+	pending := append([]ReadinessProbe(nil), probes...)
+	ticker := time.NewTicker(readinessInterval)
+	defer ticker.Stop()
+
+	pending = w.check(ctx, pending, false)
+	for len(pending) > 0 {
+		changed := w.changes()
+		select {
+		case <-changed:
+			pending = w.check(ctx, pending, true)
+		case <-ticker.C:
+			pending = w.check(ctx, pending, false)
+		case <-w.exited:
+			// Output written right before the exit may still satisfy the probes
+			if pending = w.check(ctx, pending, true); len(pending) == 0 {
+				return nil
+			}
+			err := ErrProcessExited
+			if w.exitErr != nil {
+				err = fmt.Errorf("%w: %w", ErrProcessExited, w.exitErr)
+			}
+			return w.notReady(pending[0], err)
+		case <-ctx.Done():
+			return w.notReady(pending[0], ctx.Err())
+		}
+	}
+	return nil
+}
+
+// watch returns the watcher of the process, which is created on the first call.
+func (r *ExecutionResult) watch() *processWatch {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	if r.watcher != nil {
+		return r.watcher
+	}
+
+	w := &processWatch{changed: make(chan struct{}), exited: make(chan struct{})}
+	stdout := internal.NewExecReadWriter(io.NopCloser(&watchReader{r: r.Stdout, w: w, buf: &w.stdout}))
+	stderr := internal.NewExecReadWriter(io.NopCloser(&watchReader{r: r.Stderr, w: w, buf: &w.stderr}))
+	finished := make(chan error, 1)
+	go func(original <-chan error) {
+		defer close(finished)
+		err, ok := <-original
+		stdout.Wait()
+		stderr.Wait()
+		w.exit(err)
+		if ok {
+			finished <- err
+		}
+	}(r.Finished)
+
+	r.Stdout, r.Stderr, r.Finished = stdout, stderr, finished
+	r.watcher = w
+	return w
+}
+
+// processWatch records the last output of a process and its exit for readiness probes.
+type processWatch struct {
+	mu      sync.Mutex
+	stdout  []byte
+	stderr  []byte
+	changed chan struct{}
+	exited  chan struct{}
+	exitErr error
+}
+
+// write appends the output to the buffer of the stream, keeping only the last readinessOutputLimit bytes, and
+// notifies the waiters.
+func (w *processWatch) write(buf *[]byte, data []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	*buf = append(*buf, data...)
+	if len(*buf) > 2*readinessOutputLimit {
+		*buf = append([]byte(nil), (*buf)[len(*buf)-readinessOutputLimit:]...)
+	}
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+// output returns the last output of the process.
+func (w *processWatch) output() (stdout, stderr string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return string(tail(w.stdout)), string(tail(w.stderr))
+}
+
+// changes returns a channel which is closed once the process writes output.
+func (w *processWatch) changes() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.changed
+}
+
+// exit records the exit of the process.
+func (w *processWatch) exit(err error) {
+	w.exitErr = err
+	close(w.exited)
+}
+
+// check returns the probes whose conditions aren't met yet. When outputOnly is set only output probes are checked.
+func (w *processWatch) check(ctx context.Context, probes []ReadinessProbe, outputOnly bool) []ReadinessProbe {
+	pending := probes[:0]
+	for _, probe := range probes {
+		if outputOnly && !probe.output {
+			pending = append(pending, probe)
+			continue
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+		ready := probe.check(checkCtx, w)
+		cancel()
+		if !ready {
+			pending = append(pending, probe)
+		}
+	}
+	return pending
+}
+
+// notReady returns the error reported when the process didn't become ready.
+func (w *processWatch) notReady(probe ReadinessProbe, err error) error {
+	stdout, stderr := w.output()
+	return &ReadinessError{Probe: probe.String(), Err: err, Stdout: stdout, Stderr: stderr}
+}
+
+// tail returns the last readinessOutputLimit bytes of the output.
+func tail(output []byte) []byte {
+	if len(output) > readinessOutputLimit {
+		return output[len(output)-readinessOutputLimit:]
+	}
+	return output
+}
+
+// watchReader passes the output read from a stream of the process to the watcher.
+type watchReader struct {
+	r   io.Reader
+	w   *processWatch
+	buf *[]byte
+}
+
+// Read reads from the stream and records the data that was read.
+func (r *watchReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.w.write(r.buf, p[:n])
+	}
+	return n, err
+}
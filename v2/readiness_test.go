@@ -0,0 +1,120 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitReady(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+	executor := NewExecutor(WithShell("sh"))
+
+	t.Run("WaitReady_MatchesOutput", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		execResult, err := Start(ctx, executor, "echo starting; sleep 0.2; echo 'listening on :8080' >&2; exec sleep 5")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if err := execResult.WaitReady(5*time.Second, StderrMatches(regexp.MustCompile(`listening on :\d+`))); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		cancel()
+		stdout, _ := io.ReadAll(execResult.Stdout)
+		stderr, _ := io.ReadAll(execResult.Stderr)
+		if string(stdout) != "starting\n" || string(stderr) != "listening on :8080\n" {
+			t.Errorf("Expected the output to remain readable, but got %q and %q", stdout, stderr)
+		}
+		if err := <-execResult.Finished; err == nil {
+			t.Errorf("Expected the killed process to report an error, but got nil")
+		}
+	})
+
+	t.Run("WaitReady_ReplacesStreamsInPlace", func(t *testing.T) {
+		execResult, err := executor.ExecuteAsync("echo ready")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		stdout, finished := execResult.Stdout, execResult.Finished
+
+		if err := execResult.WaitReady(5*time.Second, StdoutMatches(regexp.MustCompile(`ready`))); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if execResult.Stdout == stdout || execResult.Finished == finished {
+			t.Errorf("Expected Stdout and Finished to be replaced by the wait")
+		}
+		output, _ := io.ReadAll(execResult.Stdout)
+		if string(output) != "ready\n" {
+			t.Errorf("Expected the replaced stdout to provide the output, but got %q", output)
+		}
+		if err := <-execResult.Finished; err != nil {
+			t.Errorf("Expected the replaced Finished to provide the exit error, but got %v", err)
+		}
+		if _, ok := <-finished; ok {
+			t.Errorf("Expected the original Finished to be consumed by the wait")
+		}
+	})
+
+	t.Run("WaitReady_FailsWhenProcessExits", func(t *testing.T) {
+		execResult, err := executor.ExecuteAsync("echo 'bind: address already in use' >&2; exit 3")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		err = execResult.WaitReady(5*time.Second, OutputMatches(regexp.MustCompile(`listening`)))
+		var readinessErr *ReadinessError
+		if !errors.As(err, &readinessErr) || !errors.Is(err, ErrProcessExited) || ExitCode(err) != 3 {
+			t.Fatalf("Expected a ReadinessError for the exit, but got %v", err)
+		}
+		if !strings.Contains(err.Error(), "address already in use") {
+			t.Errorf("Expected the error to include the output, but got %q", err)
+		}
+		if err := <-execResult.Finished; ExitCode(err) != 3 {
+			t.Errorf("Expected exit code 3, but got %v", err)
+		}
+	})
+
+	t.Run("WaitReady_TimesOut", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		execResult, err := Start(ctx, executor, "exec sleep 5")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		err = execResult.WaitReady(200*time.Millisecond, FileExists(filepath.Join(t.TempDir(), "missing")))
+		if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "missing") {
+			t.Errorf("Expected a timeout waiting for the file, but got %v", err)
+		}
+	})
+
+	t.Run("WaitReady_ChecksNetworkAndFiles", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+		marker := filepath.Join(t.TempDir(), "ready")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		execResult, err := Start(ctx, executor, "sleep 0.2; touch "+marker+"; exec sleep 5")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		err = execResult.WaitReady(5*time.Second, TCPListening(server.Listener.Addr().String()), HTTPReady(server.URL), FileExists(marker))
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
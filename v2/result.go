@@ -0,0 +1,167 @@
+package execute
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"time"
+)
+
+// Result describes a finished execution. It is reported once the process has exited and its output has been fully
+// read, or when the command failed to start.
+type Result struct {
+	// Spec is the redacted spec of the command.
+	Spec *CommandSpec
+	// StartTime is the time the process was started.
+	StartTime time.Time
+	// EndTime is the time the process exited.
+	EndTime time.Time
+	// ExitCode is the exit code of the process, or -1 if it failed to start or was terminated by a signal.
+	ExitCode int
+	// Err is the error returned when waiting for the process, or the reason it failed to start.
+	Err error
+	// TimedOut is set when the process was killed because the timeout expired.
+	TimedOut bool
+	// DryRun is set when the command was only recorded and the result is synthetic.
+	DryRun bool
+	// StdoutBytes and StderrBytes are the number of bytes the process wrote to stdout and stderr.
+	StdoutBytes int64
+	StderrBytes int64
+	// StdoutSHA256 and StderrSHA256 are the hex encoded SHA-256 hashes of the output of the process. They are empty
+	// when the output is not captured, e.g. for commands attached to a TTY.
+	StdoutSHA256 string
+	StderrSHA256 string
+	// Attempt is the number of the attempt, starting at 1, when the command was retried according to a RetryPolicy.
+	Attempt int
+	// Attempts are the results of the earlier attempts of a retried command, in the order they were made.
+	Attempts []*Result
+}
+
+// Duration returns how long the process was running.
+func (r *Result) Duration() time.Duration {
+	return r.EndTime.Sub(r.StartTime)
+}
+
+// newResult returns the result of the command described by the spec that was started at the given time.
+func newResult(spec *CommandSpec, start time.Time, ctx context.Context, err error) *Result {
+	result := &Result{
+		Spec:      spec.Redacted(),
+		StartTime: start,
+		EndTime:   time.Now(),
+		ExitCode:  ExitCode(err),
+		Err:       err,
+		Attempt:   1,
+		Attempts:  spec.previous,
+	}
+	if spec.attempt > 0 {
+		result.Attempt = spec.attempt
+	}
+	if ctx != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		result.TimedOut = true
+	}
+	return result
+}
+
+// setOutput records the size and hash of the output captured by the taps.
+func (r *Result) setOutput(stdout, stderr *outputTap) {
+	r.StdoutBytes, r.StdoutSHA256 = stdout.n, stdout.sum()
+	r.StderrBytes, r.StderrSHA256 = stderr.n, stderr.sum()
+}
+
+// ExitCode returns the exit code represented by the error returned when executing a command: 0 for nil, the exit code
+// of errors that carry one, such as *exec.ExitError, and -1 otherwise.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// complete reports the result of a finished execution to the audit sink, the exit callbacks registered on the spec
+// and the OnExit hooks of the executor.
+func (e *BaseExecutor) complete(spec *CommandSpec, result *Result) {
+	if e.auditSink != nil {
+		e.audit(result)
+	}
+	for i := len(spec.onExit) - 1; i >= 0; i-- {
+		spec.onExit[i](result)
+	}
+	for _, hooks := range e.hooks {
+		if hooks.OnExit != nil {
+			hooks.OnExit(spec, result)
+		}
+	}
+}
+
+// maxOutputLine is the length after which a line of output is split when it is passed to the line function of an
+// outputTap.
+const maxOutputLine = 64 * 1024
+
+// outputTap counts and hashes the output read from a process and optionally passes it to a function as it is read
+// and to another function line by line.
+type outputTap struct {
+	io.ReadCloser
+	hash    hash.Hash
+	n       int64
+	output  func(data []byte)
+	line    func(line string)
+	partial []byte
+}
+
+// newOutputTap returns a tap reading from r.
+func newOutputTap(r io.ReadCloser) *outputTap {
+	return &outputTap{ReadCloser: r, hash: sha256.New()}
+}
+
+// Read reads from the underlying reader and records the data that was read.
+func (t *outputTap) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.hash.Write(p[:n])
+		t.n += int64(n)
+		if t.output != nil {
+			t.output(p[:n])
+		}
+		if t.line != nil {
+			t.splitLines(p[:n])
+		}
+	}
+	if err != nil && t.line != nil && len(t.partial) > 0 {
+		t.line(string(t.partial))
+		t.partial = nil
+	}
+	return n, err
+}
+
+// splitLines passes the complete lines in the data to the line function and keeps the remainder for the next read.
+func (t *outputTap) splitLines(data []byte) {
+	t.partial = append(t.partial, data...)
+	for {
+		i := bytes.IndexByte(t.partial, '\n')
+		if i < 0 {
+			break
+		}
+		t.line(string(bytes.TrimSuffix(t.partial[:i], []byte("\r"))))
+		t.partial = t.partial[i+1:]
+	}
+	if len(t.partial) >= maxOutputLine {
+		t.line(string(t.partial))
+		t.partial = nil
+	}
+	if len(t.partial) == 0 {
+		t.partial = nil
+	}
+}
+
+// sum returns the hex encoded hash of the data read so far.
+func (t *outputTap) sum() string {
+	return hex.EncodeToString(t.hash.Sum(nil))
+}
@@ -0,0 +1,305 @@
+package execute
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"regexp"
+	"time"
+)
+
+// defaultRetryMultiplier is the factor the backoff grows by after every attempt when the policy doesn't set one.
+const defaultRetryMultiplier = 2
+
+// RetryPolicy describes how failed commands are retried. Every attempt is a separate execution, which passes through
+// the middleware, hooks and audit sink of the executor, and the Result of the final attempt holds the results of the
+// earlier attempts.
+//
+// The timeout of a command applies to all of its attempts together, and no attempt is started once the context of the
+// command is done or the backoff would end after its deadline. Commands with an input or attached to a TTY are never
+// retried as their input can't be replayed.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one. Values below 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, 0 retries immediately.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts, 0 means no cap.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay grows by after every retry, 0 means 2.
+	Multiplier float64
+	// Jitter is the fraction of the delay, between 0 and 1, that is randomly subtracted from it so that clients
+	// retrying at the same time spread out.
+	Jitter float64
+	// AttemptTimeout limits the duration of every attempt, 0 means attempts are only limited by the timeout of the
+	// command.
+	AttemptTimeout time.Duration
+	// RetryIf decides whether a failed attempt is retried. When it is nil every failed attempt is retried.
+	RetryIf RetryCondition
+}
+
+// backoff returns the delay before the retry following the attempt, which is numbered from 1.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = defaultRetryMultiplier
+	}
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		delay *= multiplier
+		if p.MaxBackoff > 0 && delay >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		delay -= delay * min(p.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// RetryAttempt is a failed attempt passed to a RetryCondition.
+type RetryAttempt struct {
+	// Result is the result of the attempt.
+	Result *Result
+	// Stderr is the output the attempt wrote to stderr.
+	Stderr string
+	// Err is the error of the attempt, the exit error of the process or the reason it failed to start.
+	Err error
+}
+
+// RetryCondition decides whether a failed attempt is retried.
+type RetryCondition func(attempt *RetryAttempt) bool
+
+// RetryOnExitCodes retries attempts which exited with one of the codes.
+func RetryOnExitCodes(codes ...int) RetryCondition {
+	return func(attempt *RetryAttempt) bool {
+		for _, code := range codes {
+			if attempt.Result.ExitCode == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// RetryOnStderr retries attempts whose stderr matches the regular expression.
+func RetryOnStderr(pattern *regexp.Regexp) RetryCondition {
+	return func(attempt *RetryAttempt) bool {
+		return pattern.MatchString(attempt.Stderr)
+	}
+}
+
+// RetryOnError retries attempts whose error matches one of the targets according to errors.Is.
+func RetryOnError(targets ...error) RetryCondition {
+	return func(attempt *RetryAttempt) bool {
+		for _, target := range targets {
+			if errors.Is(attempt.Err, target) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// RetryOnErrorType retries attempts whose error has the type T according to errors.As, e.g. *exec.Error for commands
+// that failed to start.
+func RetryOnErrorType[T error]() RetryCondition {
+	return func(attempt *RetryAttempt) bool {
+		var target T
+		return errors.As(attempt.Err, &target)
+	}
+}
+
+// RetryOnAny retries attempts for which any of the conditions is met.
+func RetryOnAny(conditions ...RetryCondition) RetryCondition {
+	return func(attempt *RetryAttempt) bool {
+		for _, condition := range conditions {
+			if condition(attempt) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SetRetryPolicy sets the policy failed commands are retried with. A nil policy disables retries. The output of a
+// retried command is buffered and only becomes readable once the final attempt has finished.
+func (e *BaseExecutor) SetRetryPolicy(policy *RetryPolicy) {
+	e.retryPolicy = policy
+}
+
+// RetryPolicy returns the policy failed commands are retried with, or nil if they are not retried.
+func (e *BaseExecutor) RetryPolicy() *RetryPolicy {
+	return e.retryPolicy
+}
+
+// retries returns whether the command described by the spec is retried when it fails.
+func (e *BaseExecutor) retries(spec *CommandSpec) bool {
+	return e.retryPolicy != nil && e.retryPolicy.MaxAttempts > 1 && !e.dryRun && !spec.TTY && spec.Stdin == nil
+}
+
+// retrier runs the attempts of a command that is retried.
+type retrier struct {
+	e        *BaseExecutor
+	policy   RetryPolicy
+	next     RunFunc
+	spec     *CommandSpec
+	ctx      context.Context
+	previous []*Result
+}
+
+// retry executes the command described by the spec with next until an attempt succeeds or the policy of the executor
+// gives up. The returned ExecutionResult provides the output of the final attempt.
+func (e *BaseExecutor) retry(next RunFunc, spec *CommandSpec) (*ExecutionResult, error) {
+	ctx, cancel := timeoutContext(spec.parentContext(), spec.Timeout)
+	r := &retrier{e: e, policy: *e.retryPolicy, next: next, spec: spec, ctx: ctx}
+
+	// Failing to start is only reported to the caller when the command isn't retried
+	execResult, current, err := r.start()
+	if err != nil && !r.retry(&RetryAttempt{Result: current.result, Err: err}) {
+		if cancel != nil {
+			cancel()
+		}
+		return nil, err
+	}
+
+	stdout, stderr := newRetryOutput(), newRetryOutput()
+	finished := make(chan error, 1)
+	go func() {
+		defer close(finished)
+		var outBytes, errBytes []byte
+		for {
+			if execResult == nil {
+				outBytes, errBytes = nil, nil
+				execResult, current, err = r.start()
+				if err != nil {
+					if !r.retry(&RetryAttempt{Result: current.result, Err: err}) {
+						break
+					}
+					continue
+				}
+			}
+			err = <-execResult.Finished
+			outBytes, _ = io.ReadAll(execResult.Stdout)
+			errBytes, _ = io.ReadAll(execResult.Stderr)
+			execResult = nil
+			if !r.retry(&RetryAttempt{Result: r.result(current.result, err), Stderr: string(errBytes), Err: err}) {
+				break
+			}
+		}
+		stdout.set(outBytes)
+		stderr.set(errBytes)
+		finished <- err
+		if cancel != nil {
+			cancel()
+		}
+	}()
+
+	return &ExecutionResult{
+		Stdout:   stdout,
+		Stderr:   stderr,
+		Finished: finished,
+		Ctx:      ctx,
+	}, nil
+}
+
+// attempt holds the result of an attempt, which is set once the attempt has finished or failed to start.
+type attempt struct {
+	result *Result
+}
+
+// start starts the next attempt.
+func (r *retrier) start() (*ExecutionResult, *attempt, error) {
+	spec := r.attemptSpec()
+	spec.ctx = r.ctx
+	spec.Timeout = r.policy.AttemptTimeout
+
+	a := &attempt{}
+	spec.OnExit(func(result *Result) {
+		a.result = result
+	})
+	execResult, err := r.next(spec)
+	if err != nil {
+		a.result = r.result(a.result, err)
+		return nil, a, err
+	}
+	return execResult, a, nil
+}
+
+// attemptSpec returns a copy of the spec of the command for the next attempt.
+func (r *retrier) attemptSpec() *CommandSpec {
+	spec := r.spec.clone()
+	spec.attempt = len(r.previous) + 1
+	spec.previous = r.previous
+	return spec
+}
+
+// result returns the result of the attempt, which middleware may have prevented from being reported.
+func (r *retrier) result(result *Result, err error) *Result {
+	if result != nil {
+		return result
+	}
+	return newResult(r.attemptSpec(), time.Now(), r.ctx, err)
+}
+
+// retry records the finished attempt and returns whether the command is retried, after waiting for the backoff.
+func (r *retrier) retry(attempt *RetryAttempt) bool {
+	if attempt.Err == nil {
+		return false
+	}
+	r.previous = append(r.previous[:len(r.previous):len(r.previous)], attempt.Result)
+	if len(r.previous) >= r.policy.MaxAttempts || r.ctx.Err() != nil {
+		return false
+	}
+	if r.policy.RetryIf != nil && !r.policy.RetryIf(attempt) {
+		return false
+	}
+
+	delay := r.policy.backoff(len(r.previous))
+	if deadline, ok := r.ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+		r.e.log().Debug("not retrying command, the backoff ends after the deadline", "command", r.spec.Command, "delay", delay)
+		return false
+	}
+	r.e.log().Warn("retrying failed command", "command", r.spec.Command, "attempt", len(r.previous), "exit", attempt.Result.ExitCode, "error", attempt.Err, "delay", delay)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.ctx.Done():
+		return false
+	}
+}
+
+// retryOutput is the output of a retried command, which blocks readers until the final attempt has finished.
+type retryOutput struct {
+	ready  chan struct{}
+	reader *bytes.Reader
+}
+
+// newRetryOutput returns an output which isn't ready yet.
+func newRetryOutput() *retryOutput {
+	return &retryOutput{ready: make(chan struct{})}
+}
+
+// set provides the output to readers.
+func (o *retryOutput) set(data []byte) {
+	o.reader = bytes.NewReader(data)
+	close(o.ready)
+}
+
+// Read blocks until the output is set.
+func (o *retryOutput) Read(p []byte) (int, error) {
+	<-o.ready
+	return o.reader.Read(p)
+}
+
+// Close implements io.Closer.
+func (o *retryOutput) Close() error {
+	return nil
+}
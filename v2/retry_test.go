@@ -0,0 +1,145 @@
+package execute
+
+import (
+	"io"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, delay := range expected {
+		if backoff := policy.backoff(i + 1); backoff != delay {
+			t.Errorf("Expected backoff %s after attempt %d, but got %s", delay, i+1, backoff)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if backoff := policy.backoff(2); backoff < 100*time.Millisecond || backoff > 200*time.Millisecond {
+			t.Fatalf("Expected backoff between 100ms and 200ms, but got %s", backoff)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+
+	// recordResults returns an option recording the results reported to the OnExit hooks
+	recordResults := func(results *[]*Result) Option {
+		var mu sync.Mutex
+		return WithHooks(Hooks{OnExit: func(spec *CommandSpec, result *Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			*results = append(*results, result)
+		}})
+	}
+
+	t.Run("Retry_SucceedsAfterFailedAttempts", func(t *testing.T) {
+		marker := filepath.Join(t.TempDir(), "marker")
+		var results []*Result
+		executor := NewExecutor(WithShell("sh"), recordResults(&results), WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond}))
+
+		stdout, stderr, err := executor.ExecuteSeparate("test -f " + marker + " && echo done || { touch " + marker + "; echo failed >&2; exit 1; }")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if stdout != "done\n" || stderr != "" {
+			t.Errorf("Expected the output of the final attempt, but got %q and %q", stdout, stderr)
+		}
+		if len(results) != 2 {
+			t.Fatalf("Expected 2 attempts, but got %d", len(results))
+		}
+		final := results[1]
+		if final.Attempt != 2 || len(final.Attempts) != 1 || final.Attempts[0] != results[0] {
+			t.Errorf("Expected the final result to hold the first attempt, but got attempt %d with %v", final.Attempt, final.Attempts)
+		}
+		if results[0].Attempt != 1 || results[0].ExitCode != 1 {
+			t.Errorf("Expected the first attempt to exit with 1, but got attempt %d with %d", results[0].Attempt, results[0].ExitCode)
+		}
+	})
+
+	t.Run("Retry_StopsAfterMaxAttempts", func(t *testing.T) {
+		var results []*Result
+		executor := NewExecutor(WithShell("sh"), recordResults(&results), WithRetry(RetryPolicy{MaxAttempts: 3}))
+
+		execResult, err := executor.ExecuteAsync("echo broken >&2; exit 2")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := <-execResult.Finished; ExitCode(err) != 2 {
+			t.Errorf("Expected exit code 2, but got %v", err)
+		}
+		if stderr, _ := io.ReadAll(execResult.Stderr); string(stderr) != "broken\n" {
+			t.Errorf("Expected the stderr of the final attempt, but got %q", stderr)
+		}
+		if len(results) != 3 || len(results[2].Attempts) != 2 {
+			t.Errorf("Expected 3 attempts, but got %d", len(results))
+		}
+	})
+
+	t.Run("Retry_OnlyRetriesMatchingFailures", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			command  string
+			attempts int
+		}{
+			{"ExitCode", "exit 75", 2},
+			{"Stderr", "echo 'E: Could not get lock /var/lib/dpkg/lock' >&2; exit 100", 2},
+			{"Other", "echo 'E: Unable to locate package' >&2; exit 100", 1},
+		}
+		for _, tt := range tests {
+			var results []*Result
+			executor := NewExecutor(WithShell("sh"), recordResults(&results), WithRetry(RetryPolicy{
+				MaxAttempts: 2,
+				RetryIf:     RetryOnAny(RetryOnExitCodes(75), RetryOnStderr(regexp.MustCompile(`Could not get lock`))),
+			}))
+
+			if _, err := executor.Execute(tt.command); err == nil {
+				t.Errorf("%s: expected an error, but got nil", tt.name)
+			}
+			if len(results) != tt.attempts {
+				t.Errorf("%s: expected %d attempts, but got %d", tt.name, tt.attempts, len(results))
+			}
+		}
+	})
+
+	t.Run("Retry_RespectsTimeout", func(t *testing.T) {
+		var results []*Result
+		executor := NewExecutor(WithShell("sh"), recordResults(&results), WithRetry(RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, AttemptTimeout: 100 * time.Millisecond}))
+
+		start := time.Now()
+		_, err := executor.ExecuteWithTimeout("exec sleep 5", 350*time.Millisecond)
+		if err == nil {
+			t.Errorf("Expected an error, but got nil")
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Expected the retries to stop at the timeout, but they took %s", elapsed)
+		}
+		if len(results) != 2 || !results[0].TimedOut {
+			t.Errorf("Expected 2 attempts which timed out, but got %d", len(results))
+		}
+	})
+
+	t.Run("Retry_SkipsCommandsWithInput", func(t *testing.T) {
+		var results []*Result
+		executor := NewExecutor(WithShell("sh"), recordResults(&results), WithRetry(RetryPolicy{MaxAttempts: 3}))
+
+		execResult, err := executor.ExecuteAsyncWithInput("cat >/dev/null; exit 1", io.NopCloser(strings.NewReader("")))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		<-execResult.Finished
+		if len(results) != 1 {
+			t.Errorf("Expected 1 attempt, but got %d", len(results))
+		}
+	})
+}
@@ -1,5 +1,15 @@
 package execute
 
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"sync"
+)
+
+// ScriptType identifies the interpreter used to run a script. The built-in script types are registered automatically
+// and additional ones can be added with RegisterScriptType.
 type ScriptType string
 
 const (
@@ -7,3 +17,227 @@ const (
 	ScriptTypeBash       ScriptType = "bash"
 	ScriptTypePython     ScriptType = "python"
 )
+
+var (
+	interpretersMu sync.RWMutex
+	interpreters   = map[ScriptType]Interpreter{
+		ScriptTypePowerShell: &PowerShellInterpreter{},
+		ScriptTypeBash: &CommandInterpreter{
+			FileExtension: ".sh",
+			Binaries:      []string{"bash"},
+			QuoteFunc:     QuoteShell,
+		},
+		ScriptTypePython: &CommandInterpreter{
+			FileExtension:   ".py",
+			Binaries:        []string{"python3", "python"},
+			ParameterPrefix: "--",
+			QuoteFunc:       QuotePython,
+		},
+	}
+)
+
+// ScriptParameter is a named parameter passed to a script. Interpreters that implement TypedInterpreter receive the
+// value as is, all other interpreters receive it formatted as a string.
+type ScriptParameter struct {
+	Name  string
+	Value interface{}
+}
+
+// ScriptParameters is an ordered list of named script parameters.
+type ScriptParameters []ScriptParameter
+
+// NewScriptParameters returns the values as script parameters sorted by name.
+func NewScriptParameters(values map[string]interface{}) ScriptParameters {
+	params := make(ScriptParameters, 0, len(values))
+	for name, value := range values {
+		params = append(params, ScriptParameter{Name: name, Value: value})
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	return params
+}
+
+// stringParameters returns the string values as script parameters sorted by name.
+func stringParameters(values map[string]string) ScriptParameters {
+	params := make(ScriptParameters, 0, len(values))
+	for _, name := range sortedKeys(values) {
+		params = append(params, ScriptParameter{Name: name, Value: values[name]})
+	}
+	return params
+}
+
+// strings returns the parameters formatted as strings for interpreters that don't support typed parameters.
+func (p ScriptParameters) strings() (map[string]string, error) {
+	if len(p) == 0 {
+		return nil, nil
+	}
+	values := make(map[string]string, len(p))
+	for _, param := range p {
+		switch v := param.Value.(type) {
+		case string:
+			values[param.Name] = v
+		case fmt.Stringer:
+			values[param.Name] = v.String()
+		case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			values[param.Name] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("parameter %s: %T values are not supported by this interpreter", param.Name, v)
+		}
+	}
+	return values, nil
+}
+
+// Interpreter describes how scripts of a given ScriptType are stored on disk and how the interpreter is invoked to
+// run them.
+type Interpreter interface {
+	// Extension returns the file extension, including the leading dot, used when writing a script to disk.
+	Extension() string
+	// LookPath returns the path to the interpreter binary.
+	LookPath() (string, error)
+	// Args returns the arguments passed to the interpreter binary in order to run the script at scriptPath.
+	Args(scriptPath string, arguments []string, parameters map[string]string) ([]string, error)
+}
+
+// TypedInterpreter is implemented by interpreters that are able to pass typed parameters to scripts.
+type TypedInterpreter interface {
+	// TypedArgs returns the arguments passed to the interpreter binary in order to run the script at scriptPath with
+	// the parameters in the given order.
+	TypedArgs(scriptPath string, arguments []string, parameters ScriptParameters) ([]string, error)
+}
+
+// ExtensionInterpreter is implemented by interpreters that can only run scripts from files with their extension. Their
+// scripts are always staged on disk, even when in-memory scripts are enabled.
+type ExtensionInterpreter interface {
+	// RequiresExtension returns whether scripts must be stored in files with the extension of the interpreter.
+	RequiresExtension() bool
+}
+
+// RegisterScriptType registers the interpreter used for scripts of the given type. Registering a type that already
+// exists replaces the previous interpreter, which allows the built-in script types to be customized.
+func RegisterScriptType(name ScriptType, interpreter Interpreter) {
+	if interpreter == nil {
+		panic("execute: RegisterScriptType interpreter is nil")
+	}
+	interpretersMu.Lock()
+	defer interpretersMu.Unlock()
+	interpreters[name] = interpreter
+}
+
+// LookupScriptType returns the interpreter registered for the given script type.
+func LookupScriptType(name ScriptType) (Interpreter, bool) {
+	interpretersMu.RLock()
+	defer interpretersMu.RUnlock()
+	interpreter, ok := interpreters[name]
+	return interpreter, ok
+}
+
+// ScriptTypes returns the names of all registered script types in sorted order.
+func ScriptTypes() []ScriptType {
+	interpretersMu.RLock()
+	defer interpretersMu.RUnlock()
+	types := make([]ScriptType, 0, len(interpreters))
+	for name := range interpreters {
+		types = append(types, name)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// interpreterFor returns the interpreter for the script type or an error if the type has not been registered.
+func interpreterFor(scriptType ScriptType) (Interpreter, error) {
+	interpreter, ok := LookupScriptType(scriptType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported script type: %q", scriptType)
+	}
+	return interpreter, nil
+}
+
+// CommandInterpreter is a generic Interpreter for interpreters that are invoked as
+// `<binary> [flags...] <script> [parameters...] [arguments...]`, which covers most scripting languages such as node,
+// perl, ruby, lua or awk.
+type CommandInterpreter struct {
+	// FileExtension is the extension, including the leading dot, used when writing scripts to disk.
+	FileExtension string
+	// Binaries is the list of candidate interpreter binaries. The first one found in the PATH is used.
+	Binaries []string
+	// Flags are passed to the interpreter before the script path.
+	Flags []string
+	// ParameterPrefix is prepended to the name of each parameter, e.g. "--" results in `--name value`. When it is
+	// empty the interpreter does not support named parameters and passing any is an error.
+	ParameterPrefix string
+	// QuoteFunc escapes values embedded in scripts by a ScriptTemplate. When it is nil the script type does not
+	// support quoting.
+	QuoteFunc func(value interface{}) (string, error)
+	// ExtensionRequired is set for interpreters that only run scripts from files with the extension, which prevents
+	// their scripts from being staged in memory.
+	ExtensionRequired bool
+}
+
+// Extension returns the file extension used for scripts.
+func (i *CommandInterpreter) Extension() string {
+	return i.FileExtension
+}
+
+// RequiresExtension returns whether scripts must be stored in files with the extension.
+func (i *CommandInterpreter) RequiresExtension() bool {
+	return i.ExtensionRequired
+}
+
+// LookPath returns the path of the first of the candidate binaries that can be found.
+func (i *CommandInterpreter) LookPath() (string, error) {
+	return lookPathAny(i.Binaries)
+}
+
+// binaries returns the candidate binaries of the interpreter.
+func (i *CommandInterpreter) binaries() []string {
+	return i.Binaries
+}
+
+// Args returns the interpreter flags followed by the script path, the named parameters in sorted order and the
+// positional arguments.
+func (i *CommandInterpreter) Args(scriptPath string, arguments []string, parameters map[string]string) ([]string, error) {
+	if len(parameters) > 0 && i.ParameterPrefix == "" {
+		return nil, errors.New("interpreter does not support named parameters")
+	}
+	args := append([]string{}, i.Flags...)
+	args = append(args, scriptPath)
+	for _, key := range sortedKeys(parameters) {
+		args = append(args, i.ParameterPrefix+key, parameters[key])
+	}
+	return append(args, arguments...), nil
+}
+
+// Quote escapes the value using the QuoteFunc of the interpreter.
+func (i *CommandInterpreter) Quote(value interface{}) (string, error) {
+	if i.QuoteFunc == nil {
+		return "", errors.New("interpreter does not support quoting")
+	}
+	return i.QuoteFunc(value)
+}
+
+// lookPathAny returns the path of the first binary that can be found.
+func lookPathAny(binaries []string) (string, error) {
+	if len(binaries) == 0 {
+		return "", errors.New("no interpreter binaries configured")
+	}
+	var firstErr error
+	for _, binary := range binaries {
+		path, err := exec.LookPath(binary)
+		if err == nil {
+			return path, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return "", firstErr
+}
+
+// sortedKeys returns the keys of the map in sorted order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,226 @@
+package execute
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bgrewell/go-execute/v2/internal/utilities"
+)
+
+// powerShellParameterName matches the names that can be used for PowerShell script parameters.
+var powerShellParameterName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// PowerShellInterpreter runs scripts using Windows PowerShell or, when that is not available, PowerShell Core.
+//
+// Parameters are passed in order as `-Name value` pairs using -File which passes every value to the script as a
+// literal string. Booleans are treated as switches: true values are passed as `-Name` and false values are omitted.
+// Values that can't be represented as a literal string, such as arrays and hashtables, can only be passed to the
+// script as PowerShell literals through -EncodedCommand which is used automatically when such values are present.
+type PowerShellInterpreter struct {
+	// EncodedCommand always runs scripts through -EncodedCommand, which avoids all command line quoting issues at the
+	// cost of a longer and less readable command line.
+	EncodedCommand bool
+}
+
+// Extension returns the file extension used for PowerShell scripts.
+func (i *PowerShellInterpreter) Extension() string {
+	return ".ps1"
+}
+
+// RequiresExtension returns true as PowerShell only runs script files with the .ps1 extension.
+func (i *PowerShellInterpreter) RequiresExtension() bool {
+	return true
+}
+
+// LookPath returns the path to the PowerShell binary.
+func (i *PowerShellInterpreter) LookPath() (string, error) {
+	return lookPathAny(i.binaries())
+}
+
+// binaries returns the candidate PowerShell binaries.
+func (i *PowerShellInterpreter) binaries() []string {
+	if runtime.GOOS == "windows" {
+		return []string{"powershell.exe", "pwsh.exe"}
+	}
+	return []string{"pwsh", "powershell"}
+}
+
+// Args returns the arguments used to run the script with the parameters in sorted order followed by the positional
+// arguments.
+func (i *PowerShellInterpreter) Args(scriptPath string, arguments []string, parameters map[string]string) ([]string, error) {
+	return i.TypedArgs(scriptPath, arguments, stringParameters(parameters))
+}
+
+// TypedArgs returns the arguments used to run the script with the parameters in the given order followed by the
+// positional arguments.
+func (i *PowerShellInterpreter) TypedArgs(scriptPath string, arguments []string, parameters ScriptParameters) ([]string, error) {
+	encoded := i.EncodedCommand
+	for _, param := range parameters {
+		if !powerShellParameterName.MatchString(param.Name) {
+			return nil, fmt.Errorf("invalid PowerShell parameter name: %q", param.Name)
+		}
+		if !powerShellFileValue(param.Value) {
+			encoded = true
+		}
+	}
+
+	args := []string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass"}
+	if encoded {
+		command, err := powerShellInvocation(scriptPath, arguments, parameters)
+		if err != nil {
+			return nil, err
+		}
+		return append(args, "-EncodedCommand", utilities.ConvertToUTF16LEBase64String(command)), nil
+	}
+
+	args = append(args, "-File", scriptPath)
+	for _, param := range parameters {
+		if b, ok := param.Value.(bool); ok {
+			if b {
+				args = append(args, "-"+param.Name)
+			}
+			continue
+		}
+		value, err := templateString(param.Value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %w", param.Name, err)
+		}
+		args = append(args, "-"+param.Name, value)
+	}
+	return append(args, arguments...), nil
+}
+
+// Quote returns the value as a PowerShell literal.
+func (i *PowerShellInterpreter) Quote(value interface{}) (string, error) {
+	return QuotePowerShell(value)
+}
+
+// powerShellFileValue returns whether the value can be passed to a script using -File.
+func powerShellFileValue(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	if _, ok := value.(fmt.Stringer); !ok {
+		switch reflect.ValueOf(value).Kind() {
+		case reflect.Bool:
+			return true
+		case reflect.String,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return false
+		}
+	}
+	// Values starting with a dash are read as parameter names when they are passed using -File
+	s, err := templateString(value)
+	return err == nil && !strings.HasPrefix(s, "-")
+}
+
+// powerShellInvocation returns a PowerShell command which invokes the script with the parameters and arguments
+// passed as PowerShell literals and exits with the exit code of the script.
+func powerShellInvocation(scriptPath string, arguments []string, parameters ScriptParameters) (string, error) {
+	var b strings.Builder
+	b.WriteString("& ")
+	b.WriteString(quotePowerShellString(scriptPath))
+	for _, param := range parameters {
+		value, err := powerShellLiteral(param.Value)
+		if err != nil {
+			return "", fmt.Errorf("parameter %s: %w", param.Name, err)
+		}
+		b.WriteString(" -")
+		b.WriteString(param.Name)
+		b.WriteString(":")
+		b.WriteString(value)
+	}
+	for _, arg := range arguments {
+		b.WriteString(" ")
+		b.WriteString(quotePowerShellString(arg))
+	}
+	b.WriteString("; if ($LASTEXITCODE) { exit $LASTEXITCODE } elseif (-not $?) { exit 1 }")
+	return b.String(), nil
+}
+
+// powerShellLiteral returns the value as a PowerShell literal. Strings become single-quoted strings, booleans,
+// numbers and nil become the matching automatic variables or numeric literals, slices become arrays and maps become
+// hashtables with their keys in sorted order.
+func powerShellLiteral(value interface{}) (string, error) {
+	if value == nil {
+		return "$null", nil
+	}
+	if s, ok := value.(fmt.Stringer); ok {
+		return quotePowerShellString(s.String()), nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String:
+		return quotePowerShellString(v.String()), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return "$true", nil
+		}
+		return "$false", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch {
+		case f != f:
+			return "[double]::NaN", nil
+		case f > 0 && f*2 == f:
+			return "[double]::PositiveInfinity", nil
+		case f < 0 && f*2 == f:
+			return "[double]::NegativeInfinity", nil
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return "$null", nil
+		}
+		items := make([]string, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := powerShellLiteral(v.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			// Nested arrays are wrapped with the unary comma operator so they aren't flattened into the outer array
+			if k := reflect.ValueOf(v.Index(i).Interface()).Kind(); k == reflect.Slice || k == reflect.Array {
+				item = "," + item
+			}
+			items[i] = item
+		}
+		return "@(" + strings.Join(items, ", ") + ")", nil
+	case reflect.Map:
+		if v.IsNil() {
+			return "$null", nil
+		}
+		items := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			k, err := templateString(key.Interface())
+			if err != nil {
+				return "", err
+			}
+			val, err := powerShellLiteral(v.MapIndex(key).Interface())
+			if err != nil {
+				return "", err
+			}
+			items = append(items, quotePowerShellString(k)+" = "+val)
+		}
+		sort.Strings(items)
+		return "@{" + strings.Join(items, "; ") + "}", nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return "$null", nil
+		}
+		return powerShellLiteral(v.Elem().Interface())
+	}
+	return "", errors.New("unable to convert " + v.Type().String() + " to a PowerShell literal")
+}
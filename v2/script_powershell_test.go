@@ -0,0 +1,128 @@
+package execute
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+func decodePowerShellCommand(t *testing.T, encoded string) string {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding command: %v", err)
+	}
+	codes := make([]uint16, len(raw)/2)
+	for i := range codes {
+		codes[i] = uint16(raw[2*i]) | uint16(raw[2*i+1])<<8
+	}
+	return string(utf16.Decode(codes))
+}
+
+func TestPowerShellInterpreterTypedArgs(t *testing.T) {
+	interpreter := &PowerShellInterpreter{}
+
+	t.Run("TypedArgs_WithScalarParameters", func(t *testing.T) {
+		params := ScriptParameters{
+			{Name: "Name", Value: "it's a test"},
+			{Name: "Count", Value: 3},
+			{Name: "Force", Value: true},
+			{Name: "WhatIf", Value: false},
+		}
+		args, err := interpreter.TypedArgs(`C:\scripts\run.ps1`, []string{"extra"}, params)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := []string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", `C:\scripts\run.ps1`,
+			"-Name", "it's a test", "-Count", "3", "-Force", "extra"}
+		if !reflect.DeepEqual(args, expected) {
+			t.Errorf("Expected args %v, but got %v", expected, args)
+		}
+	})
+
+	t.Run("TypedArgs_WithArrayUsesEncodedCommand", func(t *testing.T) {
+		params := ScriptParameters{
+			{Name: "Items", Value: []string{"a", "b'c"}},
+			{Name: "Map", Value: map[string]interface{}{"b": 2, "a": true}},
+		}
+		args, err := interpreter.TypedArgs(`C:\scripts\run.ps1`, []string{"extra"}, params)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(args) != 6 || args[4] != "-EncodedCommand" {
+			t.Fatalf("Expected -EncodedCommand to be used, but got %v", args)
+		}
+		command := decodePowerShellCommand(t, args[5])
+		expected := `& 'C:\scripts\run.ps1' -Items:@('a', 'b''c') -Map:@{'a' = $true; 'b' = 2} 'extra'; ` +
+			`if ($LASTEXITCODE) { exit $LASTEXITCODE } elseif (-not $?) { exit 1 }`
+		if command != expected {
+			t.Errorf("Expected command %s, but got %s", expected, command)
+		}
+	})
+
+	t.Run("TypedArgs_WithDashValueUsesEncodedCommand", func(t *testing.T) {
+		params := ScriptParameters{
+			{Name: "Name", Value: "-Force"},
+			{Name: "Offset", Value: -5},
+		}
+		args, err := interpreter.TypedArgs("run.ps1", nil, params)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(args) != 6 || args[4] != "-EncodedCommand" {
+			t.Fatalf("Expected -EncodedCommand to be used, but got %v", args)
+		}
+		command := decodePowerShellCommand(t, args[5])
+		expected := `& 'run.ps1' -Name:'-Force' -Offset:-5; if ($LASTEXITCODE) { exit $LASTEXITCODE } elseif (-not $?) { exit 1 }`
+		if command != expected {
+			t.Errorf("Expected command %s, but got %s", expected, command)
+		}
+	})
+
+	t.Run("TypedArgs_WithInvalidName", func(t *testing.T) {
+		params := ScriptParameters{{Name: "Name; calc", Value: "x"}}
+		if _, err := interpreter.TypedArgs("run.ps1", nil, params); err == nil {
+			t.Errorf("Expected error for invalid parameter name, but got nil")
+		}
+	})
+
+	t.Run("Args_SortsMapParameters", func(t *testing.T) {
+		args, err := interpreter.Args("run.ps1", nil, map[string]string{"b": "2", "a": "1", "c": "3"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := []string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", "run.ps1",
+			"-a", "1", "-b", "2", "-c", "3"}
+		if !reflect.DeepEqual(args, expected) {
+			t.Errorf("Expected args %v, but got %v", expected, args)
+		}
+	})
+}
+
+func TestPowerShellLiteral(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{"it’s", "'it’’s'"},
+		{nil, "$null"},
+		{false, "$false"},
+		{-7, "-7"},
+		{2.5, "2.5"},
+		{[][]int{{1, 2}, {3}}, "@(,@(1, 2), ,@(3))"},
+		{[]interface{}{"a", 1}, "@('a', 1)"},
+	}
+	for _, test := range tests {
+		got, err := powerShellLiteral(test.input)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got != test.expected {
+			t.Errorf("powerShellLiteral(%#v): expected %s, but got %s", test.input, test.expected, got)
+		}
+	}
+
+	if _, err := powerShellLiteral(make(chan int)); err == nil {
+		t.Errorf("Expected error for unsupported type, but got nil")
+	}
+}
@@ -0,0 +1,268 @@
+package execute
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// errInMemoryScriptsUnsupported is returned by platforms that are unable to execute scripts from memory.
+var errInMemoryScriptsUnsupported = errors.New("in-memory scripts are not supported on this platform")
+
+// stagedScript is a script that has been written to a location the interpreter can read it from.
+type stagedScript struct {
+	// Path is the path passed to the interpreter.
+	Path string
+	// SHA256 is the hex encoded SHA-256 hash of the script contents.
+	SHA256 string
+	// file is the memory-backed file holding the script when it is executed from memory.
+	file *os.File
+	// remove removes a script staged by a transport.
+	remove func() error
+}
+
+// extraFiles returns the files which must be inherited by the interpreter process.
+func (s *stagedScript) extraFiles() []*os.File {
+	if s.file == nil {
+		return nil
+	}
+	return []*os.File{s.file}
+}
+
+// Close removes the staged script.
+func (s *stagedScript) Close() error {
+	if s.remove != nil {
+		return s.remove()
+	}
+	if s.file != nil {
+		return s.file.Close()
+	}
+	return os.Remove(s.Path)
+}
+
+// stageScript writes the script so that it can be executed by the interpreter for the script type. Scripts are staged
+// in memory when enabled and supported by the platform, otherwise they are written to the script directory with
+// permissions that only allow access by the user the script is executed as.
+func (e *BaseExecutor) stageScript(scriptType ScriptType, script string) (staged *stagedScript, err error) {
+	interpreter, err := interpreterFor(scriptType)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(script))
+	hash := hex.EncodeToString(sum[:])
+
+	if e.transport != nil {
+		return e.stageScriptWithTransport(interpreter, script, hash)
+	}
+
+	if e.inMemoryScripts && requiresExtension(interpreter) {
+		e.log().Info("the interpreter requires the script extension, staging script on disk", "scriptType", scriptType)
+	} else if e.inMemoryScripts {
+		staged, err = e.stageScriptInMemory(script)
+		if err == nil {
+			staged.SHA256 = hash
+			e.log().Info("staged script in memory", "scriptType", scriptType, "sha256", hash)
+			return staged, nil
+		}
+		if !errors.Is(err, errInMemoryScriptsUnsupported) {
+			return nil, err
+		}
+		e.log().Warn("in-memory scripts are not supported, staging script on disk", "scriptType", scriptType)
+	}
+
+	tmpFile, err := os.CreateTemp(e.scriptDir, "go-execute-*"+interpreter.Extension())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary script file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tmpFile.Close()
+			os.Remove(tmpFile.Name())
+		}
+	}()
+
+	if _, err = tmpFile.Write([]byte(script)); err != nil {
+		return nil, fmt.Errorf("failed to write to temporary script file: %w", err)
+	}
+
+	if err = tmpFile.Chmod(0700); err != nil {
+		return nil, fmt.Errorf("failed to set permissions on temporary script file: %w", err)
+	}
+
+	if e.user != "" {
+		if err = e.grantScriptAccess(tmpFile.Name()); err != nil {
+			return nil, fmt.Errorf("failed to grant %s access to temporary script file: %w", e.user, err)
+		}
+	}
+
+	if err = tmpFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close temporary script file: %w", err)
+	}
+
+	e.log().Info("staged script on disk", "scriptType", scriptType, "path", tmpFile.Name(), "sha256", hash)
+	return &stagedScript{Path: tmpFile.Name(), SHA256: hash}, nil
+}
+
+// requiresExtension returns whether the interpreter only runs scripts from files with its extension.
+func requiresExtension(interpreter Interpreter) bool {
+	ext, ok := interpreter.(ExtensionInterpreter)
+	return ok && ext.RequiresExtension()
+}
+
+// stagedBundle is a directory of scripts and supporting files that has been copied out of a filesystem.
+type stagedBundle struct {
+	// Dir is the temporary directory the bundle was staged into.
+	Dir string
+	// Path is the path to the entry script within Dir.
+	Path string
+	// SHA256 is the hex encoded SHA-256 hash of the entry script.
+	SHA256 string
+}
+
+// Close removes the staged bundle.
+func (b *stagedBundle) Close() error {
+	return os.RemoveAll(b.Dir)
+}
+
+// stageBundle copies the directory containing the entry script, including all of its subdirectories, from the
+// filesystem into a new temporary directory within the script directory.
+func (e *BaseExecutor) stageBundle(fsys fs.FS, scriptPath string) (bundle *stagedBundle, err error) {
+	if e.transport != nil {
+		return nil, fmt.Errorf("scripts from a filesystem are %w", errTransportUnsupported)
+	}
+	if !fs.ValidPath(scriptPath) {
+		return nil, fmt.Errorf("invalid script path: %q", scriptPath)
+	}
+	info, err := fs.Stat(fsys, scriptPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat script: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("script path is a directory: %q", scriptPath)
+	}
+
+	dir, err := os.MkdirTemp(e.scriptDir, "go-execute-bundle-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary bundle directory: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	if e.user != "" {
+		if err = e.grantScriptAccess(dir); err != nil {
+			return nil, fmt.Errorf("failed to grant %s access to temporary bundle directory: %w", e.user, err)
+		}
+	}
+
+	root := path.Dir(scriptPath)
+	err = fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == root {
+			return nil
+		}
+		rel := name
+		if root != "." {
+			rel = strings.TrimPrefix(name, root+"/")
+		}
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+
+		if d.IsDir() {
+			if err := os.Mkdir(target, 0700); err != nil {
+				return err
+			}
+		} else {
+			if !d.Type().IsRegular() {
+				return fmt.Errorf("unsupported file type: %q", name)
+			}
+			if err := copyFromFS(fsys, name, target); err != nil {
+				return err
+			}
+		}
+
+		if e.user != "" {
+			return e.grantScriptAccess(target)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to stage script bundle: %w", err)
+	}
+
+	entry := filepath.Join(dir, filepath.FromSlash(path.Base(scriptPath)))
+	hash, err := hashFile(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash script: %w", err)
+	}
+
+	e.log().Info("staged script bundle on disk", "dir", dir, "script", scriptPath, "sha256", hash)
+	return &stagedBundle{Dir: dir, Path: entry, SHA256: hash}, nil
+}
+
+// copyFromFS copies a file out of the filesystem into the target path with permissions that only allow access by its
+// owner.
+func copyFromFS(fsys fs.FS, name string, target string) error {
+	src, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0700)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// stageScriptInMemory delegates staging the script in memory to the platform-specific executor.
+func (e *BaseExecutor) stageScriptInMemory(script string) (*stagedScript, error) {
+	if e.platform == nil {
+		return nil, errInMemoryScriptsUnsupported
+	}
+	file, path, err := e.platform.stageScriptInMemory(script)
+	if err != nil {
+		return nil, err
+	}
+	return &stagedScript{Path: path, file: file}, nil
+}
+
+// grantScriptAccess delegates granting the run-as user access to the staged script to the platform-specific executor.
+func (e *BaseExecutor) grantScriptAccess(path string) error {
+	if e.platform == nil {
+		return errors.New("this method must be implemented by the platform-specific executor")
+	}
+	return e.platform.grantScriptAccess(path)
+}
+
+// hashFile returns the hex encoded SHA-256 hash of the file contents.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
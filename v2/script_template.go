@@ -0,0 +1,275 @@
+package execute
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// Quoter is implemented by interpreters that are able to escape values so they can be safely embedded in scripts.
+// The quote function of a ScriptTemplate uses the Quoter of the template's script type.
+type Quoter interface {
+	// Quote returns the value as a literal of the script language.
+	Quote(value interface{}) (string, error)
+}
+
+// TemplateOption configures a ScriptTemplate.
+type TemplateOption func(t *ScriptTemplate)
+
+// TemplateStrict makes rendering fail when the template references a variable that is not present in the data
+// instead of silently rendering it as "<no value>".
+func TemplateStrict() TemplateOption {
+	return func(t *ScriptTemplate) {
+		t.tmpl.Option("missingkey=error")
+	}
+}
+
+// TemplateFuncs adds functions to the template. The escaping functions provided by the library can't be replaced.
+func TemplateFuncs(funcs template.FuncMap) TemplateOption {
+	return func(t *ScriptTemplate) {
+		t.tmpl.Funcs(funcs)
+	}
+}
+
+// TemplateDelims sets the action delimiters of the template.
+func TemplateDelims(left, right string) TemplateOption {
+	return func(t *ScriptTemplate) {
+		t.tmpl.Delims(left, right)
+	}
+}
+
+// ScriptTemplate is a script built on text/template. Values should be inserted using the escaping functions which
+// are available in every template:
+//
+//	quote    escapes the value for the script type of the template
+//	shquote  escapes the value as a POSIX shell word
+//	psquote  escapes the value as a PowerShell literal
+//	pyquote  escapes the value as a Python literal
+type ScriptTemplate struct {
+	scriptType ScriptType
+	tmpl       *template.Template
+}
+
+// NewScriptTemplate parses the text as a template for a script of the given type.
+func NewScriptTemplate(scriptType ScriptType, text string, options ...TemplateOption) (*ScriptTemplate, error) {
+	t := &ScriptTemplate{
+		scriptType: scriptType,
+		tmpl:       template.New(string(scriptType)),
+	}
+	for _, option := range options {
+		option(t)
+	}
+	t.tmpl.Funcs(template.FuncMap{
+		"quote":   t.quote,
+		"shquote": QuoteShell,
+		"psquote": QuotePowerShell,
+		"pyquote": QuotePython,
+	})
+
+	if _, err := t.tmpl.Parse(text); err != nil {
+		return nil, fmt.Errorf("failed to parse script template: %w", err)
+	}
+	return t, nil
+}
+
+// ScriptType returns the script type of the template.
+func (t *ScriptTemplate) ScriptType() ScriptType {
+	return t.scriptType
+}
+
+// Render executes the template with the data and returns the resulting script.
+func (t *ScriptTemplate) Render(data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render script template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// Run renders the template with the data and executes the resulting script with the executor.
+func (t *ScriptTemplate) Run(e Executor, data interface{}, arguments []string, parameters map[string]string) (stdout string, stderr string, err error) {
+	script, err := t.Render(data)
+	if err != nil {
+		return "", "", err
+	}
+	return e.ExecuteScriptFromString(t.scriptType, script, arguments, parameters)
+}
+
+// quote escapes the value using the Quoter of the template's script type.
+func (t *ScriptTemplate) quote(value interface{}) (string, error) {
+	interpreter, err := interpreterFor(t.scriptType)
+	if err != nil {
+		return "", err
+	}
+	quoter, ok := interpreter.(Quoter)
+	if !ok {
+		return "", fmt.Errorf("script type %q does not support quoting", t.scriptType)
+	}
+	return quoter.Quote(value)
+}
+
+// QuoteShell returns the value as a single-quoted POSIX shell word. Values that are not strings are formatted with
+// fmt.Sprint first.
+func QuoteShell(value interface{}) (string, error) {
+	s, err := templateString(value)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsRune(s, 0) {
+		return "", errors.New("shell words can't contain NUL characters")
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'", nil
+}
+
+// QuotePowerShell returns the value as a PowerShell literal. Strings become single-quoted string literals, booleans,
+// numbers and nil become the matching PowerShell values and slices and maps become arrays and hashtables.
+func QuotePowerShell(value interface{}) (string, error) {
+	return powerShellLiteral(value)
+}
+
+// QuotePython returns the value as a Python literal. Strings become string literals, booleans, numbers and nil become
+// the matching Python values and slices and maps become lists and dicts.
+func QuotePython(value interface{}) (string, error) {
+	if value == nil {
+		return "None", nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String:
+		return quotePythonString(v.String()), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return "True", nil
+		}
+		return "False", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch {
+		case f != f:
+			return `float("nan")`, nil
+		case f > 0 && f*2 == f:
+			return `float("inf")`, nil
+		case f < 0 && f*2 == f:
+			return `float("-inf")`, nil
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return "None", nil
+		}
+		items := make([]string, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := QuotePython(v.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			items[i] = item
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case reflect.Map:
+		if v.IsNil() {
+			return "None", nil
+		}
+		items := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			k, err := QuotePython(key.Interface())
+			if err != nil {
+				return "", err
+			}
+			val, err := QuotePython(v.MapIndex(key).Interface())
+			if err != nil {
+				return "", err
+			}
+			items = append(items, k+": "+val)
+		}
+		sort.Strings(items)
+		return "{" + strings.Join(items, ", ") + "}", nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return "None", nil
+		}
+		return QuotePython(v.Elem().Interface())
+	}
+	return "", fmt.Errorf("unable to convert %T to a Python literal", value)
+}
+
+// templateString converts a template value to a string.
+func templateString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", errors.New("unable to quote a nil value")
+	case string:
+		return v, nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// quotePowerShellString returns a single-quoted PowerShell string literal. PowerShell treats the typographic single
+// quotes the same as the ASCII single quote so all of them are escaped by doubling.
+func quotePowerShellString(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\'', '‘', '’', '‚', '‛':
+			b.WriteRune(r)
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// quotePythonString returns a double-quoted Python string literal.
+func quotePythonString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			// Invalid UTF-8 can't be represented in a str literal so it is replaced like Python's "replace" handler
+			b.WriteRune(utf8.RuneError)
+			i++
+			continue
+		}
+		i += size
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			switch {
+			case r < 0x20 || r == 0x7f:
+				fmt.Fprintf(&b, `\x%02x`, r)
+			case r > 0xffff && !strconv.IsPrint(r):
+				fmt.Fprintf(&b, `\U%08x`, r)
+			case r > 0x7f && !strconv.IsPrint(r):
+				fmt.Fprintf(&b, `\u%04x`, r)
+			default:
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
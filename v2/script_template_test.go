@@ -0,0 +1,139 @@
+package execute
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestQuoteShell(t *testing.T) {
+	tests := map[string]string{
+		"simple":         "'simple'",
+		"it's":           `'it'\''s'`,
+		"$(rm -rf /)":    "'$(rm -rf /)'",
+		"a b\nc":         "'a b\nc'",
+		"":               "''",
+		"`whoami`; echo": "'`whoami`; echo'",
+	}
+	for input, expected := range tests {
+		got, err := QuoteShell(input)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got != expected {
+			t.Errorf("QuoteShell(%q): expected %s, but got %s", input, expected, got)
+		}
+	}
+
+	if _, err := QuoteShell("nul\x00byte"); err == nil {
+		t.Errorf("Expected error for NUL character, but got nil")
+	}
+}
+
+func TestQuotePowerShell(t *testing.T) {
+	tests := map[string]string{
+		"simple":     "'simple'",
+		"it's":       "'it''s'",
+		"it’s":       "'it’’s'",
+		"$env:PATH":  "'$env:PATH'",
+		"a`nb; calc": "'a`nb; calc'",
+		"":           "''",
+	}
+	for input, expected := range tests {
+		got, err := QuotePowerShell(input)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got != expected {
+			t.Errorf("QuotePowerShell(%q): expected %s, but got %s", input, expected, got)
+		}
+	}
+}
+
+func TestQuotePython(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{"simple", `"simple"`},
+		{`quote " and \ slash`, `"quote \" and \\ slash"`},
+		{"line\nbreak\x00", `"line\nbreak\x00"`},
+		{42, "42"},
+		{true, "True"},
+		{nil, "None"},
+		{1.5, "1.5"},
+		{[]string{"a", "b"}, `["a", "b"]`},
+		{map[string]int{"b": 2, "a": 1}, `{"a": 1, "b": 2}`},
+	}
+	for _, test := range tests {
+		got, err := QuotePython(test.input)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got != test.expected {
+			t.Errorf("QuotePython(%#v): expected %s, but got %s", test.input, test.expected, got)
+		}
+	}
+
+	if _, err := QuotePython(struct{}{}); err == nil {
+		t.Errorf("Expected error for unsupported type, but got nil")
+	}
+}
+
+func TestScriptTemplate(t *testing.T) {
+	t.Run("Render_UsesQuoterForScriptType", func(t *testing.T) {
+		tmpl, err := NewScriptTemplate(ScriptTypeBash, `echo {{ quote .Name }}`)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		script, err := tmpl.Render(map[string]string{"Name": "x'; rm -rf /"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if script != `echo 'x'\''; rm -rf /'` {
+			t.Errorf("Unexpected script: %s", script)
+		}
+	})
+
+	t.Run("Render_StrictFailsOnMissingKey", func(t *testing.T) {
+		tmpl, err := NewScriptTemplate(ScriptTypeBash, `echo {{ quote .Missing }}`, TemplateStrict())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := tmpl.Render(map[string]string{"Name": "value"}); err == nil {
+			t.Errorf("Expected error for missing key, but got nil")
+		}
+	})
+
+	t.Run("Render_WithUnquotableScriptType", func(t *testing.T) {
+		RegisterScriptType("test-noquote", &CommandInterpreter{FileExtension: ".txt", Binaries: []string{"cat"}})
+		tmpl, err := NewScriptTemplate("test-noquote", `{{ quote .Name }}`)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := tmpl.Render(map[string]string{"Name": "value"}); err == nil {
+			t.Errorf("Expected error for script type without quoting support, but got nil")
+		}
+	})
+
+	t.Run("Run_ExecutesRenderedScript", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("skipping test: requires bash")
+		}
+		if _, err := exec.LookPath("bash"); err != nil {
+			t.Skip("skipping test: bash not available")
+		}
+		tmpl, err := NewScriptTemplate(ScriptTypeBash, `echo {{ quote .Name }}`, TemplateStrict())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		stdout, stderr, err := tmpl.Run(NewExecutor(), map[string]string{"Name": "$(echo injected)"}, nil, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v (stderr: %s)", err, stderr)
+		}
+		if strings.TrimSpace(stdout) != "$(echo injected)" {
+			t.Errorf("Expected the value to be echoed literally, but got '%s'", stdout)
+		}
+	})
+}
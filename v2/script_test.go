@@ -0,0 +1,253 @@
+package execute
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRegisterScriptType(t *testing.T) {
+	t.Run("RegisterScriptType_AddsNewType", func(t *testing.T) {
+		interpreter := &CommandInterpreter{FileExtension: ".awk", Binaries: []string{"awk"}, Flags: []string{"-f"}}
+		RegisterScriptType("test-awk", interpreter)
+
+		got, ok := LookupScriptType("test-awk")
+		if !ok {
+			t.Fatalf("Expected script type to be registered")
+		}
+		if got != interpreter {
+			t.Errorf("Expected registered interpreter to be returned")
+		}
+	})
+
+	t.Run("LookupScriptType_WithUnknownType", func(t *testing.T) {
+		if _, ok := LookupScriptType("does-not-exist"); ok {
+			t.Errorf("Expected unknown script type to not be found")
+		}
+	})
+
+	t.Run("ScriptTypes_ContainsBuiltins", func(t *testing.T) {
+		types := ScriptTypes()
+		for _, expected := range []ScriptType{ScriptTypeBash, ScriptTypePowerShell, ScriptTypePython} {
+			found := false
+			for _, st := range types {
+				if st == expected {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Expected %s to be registered, got %v", expected, types)
+			}
+		}
+	})
+}
+
+func TestCommandInterpreterArgs(t *testing.T) {
+	t.Run("Args_WithParametersAndArguments", func(t *testing.T) {
+		interpreter := &CommandInterpreter{Flags: []string{"-u"}, ParameterPrefix: "--"}
+		args, err := interpreter.Args("script.py", []string{"pos"}, map[string]string{"b": "2", "a": "1"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := []string{"-u", "script.py", "--a", "1", "--b", "2", "pos"}
+		if !reflect.DeepEqual(args, expected) {
+			t.Errorf("Expected args %v, but got %v", expected, args)
+		}
+	})
+
+	t.Run("Args_WithUnsupportedParameters", func(t *testing.T) {
+		interpreter := &CommandInterpreter{}
+		if _, err := interpreter.Args("script.sh", nil, map[string]string{"a": "1"}); err == nil {
+			t.Errorf("Expected error for unsupported parameters, but got nil")
+		}
+	})
+}
+
+func TestExecuteScriptWithRegisteredType(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires a POSIX shell")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("skipping test: sh not available")
+	}
+	RegisterScriptType("test-sh", &CommandInterpreter{FileExtension: ".sh", Binaries: []string{"sh"}})
+
+	executor := NewExecutor()
+	stdout, stderr, err := executor.ExecuteScriptFromString("test-sh", `echo "$1 $2"`, []string{"Hello,", "World!"}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v (stderr: %s)", err, stderr)
+	}
+	if strings.TrimSpace(stdout) != "Hello, World!" {
+		t.Errorf("Expected stdout 'Hello, World!', but got '%s'", stdout)
+	}
+
+	_, _, err = executor.ExecuteScriptFromString("unregistered", "echo", nil, nil)
+	if err == nil {
+		t.Errorf("Expected error for unregistered script type, but got nil")
+	}
+}
+
+func TestStageScript(t *testing.T) {
+	t.Run("StageScript_WritesToScriptDir", func(t *testing.T) {
+		dir := t.TempDir()
+		executor := &BaseExecutor{}
+		executor.SetScriptDir(dir)
+
+		staged, err := executor.stageScript(ScriptTypeBash, "echo hello")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if filepath.Dir(staged.Path) != dir {
+			t.Errorf("Expected script to be staged in %s, but got %s", dir, staged.Path)
+		}
+		if !strings.HasSuffix(staged.Path, ".sh") {
+			t.Errorf("Expected script to have the .sh extension, but got %s", staged.Path)
+		}
+		if len(staged.SHA256) != 64 {
+			t.Errorf("Expected a SHA-256 hash, but got %s", staged.SHA256)
+		}
+		if runtime.GOOS != "windows" {
+			info, err := os.Stat(staged.Path)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if info.Mode().Perm() != 0700 {
+				t.Errorf("Expected permissions 0700, but got %o", info.Mode().Perm())
+			}
+		}
+
+		if err := staged.Close(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := os.Stat(staged.Path); !os.IsNotExist(err) {
+			t.Errorf("Expected staged script to be removed")
+		}
+	})
+
+	t.Run("StageScript_CleansUpOnError", func(t *testing.T) {
+		dir := t.TempDir()
+		executor := &BaseExecutor{}
+		executor.SetScriptDir(dir)
+		executor.SetUser("nobody")
+
+		// The zero value BaseExecutor has no platform so granting access to the user fails
+		if _, err := executor.stageScript(ScriptTypeBash, "echo hello"); err == nil {
+			t.Fatalf("Expected error, but got nil")
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("Expected script dir to be empty, but found %d entries", len(entries))
+		}
+	})
+}
+
+func TestExecuteScriptInMemory(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("skipping test: in-memory scripts are only supported on Linux")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("skipping test: bash not available")
+	}
+
+	dir := t.TempDir()
+	executor := NewExecutor(WithInMemoryScripts(), WithScriptDir(dir))
+	stdout, stderr, err := executor.ExecuteScriptFromString(ScriptTypeBash, `echo "in memory $1"`, []string{"ok"}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v (stderr: %s)", err, stderr)
+	}
+	if strings.TrimSpace(stdout) != "in memory ok" {
+		t.Errorf("Expected stdout 'in memory ok', but got '%s'", stdout)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("Expected nothing to be written to the script dir, but found %d entries", len(entries))
+	}
+}
+
+// extensionShell is a PowerShell-type interpreter which runs scripts with sh and prints the path it was given.
+type extensionShell struct {
+	*PowerShellInterpreter
+}
+
+func (i extensionShell) LookPath() (string, error) {
+	return exec.LookPath("sh")
+}
+
+func (i extensionShell) Args(scriptPath string, arguments []string, parameters map[string]string) ([]string, error) {
+	return []string{scriptPath}, nil
+}
+
+func (i extensionShell) TypedArgs(scriptPath string, arguments []string, parameters ScriptParameters) ([]string, error) {
+	return []string{scriptPath}, nil
+}
+
+func TestExecuteScriptInMemoryRequiringExtension(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("skipping test: in-memory scripts are only supported on Linux")
+	}
+	RegisterScriptType("test-extension", extensionShell{&PowerShellInterpreter{}})
+
+	dir := t.TempDir()
+	executor := NewExecutor(WithInMemoryScripts(), WithScriptDir(dir))
+	stdout, stderr, err := executor.ExecuteScriptFromString("test-extension", `echo "$0"`, nil, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v (stderr: %s)", err, stderr)
+	}
+	path := strings.TrimSpace(stdout)
+	if filepath.Dir(path) != dir || filepath.Ext(path) != ".ps1" {
+		t.Errorf("Expected the script to be staged on disk in %s with the .ps1 extension, but got %s", dir, path)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected staged script to be removed")
+	}
+}
+
+func TestExecuteScriptFromFS(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test: requires bash")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("skipping test: bash not available")
+	}
+
+	fsys := fstest.MapFS{
+		"scripts/main.sh":        {Data: []byte("source lib/helpers.sh\ngreet \"$1\"\ncat data.txt\n")},
+		"scripts/lib/helpers.sh": {Data: []byte("greet() { echo \"Hello, $1\"; }\n")},
+		"scripts/data.txt":       {Data: []byte("data\n")},
+		"other/ignored.sh":       {Data: []byte("exit 1\n")},
+	}
+
+	dir := t.TempDir()
+	executor, ok := NewExecutor(WithScriptDir(dir)).(FSScriptExecutor)
+	if !ok {
+		t.Fatalf("Expected executor to implement FSScriptExecutor")
+	}
+
+	t.Run("ExecuteScriptFromFS_WithHelpers", func(t *testing.T) {
+		stdout, stderr, err := executor.ExecuteScriptFromFS(fsys, "scripts/main.sh", ScriptTypeBash, []string{"World"}, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v (stderr: %s)", err, stderr)
+		}
+		if stdout != "Hello, World\ndata\n" {
+			t.Errorf("Expected stdout 'Hello, World\\ndata\\n', but got '%s'", stdout)
+		}
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 0 {
+			t.Errorf("Expected bundle to be cleaned up, but found %d entries", len(entries))
+		}
+	})
+
+	t.Run("ExecuteScriptFromFS_WithMissingScript", func(t *testing.T) {
+		if _, _, err := executor.ExecuteScriptFromFS(fsys, "scripts/missing.sh", ScriptTypeBash, nil, nil); err == nil {
+			t.Fatalf("Expected error, but got nil")
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package execute
+
+import (
+	"context"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// redactedValue replaces secrets such as the sudo password in redacted specs.
+const redactedValue = "******"
+
+// CommandSpec describes a fully resolved command as it is passed to the operating system, after the binary has been
+// looked up and the shell and sudo wrapping of the executor has been applied.
+type CommandSpec struct {
+	// Command is the command or script path as it was passed to the executor.
+	Command string `json:"command"`
+	// Path is the resolved path of the binary that is executed.
+	Path string `json:"path"`
+	// Args are the arguments passed to the binary, not including the binary itself.
+	Args []string `json:"args,omitempty"`
+	// Env is the environment of the process. When it is empty the process inherits the environment of the caller.
+	Env []string `json:"env,omitempty"`
+	// ExtraEnv is added to the environment of the process, on top of Env or the inherited environment when Env is
+	// empty. Variables in ExtraEnv take precedence.
+	ExtraEnv []string `json:"extra_env,omitempty"`
+	// Dir is the working directory of the process. When it is empty the working directory of the caller is used.
+	Dir string `json:"dir,omitempty"`
+	// User is the user the process runs as.
+	User string `json:"user,omitempty"`
+	// Timeout is the timeout of the command, 0 means no timeout.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// ScriptType is set when the command executes a script.
+	ScriptType ScriptType `json:"script_type,omitempty"`
+	// ScriptSHA256 is the hex encoded SHA-256 hash of the script when the command executes a script.
+	ScriptSHA256 string `json:"script_sha256,omitempty"`
+	// TTY is set when the command is attached to the terminal of the caller.
+	TTY bool `json:"tty,omitempty"`
+	// Stdin is the input of the process.
+	Stdin io.Reader `json:"-"`
+
+	ctx        context.Context
+	extraFiles []*os.File
+	secrets    []string
+	onExit     []func(result *Result)
+	onOutput   []func(stream string, data []byte)
+	attempt    int
+	previous   []*Result
+}
+
+// OnExit registers a function which is called with the result once the command described by the spec has finished,
+// before the Finished channel of the ExecutionResult is signaled. It allows middleware to observe the outcome of the
+// execution it wrapped. Functions are called in the reverse order of their registration.
+func (s *CommandSpec) OnExit(fn func(result *Result)) {
+	s.onExit = append(s.onExit, fn)
+}
+
+// OnOutput registers a function which is called with the output of the command as it is read from the process, with
+// the stream set to "stdout" or "stderr". The function may be called concurrently for both streams and must not
+// retain the data after it returns.
+func (s *CommandSpec) OnOutput(fn func(stream string, data []byte)) {
+	s.onOutput = append(s.onOutput, fn)
+}
+
+// AddSecret registers a value which is replaced wherever it appears in the redacted spec.
+func (s *CommandSpec) AddSecret(secret string) {
+	if secret == "" {
+		return
+	}
+	for _, existing := range s.secrets {
+		if existing == secret {
+			return
+		}
+	}
+	s.secrets = append(s.secrets, secret)
+}
+
+// Argv returns the binary followed by its arguments.
+func (s *CommandSpec) Argv() []string {
+	return append([]string{s.Path}, s.Args...)
+}
+
+// Redacted returns a copy of the spec with secrets, such as a sudo password injected into a shell command or the
+// values of sensitive environment variables, replaced.
+func (s *CommandSpec) Redacted() *CommandSpec {
+	c := *s
+	c.secrets = nil
+	c.onExit = nil
+	c.onOutput = nil
+	c.previous = nil
+	c.Command = s.redact(s.Command)
+	c.Args = make([]string, len(s.Args))
+	for i, arg := range s.Args {
+		c.Args[i] = s.redact(arg)
+	}
+	c.Env = s.redactAll(s.Env)
+	c.ExtraEnv = s.redactAll(s.ExtraEnv)
+	return &c
+}
+
+// String returns the redacted command line with every word quoted for a POSIX shell.
+func (s *CommandSpec) String() string {
+	argv := s.Redacted().Argv()
+	words := make([]string, len(argv))
+	for i, word := range argv {
+		quoted, err := QuoteShell(word)
+		if err != nil {
+			quoted = word
+		}
+		words[i] = quoted
+	}
+	return strings.Join(words, " ")
+}
+
+// Environ returns the environment of the process, which is Env, or base when Env is empty, followed by ExtraEnv.
+func (s *CommandSpec) Environ(base []string) []string {
+	env := s.Env
+	if env == nil {
+		env = base
+	}
+	return append(append(make([]string, 0, len(env)+len(s.ExtraEnv)), env...), s.ExtraEnv...)
+}
+
+// clone returns a copy of the spec which can be modified without affecting the spec.
+func (s *CommandSpec) clone() *CommandSpec {
+	c := *s
+	c.Args = slices.Clone(s.Args)
+	c.Env = slices.Clone(s.Env)
+	c.ExtraEnv = slices.Clone(s.ExtraEnv)
+	c.secrets = slices.Clone(s.secrets)
+	c.onExit = slices.Clone(s.onExit)
+	c.onOutput = slices.Clone(s.onOutput)
+	return &c
+}
+
+// outputFunc returns a function passing the output of the stream to the functions registered with OnOutput.
+func (s *CommandSpec) outputFunc(stream string) func(data []byte) {
+	return func(data []byte) {
+		for _, fn := range s.onOutput {
+			fn(stream, data)
+		}
+	}
+}
+
+// parentContext returns the context the command is executed in, which is cancelled when the caller of
+// ExecuteSpecAsync gives up on the command.
+func (s *CommandSpec) parentContext() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// redactAll returns a copy of the values with all secrets replaced.
+func (s *CommandSpec) redactAll(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	redacted := make([]string, len(values))
+	for i, value := range values {
+		redacted[i] = s.redact(value)
+	}
+	return redacted
+}
+
+// redact replaces all secrets in the value.
+func (s *CommandSpec) redact(value string) string {
+	for _, secret := range s.secrets {
+		if secret != "" {
+			value = strings.ReplaceAll(value, secret, redactedValue)
+		}
+	}
+	return value
+}
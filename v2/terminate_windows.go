@@ -0,0 +1,8 @@
+package execute
+
+import "os"
+
+// terminate kills the process since Windows has no signal which asks a process to exit.
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
@@ -0,0 +1,147 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Transport starts the processes of an executor somewhere other than the local system, e.g. on a remote host over
+// SSH. Commands are still resolved by the executor, so shell and sudo handling, scripts, dry-run mode, auditing,
+// middleware and hooks apply unchanged. The executor's user is passed to the transport in the spec and is applied by
+// the transport.
+type Transport interface {
+	// LookPath resolves the binary on the target.
+	LookPath(binary string) (string, error)
+	// Start starts the process described by the spec. The process must be killed when ctx is done. When spec.TTY is
+	// set the process is attached to the terminal of the current process and its output isn't returned.
+	Start(ctx context.Context, spec *CommandSpec) (Process, error)
+}
+
+// Process is a process started by a Transport.
+type Process interface {
+	// Stdout returns the stdout of the process. It may return nil when the output isn't captured.
+	Stdout() io.Reader
+	// Stderr returns the stderr of the process. It may return nil when the output isn't captured.
+	Stderr() io.Reader
+	// Wait waits for the process to exit after its output has been read. Errors for processes that exited with a
+	// non-zero code should implement `ExitCode() int`.
+	Wait() error
+}
+
+// FileTransport is implemented by transports that are able to stage script files on the target, which is required to
+// execute scripts passed as strings.
+type FileTransport interface {
+	Transport
+	// StageFile writes the data to a new temporary file with the extension that is only accessible by the owner, or
+	// the user the transport connects as when owner is empty, and returns its path.
+	StageFile(data []byte, extension string, owner string) (path string, err error)
+	// RemoveFile removes a file staged by StageFile.
+	RemoveFile(path string) error
+}
+
+// errTransportUnsupported is returned for features that are not supported by the transport of the executor.
+var errTransportUnsupported = errors.New("not supported by the transport of the executor")
+
+// SetTransport sets the transport used to start processes. A nil transport starts local processes.
+func (e *BaseExecutor) SetTransport(transport Transport) {
+	e.transport = transport
+}
+
+// Transport returns the transport used to start processes, or nil for local processes.
+func (e *BaseExecutor) Transport() Transport {
+	return e.transport
+}
+
+// lookPath resolves the binary locally or through the transport.
+func (e *BaseExecutor) lookPath(binary string) (string, error) {
+	if e.transport != nil {
+		return e.transport.LookPath(binary)
+	}
+	return exec.LookPath(binary)
+}
+
+// lookInterpreter resolves the binary of the interpreter locally or through the transport.
+func (e *BaseExecutor) lookInterpreter(interpreter Interpreter) (string, error) {
+	if e.transport == nil {
+		return interpreter.LookPath()
+	}
+
+	var candidates []string
+	if i, ok := interpreter.(interface{ binaries() []string }); ok {
+		candidates = i.binaries()
+	} else {
+		// Custom interpreters only resolve their binary locally so its name is resolved on the target instead
+		local, err := interpreter.LookPath()
+		if err != nil {
+			return "", err
+		}
+		candidates = []string{filepath.Base(local)}
+	}
+
+	var firstErr error
+	for _, binary := range candidates {
+		path, err := e.transport.LookPath(binary)
+		if err == nil {
+			return path, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = errors.New("no interpreter binaries configured")
+	}
+	return "", firstErr
+}
+
+// stageScriptWithTransport stages the script on the target of the transport.
+func (e *BaseExecutor) stageScriptWithTransport(interpreter Interpreter, script string, hash string) (*stagedScript, error) {
+	files, ok := e.transport.(FileTransport)
+	if !ok {
+		return nil, fmt.Errorf("scripts from strings are %w", errTransportUnsupported)
+	}
+	path, err := files.StageFile([]byte(script), interpreter.Extension(), e.user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stage script: %w", err)
+	}
+	return &stagedScript{
+		Path:   path,
+		SHA256: hash,
+		remove: func() error { return files.RemoveFile(path) },
+	}, nil
+}
+
+// startTransport starts the command through the transport and returns the ExecutionResult used to interact with the
+// running process.
+func (e *BaseExecutor) startTransport(spec *CommandSpec, ctx context.Context, cancel context.CancelFunc, started <-chan struct{}) (*ExecutionResult, error) {
+	startTime := time.Now()
+	process, err := e.transport.Start(ctx, spec)
+	if err != nil {
+		e.log().Error("failed to start command", "error", err)
+		if cancel != nil {
+			cancel()
+		}
+		return nil, err
+	}
+	e.log().Trace("started command through the transport")
+
+	streams := e.newOutputStreams(spec, readCloser(process.Stdout()), readCloser(process.Stderr()))
+	return e.monitor(spec, streams, process.Wait, startTime, ctx, cancel, started), nil
+}
+
+// readCloser returns the reader as an io.ReadCloser, or an empty reader if it is nil.
+func readCloser(r io.Reader) io.ReadCloser {
+	if r == nil {
+		return io.NopCloser(strings.NewReader(""))
+	}
+	if rc, ok := r.(io.ReadCloser); ok {
+		return rc
+	}
+	return io.NopCloser(r)
+}